@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/vdobler/webtest/stat"
+)
+
+// Machine readable result of benchmarking one test.
+type benchResult struct {
+	Suite    string          // name of the suite
+	Test     string          // title of the test
+	Failures int             // number of failed runs
+	RT       *stat.Histogram // response times in µs
+	Samples  []int64         // unbinned response times in µs
+}
+
+// Machine readable results of a benchmark run as written to wtresults_*.json.
+type benchResults struct {
+	Date    time.Time
+	Runs    int
+	Results []benchResult
+}
+
+// Write benchmark results to filename as JSON.
+func writeBenchResults(results benchResults, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// Read benchmark results written by writeBenchResults from filename.
+func readBenchResults(filename string) (results benchResults, err error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	err = json.NewDecoder(file).Decode(&results)
+	return
+}
+
+// Response times in ms of the µs samples.
+func msValues(samples []int64) (values []float64) {
+	values = make([]float64, len(samples))
+	for i, us := range samples {
+		values[i] = float64(us) / 1000
+	}
+	return
+}
+
+// Compare the benchmark results old and cur test by test like benchstat:
+// The median, 90% and 99% response times are reported together with the
+// p-value of a Mann-Whitney U test on the unbinned response times. A test
+// regressed if its median got slower by more than threshold percent and the
+// difference is significant at level alpha. Returns the report and whether
+// any test regressed.
+func compareBench(old, cur benchResults, threshold, alpha float64) (text string, regressed bool) {
+	index := make(map[string]benchResult)
+	for _, r := range old.Results {
+		index[r.Suite+"\x00"+r.Test] = r
+	}
+
+	text = fmt.Sprintf("%-30s %9s %9s %8s %8s %8s %8s\n",
+		"Test", "old p50", "new p50", "delta", "p90", "p99", "p-value")
+	for _, n := range cur.Results {
+		title := n.Test
+		if len(title) > 30 {
+			title = title[:27] + "..."
+		}
+		o, ok := index[n.Suite+"\x00"+n.Test]
+		if !ok || o.RT == nil || n.RT == nil || o.RT.Count() == 0 || n.RT.Count() == 0 {
+			text += fmt.Sprintf("%-30s %s\n", title, "not in both runs")
+			continue
+		}
+		if len(o.Samples) == 0 || len(n.Samples) == 0 {
+			text += fmt.Sprintf("%-30s %s\n", title, "no unbinned response times")
+			continue
+		}
+
+		delta := func(p float64) float64 {
+			ov, nv := float64(o.RT.Percentile(p)), float64(n.RT.Percentile(p))
+			if ov == 0 {
+				return 0
+			}
+			return 100 * (nv - ov) / ov
+		}
+		_, pval := stat.MannWhitneyU(msValues(o.Samples), msValues(n.Samples))
+		d := fmt.Sprintf("%+.1f%%", delta(50))
+		if pval > alpha {
+			d = "~" // not significant
+		}
+		text += fmt.Sprintf("%-30s %7.1fms %7.1fms %8s %+7.1f%% %+7.1f%% %8.3f  (n=%d+%d)",
+			title, float64(o.RT.Percentile(50))/1000, float64(n.RT.Percentile(50))/1000, d,
+			delta(90), delta(99), pval, o.RT.Count(), n.RT.Count())
+		if pval <= alpha && delta(50) > threshold {
+			text += "  REGRESSION"
+			regressed = true
+		}
+		text += "\n"
+	}
+	return
+}
+
+// Compare two benchmark result files. Returns true if a test regressed.
+func compare(oldfilename, newfilename string) bool {
+	old, err := readBenchResults(oldfilename)
+	if err != nil {
+		errorf("Cannot read benchmark results from %s: %s", oldfilename, err.Error())
+		os.Exit(2)
+	}
+	cur, err := readBenchResults(newfilename)
+	if err != nil {
+		errorf("Cannot read benchmark results from %s: %s", newfilename, err.Error())
+		os.Exit(2)
+	}
+	text, regressed := compareBench(old, cur, compareThreshold, compareAlpha)
+	fmt.Print(text)
+	return regressed
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/vdobler/webtest/stat"
+)
+
+// Benchmark result of 20 runs of test taking base, base+spread, ... µs.
+func benchRun(test string, base, spread int64) benchResult {
+	r := benchResult{Suite: "s", Test: test, RT: stat.NewHistogram()}
+	for i := int64(0); i < 20; i++ {
+		r.RT.Record(base + i*spread)
+		r.Samples = append(r.Samples, base+i*spread)
+	}
+	return r
+}
+
+func TestCompareBench(t *testing.T) {
+	old := benchResults{Runs: 20, Results: []benchResult{
+		benchRun("Stable", 100000, 2000),
+		benchRun("Slower", 100000, 2000),
+		benchRun("Faster", 200000, 2000),
+		benchRun("Removed", 100000, 2000),
+		benchRun("Same bucket", 99400, 1),
+	}}
+	cur := benchResults{Runs: 20, Results: []benchResult{
+		benchRun("Stable", 101000, 2000),
+		benchRun("Slower", 150000, 2000),
+		benchRun("Faster", 100000, 2000),
+		benchRun("Added", 100000, 2000),
+		benchRun("Same bucket", 99900, 1),
+	}}
+
+	dir, err := ioutil.TempDir("", "webtest-bench")
+	if err != nil {
+		t.Fatalf("Cannot create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	filename := path.Join(dir, "old.json")
+	if err = writeBenchResults(old, filename); err != nil {
+		t.Fatalf("Cannot write results: %s", err.Error())
+	}
+	if old, err = readBenchResults(filename); err != nil || len(old.Results) != 5 ||
+		old.Results[1].RT.Count() != 20 || len(old.Results[1].Samples) != 20 {
+		t.Fatalf("Cannot read back results: %v", err)
+	}
+
+	text, regressed := compareBench(old, cur, 5, 0.05)
+	if !regressed {
+		t.Errorf("Regression not detected:\n%s", text)
+	}
+	lines := strings.Split(text, "\n")
+	// Same bucket: Significant although all values fall into the same bucket.
+	for i, want := range []string{"", " ~ ", "REGRESSION", "-", "not in both runs", " 0.000 "} {
+		if !strings.Contains(lines[i], want) {
+			t.Errorf("Line %d %q does not contain %q", i, lines[i], want)
+		}
+	}
+	if strings.Contains(lines[3], "REGRESSION") || strings.Contains(lines[1], "REGRESSION") ||
+		strings.Contains(lines[5], "REGRESSION") {
+		t.Errorf("False regression:\n%s", text)
+	}
+
+	if text, regressed = compareBench(old, cur, 60, 0.05); regressed {
+		t.Errorf("Regression below threshold reported:\n%s", text)
+	}
+}
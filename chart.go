@@ -0,0 +1,47 @@
+package main
+
+import (
+	"image/color"
+	"image/png"
+	"os"
+
+	"github.com/ajstarks/svgo"
+	"github.com/vdobler/chart"
+	"github.com/vdobler/chart/imgg"
+	"github.com/vdobler/chart/svgg"
+)
+
+var white = color.RGBA{255, 255, 255, 255}
+
+// Write chart c as SVG and as PNG of size width x height to the files
+// outputPath+name+".svg" and outputPath+name+".png". Returns the names
+// of the files written.
+func writeChart(c chart.Chart, width, height int, name string) (files []string) {
+	filename := outputPath + name + ".svg"
+	if file, err := os.Create(filename); err != nil {
+		errorf("Cannot write to %q: %s", filename, err.Error())
+	} else {
+		thesvg := svg.New(file)
+		thesvg.Start(width, height)
+		thesvg.Rect(0, 0, width, height, "fill: #ffffff")
+		c.Plot(svgg.New(thesvg, width, height, "Arial", 12, white))
+		thesvg.End()
+		file.Close()
+		files = append(files, filename)
+	}
+
+	filename = outputPath + name + ".png"
+	if file, err := os.Create(filename); err != nil {
+		errorf("Cannot write to %q: %s", filename, err.Error())
+	} else {
+		img := imgg.New(width, height, white, nil, nil)
+		c.Plot(img)
+		if err = png.Encode(file, img.Image); err != nil {
+			errorf("Cannot write to %q: %s", filename, err.Error())
+		} else {
+			files = append(files, filename)
+		}
+		file.Close()
+	}
+	return
+}
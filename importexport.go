@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vdobler/webtest/suite"
+)
+
+// Convert the HAR file filename to a suite printed to stdout.
+func importHAR(filename string) {
+	file, err := os.Open(filename)
+	if err != nil {
+		errorf("Cannot read from %s: %s", filename, err.Error())
+		os.Exit(2)
+	}
+	defer file.Close()
+	s, err := suite.ImportHAR(file, importStatic)
+	if err != nil {
+		errorf("Cannot import %s: %s", filename, err.Error())
+		os.Exit(2)
+	}
+	fmt.Printf("#\n# Imported from %s\n#\n\n%s", filename, s.String())
+}
+
+// Convert the OpenAPI spec in filename to a suite printed to stdout.
+func importOpenAPISpec(filename string) {
+	file, err := os.Open(filename)
+	if err != nil {
+		errorf("Cannot read from %s: %s", filename, err.Error())
+		os.Exit(2)
+	}
+	defer file.Close()
+	s, err := suite.ImportOpenAPI(file)
+	if err != nil {
+		errorf("Cannot import %s: %s", filename, err.Error())
+		os.Exit(2)
+	}
+	fmt.Printf("#\n# Generated from %s\n#\n\n%s", filename, s.String())
+}
+
+// Write the requests and responses recorded during testing to filename.
+func writeHAR(filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		errorf("Cannot write HAR to %s: %s", filename, err.Error())
+		return
+	}
+	defer file.Close()
+	if err = suite.Recorder.Write(file); err != nil {
+		errorf("Cannot write HAR to %s: %s", filename, err.Error())
+	}
+}
+
+// Print curl command lines for the selected tests of the suite in filename.
+func curl(filename string) {
+	s, _, err := readSuite(filename)
+	if err != nil {
+		os.Exit(2)
+	}
+	for i := range s.Test {
+		if !shouldRun(s, 1, i+1) {
+			continue
+		}
+		fmt.Printf("# %d: %s\n", i+1, s.Test[i].Title)
+		cmd, err := s.Test[i].Curl(s.Global)
+		if err != nil {
+			fmt.Printf("# Cannot reproduce: %s\n\n", err.Error())
+			continue
+		}
+		fmt.Printf("%s\n\n", cmd)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/vdobler/webtest/suite"
+)
+
+// Serve live metrics of stresstests and benchmarks on addr: Prometheus
+// text format under /metrics and a small self-refreshing HTML page under /.
+// An error is returned if addr cannot be listened on.
+func startMetricsServer(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	suite.LiveMetrics = suite.NewMetrics()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		suite.LiveMetrics.WritePrometheus(w)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		writeMetricsPage(w, suite.LiveMetrics)
+	})
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			errorf("Cannot serve metrics on %s: %s", addr, err.Error())
+		}
+	}()
+	infof("Serving live metrics on http://%s/", ln.Addr())
+	return nil
+}
+
+// Write the current metrics m as HTML page to w.
+func writeMetricsPage(w io.Writer, m *suite.Metrics) {
+	load, uptime, tests := m.Snapshot()
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html><head><meta http-equiv="refresh" content="2"><title>Webtest</title>
+<style>body{font-family:sans-serif} td,th{padding:2px 8px;text-align:right} td.l,th.l{text-align:left}</style>
+</head><body>
+<h1>Webtest</h1>
+<p>Load: %d &nbsp; Running since: %s</p>
+<table>
+<tr><th class="l">Kind</th><th class="l">Test</th><th>Requests</th><th>Failures</th><th>Errors</th>
+<th>RPS</th><th>p50 [ms]</th><th>p90 [ms]</th><th>p99 [ms]</th><th>Max [ms]</th></tr>
+`, load, uptime-uptime%time.Second)
+	for _, t := range tests {
+		fmt.Fprintf(w, "<tr><td class=\"l\">%s</td><td class=\"l\">%s</td><td>%d</td><td>%d</td><td>%d</td>"+
+			"<td>%.1f</td><td>%.1f</td><td>%.1f</td><td>%.1f</td><td>%.1f</td></tr>\n",
+			t.Kind, html.EscapeString(t.Title), t.Requests, t.Failures, t.Errors,
+			t.RPS, t.P50, t.P90, t.P99, t.Max)
+	}
+	fmt.Fprintf(w, "</table>\n<p><a href=\"/metrics\">Prometheus metrics</a></p>\n</body></html>\n")
+}
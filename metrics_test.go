@@ -0,0 +1,17 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMetricsServerPortInUse(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %s", err.Error())
+	}
+	defer ln.Close()
+	if err := startMetricsServer(ln.Addr().String()); err == nil {
+		t.Errorf("Expected error on occupied port %s", ln.Addr())
+	}
+}
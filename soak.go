@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/vdobler/chart"
+	"github.com/vdobler/webtest/stat"
+	"github.com/vdobler/webtest/suite"
+)
+
+// Trend of some quantity over a soaktest as estimated by linear regression.
+type soakTrend struct {
+	start, end float64 // fitted values at start and end of soaktest
+	r2         float64 // coefficient of determination of fit
+}
+
+// Fit a trend to y sampled at x (in seconds) over duration.
+func fitTrend(x, y []float64, duration time.Duration) soakTrend {
+	a, b, r2 := stat.LinearRegression(x, y)
+	return soakTrend{start: a, end: a + b*duration.Seconds(), r2: r2}
+}
+
+// Relative increase in percent from start to end of trend.
+func (t soakTrend) increase() float64 {
+	base := t.start
+	if base < 1 {
+		base = 1 // avoid blowing up on (almost) zero values
+	}
+	return 100 * (t.end - t.start) / base
+}
+
+// Percentage of failed or errored checks of the test suite in d.
+func testErrorRate(d suite.SoakSample) float64 {
+	total := d.Total + d.Err
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(d.Fail+d.Err) / float64(total)
+}
+
+// Percentage of errored background requests in d.
+func bgErrorRate(d suite.SoakSample) float64 {
+	if d.BgN == 0 {
+		return 0
+	}
+	return 100 * float64(d.BgErr) / float64(d.BgN)
+}
+
+// Analyse samples of a soaktest of the given duration for degradation:
+// Average and 99% response times must not increase by more than maxIncrease
+// percent and neither the error rate of the test suite nor the one of the
+// background requests may rise by more than maxErrRise percentage points
+// over the whole duration. Returns a report and whether degradation was
+// detected.
+func soakDegradation(samples []suite.SoakSample, duration time.Duration, maxIncrease, maxErrRise float64) (text string, degraded bool) {
+	if len(samples) < 3 {
+		return "Too few samples to detect trends.\n", false
+	}
+	n := len(samples)
+	x, avg, p99 := make([]float64, n), make([]float64, n), make([]float64, n)
+	errs, bgErrs, background := make([]float64, n), make([]float64, n), false
+	for i, d := range samples {
+		x[i] = d.Elapsed.Seconds()
+		avg[i] = float64(d.AvgRT)
+		p99[i] = float64(msDistribution(d.RT, []float64{99})[0])
+		errs[i] = testErrorRate(d)
+		bgErrs[i] = bgErrorRate(d)
+		background = background || d.BgN > 0
+	}
+
+	for _, q := range []struct {
+		name  string
+		trend soakTrend
+	}{{"Average", fitTrend(x, avg, duration)}, {"99%", fitTrend(x, p99, duration)}} {
+		t := q.trend
+		text += fmt.Sprintf("%s Response Time Trend: %.0f ms --> %.0f ms (%+.1f%%, r2=%.2f)",
+			q.name, t.start, t.end, t.increase(), t.r2)
+		if t.increase() > maxIncrease {
+			text += fmt.Sprintf("  DEGRADED: more than %g%% increase", maxIncrease)
+			degraded = true
+		}
+		text += "\n"
+	}
+	errorTrend := func(name string, rates []float64) {
+		t := fitTrend(x, rates, duration)
+		text += fmt.Sprintf("%s Trend: %.2f%% --> %.2f%% (r2=%.2f)", name, t.start, t.end, t.r2)
+		if t.end-t.start > maxErrRise {
+			text += fmt.Sprintf("  DEGRADED: error rate rises more than %g percentage points", maxErrRise)
+			degraded = true
+		}
+		text += "\n"
+	}
+	errorTrend("Error Rate", errs)
+	if background {
+		errorTrend("Background Error Rate", bgErrs)
+	}
+	return
+}
+
+// Write time series of soaktest samples to file.
+func saveSoaktestData(samples []suite.SoakSample, filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		errorf("Cannot write to %q: %s", filename, err.Error())
+		return
+	}
+	defer file.Close()
+	file.WriteString("Elapsed,Tests,AvgRT,P50RT,P99RT,MaxRT,Errors,Failures,Checks,BgRequests,BgErrors\n")
+	for _, d := range samples {
+		p := msDistribution(d.RT, []float64{50, 99})
+		fmt.Fprintf(file, "%.0f,%d,%d,%d,%d,%d,%d,%d,%d,%d,%d\n", d.Elapsed.Seconds(), d.N,
+			d.AvgRT, p[0], p[1], d.MaxRT, d.Err, d.Fail, d.Total, d.BgN, d.BgErr)
+	}
+}
+
+// Write chart of response times and error rate over time to
+// soaktest.{svg,png}.
+func writeSoakChart(samples []suite.SoakSample) []string {
+	var c chart.ScatterChart
+	c.Title = "Soaktest"
+	c.XRange.Label = "Time [min]"
+	c.YRange.Label = "Response Time [ms]"
+	c.YRange.MinMode.Fixed = true
+	c.YRange.MinMode.Value = 0
+	c.Key.Pos = "itl"
+
+	n := len(samples)
+	t, avg, p99 := make([]float64, n), make([]float64, n), make([]float64, n)
+	errs, bgErrs, background := make([]float64, n), make([]float64, n), false
+	for i, d := range samples {
+		t[i] = d.Elapsed.Minutes()
+		avg[i] = float64(d.AvgRT)
+		p99[i] = float64(msDistribution(d.RT, []float64{99})[0])
+		errs[i] = testErrorRate(d)
+		bgErrs[i] = bgErrorRate(d)
+		background = background || d.BgN > 0
+	}
+	c.AddDataPair("99% RT", t, p99, chart.PlotStyleLinesPoints, chart.AutoStyle(1, false))
+	c.AddDataPair("Avg RT", t, avg, chart.PlotStyleLinesPoints, chart.AutoStyle(2, false))
+	if n > 1 {
+		a, b, _ := stat.LinearRegression(t, avg)
+		c.AddFunc("Avg Trend", func(x float64) float64 { return a + b*x },
+			chart.PlotStyleLines, chart.AutoStyle(4, false))
+	}
+	files := writeChart(&c, 600, 400, "soaktest")
+
+	var ec chart.ScatterChart
+	ec.Title = "Soaktest Errors"
+	ec.XRange.Label = "Time [min]"
+	ec.YRange.Label = "Error Rate [%]"
+	ec.YRange.MinMode.Fixed = true
+	ec.YRange.MinMode.Value = 0
+	ec.Key.Pos = "itl"
+	ec.AddDataPair("Tests", t, errs, chart.PlotStyleLinesPoints, chart.AutoStyle(3, false))
+	if background {
+		ec.AddDataPair("Background", t, bgErrs, chart.PlotStyleLinesPoints, chart.AutoStyle(5, false))
+	}
+	return append(files, writeChart(&ec, 600, 300, "soaktest-errors")...)
+}
+
+// Perform soaktest: Hold a constant background load for soakDuration and
+// run the test suite every soakInterval. Returns true if degradation was
+// detected.
+func soaktest(bgfilename, testfilename string) bool {
+	background, testsuite := readStressSuites(bgfilename, testfilename)
+	if background == nil {
+		return false
+	}
+
+	soak := suite.Soak{Load: rampStart, Duration: soakDuration, Interval: soakInterval}
+	if rateStart > 0 {
+		soak.Rate = suite.OpenLoad{Rate: rateStart, Concurrency: rateConc}
+		warnf("Soaktesting for %s with background load of %d requests/second.", soakDuration, rateStart)
+	} else {
+		warnf("Soaktesting for %s with background load of %d || requests.", soakDuration, rampStart)
+	}
+
+	// Warmup of server: Make sure chaches are hot.
+	testsuite.Stresstest(background, 0, 1, 10)
+
+	filename := outputPath + "soaktest_" + time.Now().Format("2006-01-02_15-04-05") + ".csv"
+	var samples []suite.SoakSample
+	testsuite.Soaktest(background, soak, func(d suite.SoakSample) {
+		samples = append(samples, d)
+		saveSoaktestData(samples, filename)
+		writeSoakChart(samples)
+		p := msDistribution(d.RT, []float64{99})
+		fmt.Printf("%9s: Response Time %5d / %5d / %5d (avg/99%%/max). Status %2d / %2d / %2d (err/pass/fail).",
+			d.Elapsed-d.Elapsed%time.Second, d.AvgRT, p[0], d.MaxRT, d.Err, d.Pass, d.Fail)
+		if d.BgN > 0 {
+			fmt.Printf(" Background %d requests (%.1f/s), %d errors.", d.BgN, d.Rate, d.BgErr)
+		}
+		fmt.Println()
+	})
+
+	text, degraded := soakDegradation(samples, soakDuration, soakRTIncrease, soakErrRise)
+	fmt.Print("============================ Soaktest Results ====================================\n" + text)
+	warnf("Wrote soaktest data to file %s", filename)
+	for _, f := range writeSoakChart(samples) {
+		warnf("Wrote soaktest chart to file %s", f)
+	}
+	return degraded
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vdobler/webtest/stat"
+	"github.com/vdobler/webtest/suite"
+)
+
+func soakSamples(rt func(i int) int64, fail func(i int) int) (samples []suite.SoakSample) {
+	for i := 0; i < 10; i++ {
+		d := suite.SoakSample{Elapsed: time.Duration(i) * time.Minute}
+		d.N, d.Total, d.Fail = 10, 100, fail(i)
+		d.AvgRT = rt(i)
+		d.RT = stat.NewHistogram()
+		d.RT.Record(rt(i) * 1000)
+		samples = append(samples, d)
+	}
+	return
+}
+
+func TestSoakDegradation(t *testing.T) {
+	flat := func(i int) int64 { return 100 + int64(i%2)*10 }
+	none := func(i int) int { return 0 }
+	if text, degraded := soakDegradation(soakSamples(flat, none), 10*time.Minute, 20, 1); degraded {
+		t.Errorf("Flat response times reported as degraded:\n%s", text)
+	}
+
+	leak := func(i int) int64 { return 100 + int64(i)*10 }
+	text, degraded := soakDegradation(soakSamples(leak, none), 10*time.Minute, 20, 1)
+	if !degraded || !strings.Contains(text, "Average Response Time Trend: 100 ms --> 200 ms (+100.0%") {
+		t.Errorf("Increasing response times not detected:\n%s", text)
+	}
+
+	rising := func(i int) int { return i / 2 }
+	if text, degraded = soakDegradation(soakSamples(flat, rising), 10*time.Minute, 20, 1); !degraded ||
+		!strings.Contains(text, "Error Rate Trend") {
+		t.Errorf("Rising errors not detected:\n%s", text)
+	}
+
+	// Many background requests must not hide rising errors of the tests.
+	samples := soakSamples(flat, rising)
+	for i := range samples {
+		samples[i].BgN = 1000
+	}
+	if text, degraded = soakDegradation(samples, 10*time.Minute, 20, 1); !degraded ||
+		!strings.Contains(text, "Error Rate Trend: -0.18% --> 4.67%") {
+		t.Errorf("Rising errors hidden by background requests:\n%s", text)
+	}
+	samples = soakSamples(flat, none)
+	for i := range samples {
+		samples[i].BgN, samples[i].BgErr = 1000, 20*i
+	}
+	if text, degraded = soakDegradation(samples, 10*time.Minute, 20, 1); !degraded ||
+		!strings.Contains(text, "Background Error Rate Trend") ||
+		!strings.Contains(text, "Error Rate Trend: 0.00% --> 0.00%") {
+		t.Errorf("Rising background errors not detected:\n%s", text)
+	}
+
+	if _, degraded = soakDegradation(soakSamples(leak, none)[:2], 10*time.Minute, 20, 1); degraded {
+		t.Errorf("Degradation reported on two samples")
+	}
+}
@@ -0,0 +1,175 @@
+package stat
+
+import (
+	"math"
+)
+
+// Histogram records non-negative integer values (e.g. response times in
+// microseconds) in constant memory. Like a HDR histogram the buckets are
+// linear inside each power of two: Values below 128 are recorded exactly,
+// larger values with a relative error of less than 1/64 (about 1.6%).
+// Min, Max, Count and Mean are exact.
+//
+// Histograms are mergeable: The counts of two histograms can be summed
+// up (e.g. from several ramp steps of a stresstest) without loss.
+type Histogram struct {
+	Counts  []int64 // Counts[i] is the number of values recorded in bucket i
+	N       int64   // total number of recorded values
+	Sum     int64   // sum of all recorded values
+	Lowest  int64   // smallest recorded value
+	Highest int64   // largest recorded value
+}
+
+const (
+	histSubBits = 7                // 128 sub buckets ...
+	histSub     = 1 << histSubBits // ... for values below 128
+	histHalf    = histSub / 2      // and 64 sub buckets per power of two above
+)
+
+// NewHistogram returns an empty histogram.
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+// Bucket index of value v >= 0.
+func histIndex(v int64) int {
+	if v < histSub {
+		return int(v)
+	}
+	m := 0 // position of highest set bit
+	for x := v >> 1; x != 0; x >>= 1 {
+		m++
+	}
+	shift := uint(m - histSubBits + 1)
+	return histSub + (m-histSubBits)*histHalf + int(v>>shift) - histHalf
+}
+
+// Lowest and highest value (inclusive) recorded in bucket i.
+func histRange(i int) (low, high int64) {
+	if i < histSub {
+		return int64(i), int64(i)
+	}
+	i -= histSub
+	m := i/histHalf + histSubBits
+	shift := uint(m - histSubBits + 1)
+	top := int64(i%histHalf + histHalf)
+	return top << shift, (top+1)<<shift - 1
+}
+
+// Record value v. Negative values are recorded as 0.
+func (h *Histogram) Record(v int64) {
+	if v < 0 {
+		v = 0
+	}
+	i := histIndex(v)
+	if i >= len(h.Counts) {
+		counts := make([]int64, i+1, i+1+histHalf)
+		copy(counts, h.Counts)
+		h.Counts = counts
+	}
+	h.Counts[i]++
+	if h.N == 0 || v < h.Lowest {
+		h.Lowest = v
+	}
+	if h.N == 0 || v > h.Highest {
+		h.Highest = v
+	}
+	h.N++
+	h.Sum += v
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() int64 { return h.N }
+
+// Min returns the smallest recorded value (0 for an empty histogram).
+func (h *Histogram) Min() int64 { return h.Lowest }
+
+// Max returns the largest recorded value (0 for an empty histogram).
+func (h *Histogram) Max() int64 { return h.Highest }
+
+// Mean returns the average of all recorded values.
+func (h *Histogram) Mean() float64 {
+	if h.N == 0 {
+		return 0
+	}
+	return float64(h.Sum) / float64(h.N)
+}
+
+// Percentile returns the value below or equal to which p percent
+// (0 <= p <= 100) of all recorded values lie. The result is the upper end
+// of the bucket but never larger than Max (and never smaller than Min).
+func (h *Histogram) Percentile(p float64) int64 {
+	if h.N == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return h.Lowest
+	}
+	if p >= 100 {
+		return h.Highest
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.N)))
+	var seen int64
+	for i, c := range h.Counts {
+		seen += c
+		if seen >= rank {
+			_, high := histRange(i)
+			if high > h.Highest {
+				high = h.Highest
+			}
+			if high < h.Lowest {
+				high = h.Lowest
+			}
+			return high
+		}
+	}
+	return h.Highest
+}
+
+// Distribution returns the percentiles for all levels.
+func (h *Histogram) Distribution(levels []float64) (p []int64) {
+	for _, l := range levels {
+		p = append(p, h.Percentile(l))
+	}
+	return
+}
+
+// Each calls f for each non-empty bucket with a representative value
+// (the midpoint) of the bucket and the number of values in this bucket.
+func (h *Histogram) Each(f func(value, count int64)) {
+	for i, c := range h.Counts {
+		if c == 0 {
+			continue
+		}
+		low, high := histRange(i)
+		f((low+high)/2, c)
+	}
+}
+
+// Merge adds all values recorded in o to h.
+func (h *Histogram) Merge(o *Histogram) {
+	if o == nil || o.N == 0 {
+		return
+	}
+	if len(o.Counts) > len(h.Counts) {
+		counts := make([]int64, len(o.Counts))
+		copy(counts, h.Counts)
+		h.Counts = counts
+	}
+	for i, c := range o.Counts {
+		h.Counts[i] += c
+	}
+	if h.N == 0 || o.Lowest < h.Lowest {
+		h.Lowest = o.Lowest
+	}
+	if h.N == 0 || o.Highest > h.Highest {
+		h.Highest = o.Highest
+	}
+	h.N += o.N
+	h.Sum += o.Sum
+}
+
+// Reset clears all recorded values.
+func (h *Histogram) Reset() {
+	*h = Histogram{}
+}
@@ -0,0 +1,77 @@
+package stat
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	last := -1
+	for _, v := range []int64{0, 1, 127, 128, 129, 255, 256, 1000, 123456, 1 << 40, 1<<62 + 12345} {
+		i := histIndex(v)
+		low, high := histRange(i)
+		if v < low || v > high {
+			t.Errorf("Value %d in bucket %d [%d,%d]", v, i, low, high)
+		}
+		if v >= 128 && float64(high-low+1)/float64(low) > 1.0/64 {
+			t.Errorf("Bucket [%d,%d] too wide for %d", low, high, v)
+		}
+		if i < last {
+			t.Errorf("Bucket index %d of %d not increasing", i, v)
+		}
+		last = i
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	h := NewHistogram()
+	if h.Percentile(50) != 0 || h.Count() != 0 || h.Mean() != 0 {
+		t.Errorf("Bad empty histogram")
+	}
+
+	r := rand.New(rand.NewSource(1))
+	data := make([]int, 20000)
+	for i := range data {
+		data[i] = int(r.ExpFloat64() * 5000)
+		h.Record(int64(data[i]))
+	}
+	sort.Ints(data)
+	if h.Count() != int64(len(data)) || h.Min() != int64(data[0]) || h.Max() != int64(data[len(data)-1]) {
+		t.Errorf("Got count=%d min=%d max=%d", h.Count(), h.Min(), h.Max())
+	}
+	for _, p := range []float64{10, 50, 90, 99, 99.9} {
+		exact := float64(data[int(p/100*float64(len(data)))-1])
+		got := float64(h.Percentile(p))
+		if got < exact || got > exact*(1+1.0/64)+1 {
+			t.Errorf("Percentile %g: got %.0f, exact %.0f", p, got, exact)
+		}
+	}
+	if h.Percentile(100) != h.Max() {
+		t.Errorf("p100 %d != max %d", h.Percentile(100), h.Max())
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a, b, all := NewHistogram(), NewHistogram(), NewHistogram()
+	for i := int64(0); i < 1000; i++ {
+		a.Record(i * 3)
+		b.Record(100000 + i*7)
+		all.Record(i * 3)
+		all.Record(100000 + i*7)
+	}
+	a.Merge(b)
+	if a.Count() != all.Count() || a.Min() != all.Min() || a.Max() != all.Max() || a.Mean() != all.Mean() {
+		t.Errorf("Merged %+v differs from %+v", a, all)
+	}
+	for _, p := range []float64{1, 25, 50, 75, 99} {
+		if a.Percentile(p) != all.Percentile(p) {
+			t.Errorf("Percentile %g: merged %d, all %d", p, a.Percentile(p), all.Percentile(p))
+		}
+	}
+
+	a.Reset()
+	if a.Count() != 0 || a.Max() != 0 {
+		t.Errorf("Reset failed: %+v", a)
+	}
+}
@@ -8,10 +8,6 @@ package stat
 import (
 	"math"
 	"sort"
-	"strings"
-
-	"fmt"
-	"net/url"
 )
 
 // Return p percentil of pre-sorted integer data. 0 <= p <= 100.
@@ -175,75 +171,99 @@ func SixvalFloat64(data []float64, p int) (min, lq, med, avg, uq, max float64) {
 	return
 }
 
-// Generate histogram via google charts api).
-func HistogramChartUrlInt(d []int, title, label string) (url_ string) {
-	url_ = "http://chart.googleapis.com/chart?cht=bvg&chs=600x300&chxs=0,676767,11.5,0,lt,676767&chxt=x&chdlp=b"
-	url_ += "&chbh=a&chco=404040&chtt=" + url.QueryEscape(strings.Trim(title, " \t\n"))
-	url_ += "&chdl=" + url.QueryEscape(strings.Trim(label, " \t\n"))
-
-	// Decide on number of bins
-	min, _, _, _, _, max := SixvalInt(d, 25)
-	cnt := 10
-	if len(d) <= 10 {
-		cnt = 3
-	} else if len(d) <= 15 {
-		cnt = 5
-	} else if len(d) > 40 {
-		cnt = 15
-	}
-	step := float64(max-min) / float64(cnt) // inital
-
-	// make step multiple of 2, 5 or 10
-	pow := 0
-	for step > 10 {
-		pow++
-		step /= 10
-	}
-	var width int
-	switch true {
-	case step < 1.5:
-		width = 1
-	case step < 3:
-		width = 2
-	case step < 8:
-		width = 5
-	default:
-		width = 10
-	}
-	for ; pow > 0; pow-- {
-		width *= 10
-	}
-	low := (min / width) * width
-	high := (max/width + 1) * width
-	cnt = (high - low) / width
-
-	// Binify and scale largest bar to 100
-	var bin []int = make([]int, cnt)
-	mc := 0
-	for _, n := range d {
-		b := (n - low) / width
-		if b < 0 {
-			b = 0
-		} else if b >= cnt {
-			b = cnt - 1
+
+// Fit the line y = a + b*x to the points (x[i], y[i]) by least squares.
+// r2 is the coefficient of determination of the fit (1 for a perfect
+// fit, 0 if x does not explain y at all).
+func LinearRegression(x, y []float64) (a, b, r2 float64) {
+	n := len(x)
+	if n == 0 || n != len(y) {
+		return
+	}
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= float64(n)
+	my /= float64(n)
+
+	var sxx, sxy, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return my, 0, 0
+	}
+	b = sxy / sxx
+	a = my - b*mx
+	if syy > 0 {
+		r2 = sxy * sxy / (sxx * syy)
+	}
+	return
+}
+
+// Mann-Whitney U test (Wilcoxon rank-sum test) of samples x and y: u is
+// the U statistic of x (the number of pairs with x[i] > y[j], ties counted
+// as 1/2) and p the two-sided p-value of the null hypothesis that x and y
+// come from the same distribution. p is computed from the normal
+// approximation with correction for ties and continuity, so it is rough
+// for less than about 10 values per sample.
+func MannWhitneyU(x, y []float64) (u, p float64) {
+	n1, n2 := len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return 0, 1
+	}
+	type obs struct {
+		v    float64
+		inX  bool
+		rank float64
+	}
+	all := make([]obs, 0, n1+n2)
+	for _, v := range x {
+		all = append(all, obs{v: v, inX: true})
+	}
+	for _, v := range y {
+		all = append(all, obs{v: v})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// average ranks of ties
+	n := float64(n1 + n2)
+	var ties float64 // sum of t^3-t over groups of t ties
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && all[j].v == all[i].v {
+			j++
 		}
-		bin[b] = bin[b] + 1
-		if bin[b] > mc {
-			mc = bin[b]
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			all[k].rank = rank
 		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
 	}
-	for i, n := range bin {
-		bin[i] = 100 * n / mc
+	var r1 float64
+	for _, o := range all {
+		if o.inX {
+			r1 += o.rank
+		}
 	}
+	f1, f2 := float64(n1), float64(n2)
+	u = r1 - f1*(f1+1)/2
 
-	// Output data to url
-	url_ += fmt.Sprintf("&chxr=0,%d,%d", low+width/2, high-width/2)
-	url_ += "&chd=t:"
-	for i, n := range bin {
-		if i > 0 {
-			url_ += ","
-		}
-		url_ += fmt.Sprintf("%d", n)
+	mu := f1 * f2 / 2
+	sigma := math.Sqrt(f1 * f2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return u, 1
 	}
-	return
+	z := (math.Abs(u-mu) - 0.5) / sigma
+	if z < 0 {
+		z = 0
+	}
+	return u, math.Erfc(z / math.Sqrt2)
 }
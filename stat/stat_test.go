@@ -19,3 +19,35 @@ func TestFloatSixval(t *testing.T) {
 		fmt.Printf("%.3f  %.3f  %.3f  %.3f  %.3f  %.3f  \n", min, q1, med, avg, q3, max)
 	}
 }
+
+func TestLinearRegression(t *testing.T) {
+	a, b, r2 := LinearRegression([]float64{0, 1, 2, 3}, []float64{1, 3, 5, 7})
+	if a != 1 || b != 2 || r2 != 1 {
+		t.Errorf("Got a=%.3f b=%.3f r2=%.3f for y=1+2x", a, b, r2)
+	}
+	a, b, r2 = LinearRegression([]float64{1, 2, 3, 4}, []float64{5, 3, 3, 5})
+	if a != 4 || b != 0 || r2 != 0 {
+		t.Errorf("Got a=%.3f b=%.3f r2=%.3f for flat data", a, b, r2)
+	}
+	if a, b, _ = LinearRegression([]float64{2, 2}, []float64{1, 3}); a != 2 || b != 0 {
+		t.Errorf("Got a=%.3f b=%.3f for constant x", a, b)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	u, p := MannWhitneyU([]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10})
+	if u != 0 || p < 0.0121 || p > 0.0123 {
+		t.Errorf("Separated samples: got u=%.1f p=%.4f, want u=0 p=0.0122", u, p)
+	}
+	u, p = MannWhitneyU([]float64{3, 1, 2}, []float64{2, 3, 1})
+	if u != 4.5 || p != 1 {
+		t.Errorf("Equal samples: got u=%.1f p=%.4f, want u=4.5 p=1", u, p)
+	}
+	if _, p = MannWhitneyU([]float64{5, 5, 5}, []float64{5, 5}); p != 1 {
+		t.Errorf("All ties: got p=%.4f", p)
+	}
+	// interleaved samples are not significantly different
+	if _, p = MannWhitneyU([]float64{1, 3, 5, 7, 9, 11}, []float64{2, 4, 6, 8, 10, 12}); p < 0.5 {
+		t.Errorf("Interleaved samples: got p=%.4f", p)
+	}
+}
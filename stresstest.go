@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"image/color"
 	"math"
+	"net"
 	"os"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/ajstarks/svgo"
@@ -15,7 +17,63 @@ import (
 	"github.com/vdobler/webtest/suite"
 )
 
-var statLevels = []int{0, 25, 50, 67, 75, 80, 90, 95, 98, 100}
+var statLevels = []float64{0, 25, 50, 67, 75, 80, 90, 95, 98, 99, 99.9, 100}
+
+// Percentiles at statLevels in ms of response times recorded in µs in h.
+func msDistribution(h *stat.Histogram, levels []float64) (p []int) {
+	for _, us := range h.Distribution(levels) {
+		p = append(p, int((us+500)/1000))
+	}
+	return
+}
+
+// Response times in ms reconstructed from the µs histogram h e.g. for
+// plotting: Each bucket contributes its midpoint. The counts are scaled
+// down proportionally to yield roughly max samples at most.
+func histSamples(h *stat.Histogram, max int) (samples []float64) {
+	if h == nil {
+		return
+	}
+	scale := 1.0
+	if h.Count() > int64(max) {
+		scale = float64(max) / float64(h.Count())
+	}
+	h.Each(func(us, n int64) {
+		k := int(float64(n)*scale + 0.5)
+		if k == 0 {
+			k = 1
+		}
+		for ; k > 0; k-- {
+			samples = append(samples, float64(us)/1000)
+		}
+	})
+	return
+}
+
+// Coordinator of a distributed stresstest; nil if the load is generated
+// by this process only.
+var coordinator *suite.Coordinator
+
+// Address an agent listens on: Without host on the loopback interface only,
+// e.g. ":9200" becomes "127.0.0.1:9200".
+func agentListenAddr(addr string) string {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	return addr
+}
+
+// Perform one ramp step of the stresstest: On the agents of the coordinator
+// (if set up) or locally.
+func stressStep(bg, s *suite.Suite, load int, ol suite.OpenLoad, reps int, sleep int64) (result suite.StressResult, err error) {
+	if coordinator != nil {
+		return coordinator.Step(load, ol, reps, sleep)
+	}
+	if ol.Rate > 0 {
+		return s.RateStresstest(bg, ol, reps, sleep), nil
+	}
+	return s.Stresstest(bg, load, reps, sleep), nil
+}
 
 // Real stresstest: Ramp up load until "collaps".
 func stressramp(bg, s *suite.Suite, stepper suite.Stepper, name, bgname string) {
@@ -25,12 +83,28 @@ func stressramp(bg, s *suite.Suite, stepper suite.Stepper, name, bgname string)
 	var text string = "============================ Stresstest Results ==================================\n"
 	var data []suite.StressResult = make([]suite.StressResult, 0, 20)
 
+	// Open-loop mode: load is a rate of background requests per second.
+	rs, openLoop := stepper.(suite.RateStep)
+
 	// Warmup of server: Make sure chaches are hot.
-	s.Stresstest(bg, 0, 1, 10)
+	if _, err := stressStep(bg, s, 0, suite.OpenLoad{}, 1, 10); err != nil {
+		errorf("Cannot warm up: %s", err.Error())
+		return
+	}
 
-	for {
-		warnf("Stresstesting with background load of %d || requests.", load)
-		result := s.Stresstest(bg, load, rampRep, rampSleep)
+	for prev := 0; ; {
+		var ol suite.OpenLoad
+		if openLoop {
+			warnf("Stresstesting with background load of %d requests/second.", load)
+			ol = suite.OpenLoad{Rate: load, From: prev, Ramp: rs.Ramp, Concurrency: rateConc}
+		} else {
+			warnf("Stresstesting with background load of %d || requests.", load)
+		}
+		result, err := stressStep(bg, s, load, ol, rampRep, rampSleep)
+		if err != nil {
+			errorf("Aborting Stresstest: %s", err.Error())
+			break
+		}
 		data = append(data, result)
 		saveStresstestData(data, name)
 
@@ -40,13 +114,21 @@ func stressramp(bg, s *suite.Suite, stepper suite.Stepper, name, bgname string)
 		text += fmt.Sprintf("Load %3d: Response Time %5d / %5d / %5d (min/avg/max). Status %2d / %2d / %2d (err/pass/fail). %2d / %2d (tests/checks).\n              ",
 			load, result.MinRT, result.AvgRT, result.MaxRT, result.Err, result.Pass, result.Fail, result.N, result.Total)
 
-		p := stat.DistributionInt(result.RT, statLevels)
+		p := msDistribution(result.RT, statLevels)
 		for i, lev := range statLevels {
-			text += fmt.Sprintf("%d%%<%d  ", lev, p[i])
+			text += fmt.Sprintf("%g%%<%d  ", lev, p[i])
 		}
 		text += "\n"
+		if openLoop && load > 0 {
+			text += fmt.Sprintf("              Background: %d requests (%.1f/s), %d errors. Latency incl. queueing: ",
+				result.BgN, result.Rate, result.BgErr)
+			p := msDistribution(result.BgRT, []float64{50, 90, 99, 99.9, 100})
+			text += fmt.Sprintf("50%%<%d  90%%<%d  99%%<%d  99.9%%<%d  100%%<%d  ", p[0], p[1], p[2], p[3], p[4])
+			d := msDistribution(result.BgDelay, []float64{100})
+			text += fmt.Sprintf("Max Delay %d\n", d[0])
+		}
 
-		fmt.Print(stressChartUrl(data))
+		writeStressCharts(data)
 		fmt.Print(text)
 		if result.Err > 0 {
 			infof("Test Error: Aborting Stresstest.")
@@ -74,18 +156,40 @@ func stressramp(bg, s *suite.Suite, stepper suite.Stepper, name, bgname string)
 		}
 
 		lastRespTime = result.AvgRT
-		load = stepper.Next(load)
+		prev, load = load, stepper.Next(load)
 
-		if load > stopMPR {
+		if openLoop {
+			if load == prev {
+				break // constant rate done
+			}
+			if load > rateMax {
+				infof("Background Rate Too High: Aborting Stresstest.")
+				break
+			}
+		} else if load > stopMPR {
 			infof("To Many Background Request: Aborting Stresstest.")
 			break
 		}
 
 		time.Sleep(time.Duration(rampSleep) * time.Millisecond)
 	}
+	if len(data) == 0 {
+		return // first step failed: nothing to report
+	}
+
+	// Response times of all ramp steps
+	var all suite.StressResult
+	for _, d := range data {
+		all.Merge(d)
+	}
+	text += fmt.Sprintf("All Loads: %d tests. Response Time ", all.N)
+	p := msDistribution(all.RT, []float64{50, 99, 99.9, 100})
+	text += fmt.Sprintf("50%%<%d  99%%<%d  99.9%%<%d  100%%<%d\n", p[0], p[1], p[2], p[3])
 
-	fmt.Print(stressChartUrl(data))
 	fmt.Print(text)
+	for _, f := range writeStressCharts(data) {
+		warnf("Wrote stresstest chart to file %s", f)
+	}
 
 	writeStressHistograms(data, name, bgname)
 }
@@ -99,24 +203,33 @@ func saveStresstestData(data []suite.StressResult, name string) {
 		return
 	}
 	defer file.Close()
-	file.WriteString("Load,Test,RespTime\n")
+	file.WriteString("Load,Test,RespTime,Count\n")
 	for _, d := range data {
-		for name, rts := range d.Detail {
-			for _, rt := range rts {
-				fmt.Fprintf(file, "%d,%s,%d\n", d.Load, name, rt)
-			}
+		for name, h := range d.Detail {
+			h.Each(func(us, n int64) {
+				fmt.Fprintf(file, "%d,%s,%.3f,%d\n", d.Load, name, float64(us)/1000, n)
+			})
 		}
 	}
 }
 
-//  Perform stresstest.
-func stresstest(bgfilename, testfilename string) {
-	// Read background and test suite
+// Read background and test suite for stress- and soaktests. Returns nil
+// suites on errors.
+func readStressSuites(bgfilename, testfilename string) (background, testsuite *suite.Suite) {
 	background, _, berr := readSuite(bgfilename)
 	testsuite, _, serr := readSuite(testfilename)
 	if berr != nil || serr != nil {
 		errorf("Cannot parse given suites.")
-		return
+		return nil, nil
+	}
+
+	if vuData != "" {
+		data, err := suite.ReadDataFile(vuData)
+		if err != nil {
+			errorf("Cannot read virtual user data from %s: %s", vuData, err.Error())
+			return nil, nil
+		}
+		background.UserData = data
 	}
 
 	// Disable test which should not run by setting their Repeat to 0
@@ -126,60 +239,74 @@ func stresstest(bgfilename, testfilename string) {
 			testsuite.Test[i].Setting["Repeat"] = 0
 		}
 	}
-
-	// perform increasing stresstests
-	stressramp(background, testsuite, suite.ConstantStep{Start: rampStart, Step: rampStep},
-		testfilename, bgfilename)
+	return
 }
 
-// Generate Google chart for stresstest results.
-func stressChartUrl(data []suite.StressResult) (url string) {
-	url = "http://chart.googleapis.com/chart?cht=lxy&chs=500x300&chxs=0,676767,11.5,0,lt,676767&chxt=x,y,r"
-	url += "&chls=2|2|2&chco=0000FF,00FF00,FF0000&chm=s,000000,0,-1,4|s,000000,1,-1,4|s,000000,2,-1,4"
-	url += "&chdlp=b&chdl=Max+RT|Avg+RT|Err+Rate"
+//  Perform stresstest.
+func stresstest(bgfilename, testfilename string) {
+	background, testsuite := readStressSuites(bgfilename, testfilename)
+	if background == nil {
+		return
+	}
 
-	// Determine maximum load and response time and round properly
-	var mrt int64 = -1
-	var mld int = -1
-	for _, d := range data {
-		if d.MaxRT > mrt {
-			mrt = d.MaxRT
+	if agents != "" {
+		if agentSecret == "" {
+			errorf("Distributed stresstest requires a secret (-agent.secret).")
+			return
 		}
-		if d.Load > mld {
-			mld = d.Load
+		coordinator = suite.NewCoordinator(strings.Split(agents, ","), agentSecret)
+		if err := coordinator.Setup(background, testsuite); err != nil {
+			errorf("Cannot set up agents: %s", err.Error())
+			return
 		}
-	}
-	mrt = 100 * ((mrt + 99) / 100)
-	mld = 10 * ((mld + 9) / 10)
-	if mld < 10 {
-		mld = 10
+		warnf("Distributing load to %d agents.", len(coordinator.Agents))
 	}
 
-	url += fmt.Sprintf("&chxr=1,0,%d|0,0,%d", mrt, mld)
+	// perform increasing stresstests
+	var stepper suite.Stepper = suite.ConstantStep{Start: rampStart, Step: rampStep}
+	if rateStart > 0 {
+		stepper = suite.RateStep{Start: rateStart, Step: rateStep,
+			Ramp: time.Duration(rateRamp) * time.Millisecond}
+	}
+	stressramp(background, testsuite, stepper, testfilename, bgfilename)
+}
 
-	var chd string = "&chd=t:"
-	var maxd string
-	var avgd string
-	var ld string
-	var errd string
+// Write charts of response times and failure rate over load for
+// stresstest results to stresstest.{svg,png} and stresstest-failures.{svg,png}.
+func writeStressCharts(data []suite.StressResult) (files []string) {
+	var rtChart, failChart chart.ScatterChart
+	rtChart.Title = "Response Times"
+	rtChart.XRange.Label = "Background Load"
+	rtChart.YRange.Label = "Response Time [ms]"
+	rtChart.YRange.MinMode.Fixed = true
+	rtChart.YRange.MinMode.Value = 0
+	rtChart.Key.Pos = "itl"
+	failChart.Title = "Failures"
+	failChart.XRange.Label = "Background Load"
+	failChart.YRange.Label = "Failed Conditions [%]"
+	failChart.YRange.MinMode.Fixed = true
+	failChart.YRange.MinMode.Value = 0
+	failChart.Key.Hide = true
+
+	n := len(data)
+	load, maxRT, p99RT, avgRT, fail := make([]float64, n), make([]float64, n),
+		make([]float64, n), make([]float64, n), make([]float64, n)
 	for i, d := range data {
-		if i > 0 {
-			ld += ","
-			maxd += ","
-			avgd += ","
-			errd += ","
-		}
-		if d.Total == 0 {
-			d.Total = 1
+		load[i] = float64(d.Load)
+		maxRT[i] = float64(d.MaxRT)
+		avgRT[i] = float64(d.AvgRT)
+		p99RT[i] = float64(msDistribution(d.RT, []float64{99})[0])
+		if d.Total > 0 {
+			fail[i] = 100 * float64(d.Fail) / float64(d.Total)
 		}
-		ld += fmt.Sprintf("%d", int(100*d.Load/mld))
-		maxd += fmt.Sprintf("%d", int(100*d.MaxRT/mrt))
-		avgd += fmt.Sprintf("%d", int(100*d.AvgRT/mrt))
-		errd += fmt.Sprintf("%d", int(100*d.Fail/d.Total))
 	}
-	chd += ld + "|" + maxd + "|" + ld + "|" + avgd + "|" + ld + "|" + errd
+	rtChart.AddDataPair("Max RT", load, maxRT, chart.PlotStyleLinesPoints, chart.AutoStyle(0, false))
+	rtChart.AddDataPair("99% RT", load, p99RT, chart.PlotStyleLinesPoints, chart.AutoStyle(1, false))
+	rtChart.AddDataPair("Avg RT", load, avgRT, chart.PlotStyleLinesPoints, chart.AutoStyle(2, false))
+	failChart.AddDataPair("Failures", load, fail, chart.PlotStyleLinesPoints, chart.AutoStyle(3, false))
 
-	url += chd + "\n"
+	files = writeChart(&rtChart, 600, 400, "stresstest")
+	files = append(files, writeChart(&failChart, 600, 300, "stresstest-failures")...)
 	return
 }
 
@@ -223,11 +350,9 @@ func writeStressHistograms(data []suite.StressResult, name, bgname string) {
 
 	maxRT := float64(-1)
 	for i := range data {
-		for _, rt := range data[i].Detail {
-			for _, t := range rt {
-				if float64(t) > maxRT {
-					maxRT = float64(t)
-				}
+		for _, h := range data[i].Detail {
+			if t := float64(h.Max()) / 1000; t > maxRT {
+				maxRT = t
 			}
 		}
 	}
@@ -255,7 +380,7 @@ func writeStressHistograms(data []suite.StressResult, name, bgname string) {
 	thesvg.Title("Response Times")
 	thesvg.Rect(0, 0, width, height, "fill: #ffffff")
 	title := fmt.Sprintf("Distribution of response times in ms (suite: %s; bg: %s; %d samples; finished: %s)",
-		name, bgname, len(data[0].Detail[tests[0]]), now.Format("Mon 2. Jan. 2006 15:04:05"))
+		name, bgname, data[0].Detail[tests[0]].Count(), now.Format("Mon 2. Jan. 2006 15:04:05"))
 	thesvg.Text(20, svgTop/2, title, "",
 		"text-anchor: begin; font-size: 20;")
 
@@ -264,7 +389,6 @@ func writeStressHistograms(data []suite.StressResult, name, bgname string) {
 			"text-anchor: begin; font-size: 14;")
 	}
 
-	white := color.RGBA{255, 255, 255, 255}
 	for i := range data {
 		thesvg.Text(svgLeft-10, svgTop+svgHeight*i+0.5*svgHeight,
 			fmt.Sprintf("%d || Req", data[i].Load+1), "",
@@ -278,7 +402,7 @@ func writeStressHistograms(data []suite.StressResult, name, bgname string) {
 			thesvg.Gtransform(fmt.Sprintf("translate(%d %d)",
 				svgLeft+svgWidth*j, svgTop+svgHeight*i))
 			svggraphics := svgg.New(thesvg, svgWidth, svgHeight+hd, "Arial", 12, white)
-			plotHistogram(svggraphics, data[i].Detail[t], maxRT, step, showTime)
+			plotHistogram(svggraphics, histSamples(data[i].Detail[t], 1000), maxRT, step, showTime)
 			thesvg.Gend()
 		}
 	}
@@ -287,7 +411,7 @@ func writeStressHistograms(data []suite.StressResult, name, bgname string) {
 	warnf("Wrote stresstest histogram to file %s\n", filename)
 }
 
-func plotHistogram(g chart.Graphics, data []int, maxRT, step float64, showTime bool) {
+func plotHistogram(g chart.Graphics, data []float64, maxRT, step float64, showTime bool) {
 	grey := color.RGBA{100, 100, 100, 255}
 	style := chart.Style{LineColor: grey, FillColor: grey}
 	var histogram chart.HistChart
@@ -323,7 +447,7 @@ func plotHistogram(g chart.Graphics, data []int, maxRT, step float64, showTime b
 	}
 	histogram.Kernel = chart.BisquareKernel
 	histogram.BinWidth = maxRT / float64(bins)
-	histogram.AddDataInt("", data, style)
+	histogram.AddData("", data, style)
 
 	histogram.Plot(g)
 }
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/vdobler/webtest/suite"
 )
 
 func TestBeautifulX(t *testing.T) {
@@ -10,3 +15,38 @@ func TestBeautifulX(t *testing.T) {
 		t.Logf("%4.0f  -->  %d  %4.0f  %4.0f\n", m, int(max/step+1.5), step, max)
 	}
 }
+
+func TestAgentListenAddr(t *testing.T) {
+	for addr, want := range map[string]string{
+		":9200":          "127.0.0.1:9200",
+		"0.0.0.0:9200":   "0.0.0.0:9200",
+		"loadgen1:9200":  "loadgen1:9200",
+		"[::1]:9200":     "[::1]:9200",
+		"no-port-at-all": "no-port-at-all",
+	} {
+		if got := agentListenAddr(addr); got != want {
+			t.Errorf("%s: Expected %s, got %s", addr, want, got)
+		}
+	}
+}
+
+func TestStressrampFirstStepFails(t *testing.T) {
+	// An agent which survives the warmup but fails the first ramp step.
+	steps := 0
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if steps++; steps > 1 {
+			http.Error(w, "Agent broken", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "{}")
+	}))
+	defer agent.Close()
+	coordinator = suite.NewCoordinator([]string{agent.URL}, "s3cr3t")
+	defer func(level int) { coordinator, LogLevel = nil, level }(LogLevel)
+	LogLevel = 0
+
+	stressramp(nil, nil, suite.ConstantStep{Start: 5, Step: 5}, "test", "bg")
+	if steps != 2 {
+		t.Errorf("Expected warmup and one step, got %d requests", steps)
+	}
+}
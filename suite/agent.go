@@ -0,0 +1,341 @@
+package suite
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Distributed stresstests: A Coordinator ships the suites to several agents
+// and performs each ramp step on all agents simultaneously. Communication
+// is plain HTTP with JSON bodies. Every request carries the shared secret
+// of coordinator and agents in the AgentSecretHeader.
+
+// AgentSecretHeader is the header field the shared secret is sent in.
+const AgentSecretHeader = "X-Webtest-Agent-Secret"
+
+// AgentJob sets up an agent for a distributed stresstest.
+type AgentJob struct {
+	Background string            // the background suite (see Suite.String)
+	Suite      string            // the test suite (see Suite.String)
+	UserData   *DataTable        // variables of the virtual users, may be nil
+	Const      map[string]string // additional global const variables (e.g. from -D)
+	Agent      int               // number of this agent (0, 1, ...)
+	Agents     int               // total number of agents
+}
+
+// AgentStep is one ramp step of a distributed stresstest as performed on
+// one agent.
+type AgentStep struct {
+	Load      int      // number of parallel background requests (if Rate.Rate == 0)
+	Rate      OpenLoad // open-loop background load (if Rate.Rate > 0)
+	Reps      int      // number of repetitions of the test suite
+	RampSleep int64    // sleep in ms around tests
+}
+
+// Rows of data are interleaved between agents: Agent i of k uses the rows
+// i, i+k, i+2k, ... so virtual users on different agents do not share
+// their variables.
+type agentUserData struct {
+	data      UserData
+	agent, of int
+}
+
+func (d agentUserData) Vars(n int) map[string]string {
+	return d.data.Vars(n*d.of + d.agent)
+}
+
+// An Agent generates load on behalf of a Coordinator. Agent implements
+// http.Handler: POST /setup takes an AgentJob, POST /step an AgentStep and
+// answers with the StressResult of this step. Requests without the shared
+// secret are rejected. The agent runs the requests of the suites it gets
+// but neither BEFORE and AFTER commands nor LOG conditions and it does not
+// read INCLUDE or DATA files.
+type Agent struct {
+	mutex  sync.Mutex // only one step at a time
+	secret string     // shared secret of coordinator and agent
+	bg, s  *Suite
+}
+
+// NewAgent sets up an agent waiting for its job from a coordinator which
+// knows secret. An agent with an empty secret rejects all requests.
+func NewAgent(secret string) *Agent {
+	return &Agent{secret: secret}
+}
+
+// ServeHTTP handles the requests of the coordinator.
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	secret := r.Header.Get(AgentSecretHeader)
+	if a.secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(a.secret)) != 1 {
+		http.Error(w, "Wrong secret", http.StatusForbidden)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.URL.Path {
+	case "/setup":
+		var job AgentJob
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			http.Error(w, "Bad job: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := a.setup(job); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "ok\n")
+	case "/step":
+		var step AgentStep
+		if err := json.NewDecoder(r.Body).Decode(&step); err != nil {
+			http.Error(w, "Bad step: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		if a.s == nil {
+			http.Error(w, "Agent not set up", http.StatusConflict)
+			return
+		}
+		var result StressResult
+		if step.Rate.Rate > 0 {
+			result = a.s.RateStresstest(a.bg, step.Rate, step.Reps, step.RampSleep)
+		} else {
+			result = a.s.Stresstest(a.bg, step.Load, step.Reps, step.RampSleep)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Parse the suites of job and make them the current ones. The constants
+// of the job are added to the tests of the suites.
+func (a *Agent) setup(job AgentJob) error {
+	parse := func(text, name string) (*Suite, error) {
+		p := NewParser(strings.NewReader(text), name)
+		p.NoFiles = true
+		s, err := p.ReadSuite()
+		if err != nil {
+			return nil, fmt.Errorf("Cannot parse %s: %s", name, err.Error())
+		}
+		if err = agentAllowed(s); err != nil {
+			return nil, fmt.Errorf("Refusing %s: %s", name, err.Error())
+		}
+		addConst(s, job.Const)
+		return s, nil
+	}
+	bg, err := parse(job.Background, "background suite")
+	if err != nil {
+		return err
+	}
+	s, err := parse(job.Suite, "test suite")
+	if err != nil {
+		return err
+	}
+	if job.UserData != nil {
+		bg.UserData = agentUserData{data: job.UserData, agent: job.Agent, of: job.Agents}
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.bg, a.s = bg, s
+	infof("Agent %d of %d: Got %d background tests and %d tests.", job.Agent+1, job.Agents,
+		len(bg.Test), len(s.Test))
+	return nil
+}
+
+// The tests (incl. Global and the steps) of s.
+func allTests(s *Suite) (tests []*Test) {
+	var add func(t *Test)
+	add = func(t *Test) {
+		tests = append(tests, t)
+		for i := range t.Steps {
+			add(&t.Steps[i])
+		}
+	}
+	if s.Global != nil {
+		add(s.Global)
+	}
+	for i := range s.Test {
+		add(&s.Test[i])
+	}
+	return
+}
+
+// Check that s does not execute commands, read or write files on the agent.
+func agentAllowed(s *Suite) error {
+	for _, t := range allTests(s) {
+		switch {
+		case len(t.Before) > 0:
+			return fmt.Errorf("BEFORE in test '%s' not allowed on agent", t.Title)
+		case len(t.After) > 0:
+			return fmt.Errorf("AFTER in test '%s' not allowed on agent", t.Title)
+		case len(t.Log) > 0:
+			return fmt.Errorf("LOG in test '%s' not allowed on agent", t.Title)
+		case t.Snapshot != nil:
+			return fmt.Errorf("SNAPSHOT in test '%s' not allowed on agent", t.Title)
+		case strings.HasPrefix(t.SendBody, "@file:"):
+			return fmt.Errorf("SEND-BODY from file in test '%s' not allowed on agent", t.Title)
+		case t.Setting["Dump"] != 0:
+			return fmt.Errorf("Dump setting in test '%s' not allowed on agent", t.Title)
+		}
+		for name, values := range t.Param {
+			for _, v := range values {
+				if strings.HasPrefix(v, "@file:") {
+					return fmt.Errorf("File upload in parameter %s of test '%s' not allowed on agent", name, t.Title)
+				}
+			}
+		}
+		for _, c := range t.ImageCond {
+			// PHash:<file> and Diff:<file> read reference images.
+			if strings.Contains(c.Key, ":") {
+				return fmt.Errorf("IMAGE condition %s in test '%s' not allowed on agent", c.Key, t.Title)
+			}
+		}
+	}
+	return nil
+}
+
+// Add the constants c to all tests of s. Like -D they override the CONST
+// sections of the tests.
+func addConst(s *Suite, c map[string]string) {
+	for _, t := range allTests(s) {
+		if t.Const == nil {
+			t.Const = make(map[string]string, len(c))
+		}
+		for k, v := range c {
+			t.Const[k] = v
+		}
+	}
+}
+
+// A Coordinator distributes a stresstest over several agents.
+type Coordinator struct {
+	Agents []string     // base URLs of the agents, e.g. "http://loadgen1:9200"
+	Client *http.Client // the client used to talk to the agents
+	Secret string       // shared secret of coordinator and agents
+}
+
+// NewCoordinator sets up a coordinator for the given agents ("host:port"
+// or URLs) which were started with secret.
+func NewCoordinator(agents []string, secret string) *Coordinator {
+	c := &Coordinator{Client: &http.Client{}, Secret: secret}
+	for _, agent := range agents {
+		if !strings.HasPrefix(agent, "http://") && !strings.HasPrefix(agent, "https://") {
+			agent = "http://" + agent
+		}
+		c.Agents = append(c.Agents, strings.TrimRight(agent, "/"))
+	}
+	return c
+}
+
+// POST in as JSON to path on agent i and decode the answer into out (if
+// non nil).
+func (c *Coordinator) post(i int, path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", c.Agents[i]+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(AgentSecretHeader, c.Secret)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Agent %s: %s: %s", c.Agents[i], resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// Perform f(i) for all agents in parallel and return the first error.
+func (c *Coordinator) each(f func(i int) error) error {
+	errs := make([]error, len(c.Agents))
+	var wg sync.WaitGroup
+	for i := range c.Agents {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = f(i)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Setup ships the background suite bg and the test suite s to all agents.
+// Only a DataTable is shipped as UserData of bg.
+func (c *Coordinator) Setup(bg, s *Suite) error {
+	job := AgentJob{Background: bg.String(), Suite: s.String(), Const: Const, Agents: len(c.Agents)}
+	if data, ok := bg.UserData.(*DataTable); ok {
+		job.UserData = data
+	}
+	return c.each(func(i int) error {
+		j := job
+		j.Agent = i
+		return c.post(i, "/setup", j, nil)
+	})
+}
+
+// Share of agent i of k of total.
+func share(total, i, k int) int {
+	n := total / k
+	if i < total%k {
+		n++
+	}
+	return n
+}
+
+// Step performs one ramp step on all agents at the same time: The load
+// (parallel background requests or rate) is split evenly between the
+// agents, each agent performs reps runs of the test suite. The results of
+// all agents are merged.
+func (c *Coordinator) Step(load int, rate OpenLoad, reps int, rampSleep int64) (result StressResult, err error) {
+	k := len(c.Agents)
+	results := make([]StressResult, k)
+	err = c.each(func(i int) error {
+		step := AgentStep{Load: share(load, i, k), Reps: reps, RampSleep: rampSleep}
+		if rate.Rate > 0 {
+			step.Rate = OpenLoad{Rate: share(rate.Rate, i, k), From: share(rate.From, i, k), Ramp: rate.Ramp}
+			if rate.Concurrency > 0 {
+				step.Rate.Concurrency = (rate.Concurrency + k - 1) / k
+			}
+		}
+		return c.post(i, "/step", step, &results[i])
+	})
+	if err != nil {
+		return
+	}
+	for _, r := range results {
+		result.Merge(r)
+		result.Rate += r.Rate
+	}
+	result.Load = load
+	if rate.Rate > 0 {
+		result.Load = rate.Rate
+	}
+	debugf("Load %d on %d agents: %d tests, %d background requests.", result.Load, k, result.N, result.BgN)
+	return
+}
@@ -0,0 +1,167 @@
+package suite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDistributedStresstest(t *testing.T) {
+	var mu sync.Mutex
+	users := make(map[string]bool)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bg" && r.URL.Path != "/fg" {
+			http.NotFound(w, r)
+		}
+		if u := r.FormValue("user"); u != "" {
+			mu.Lock()
+			users[u] = true
+			mu.Unlock()
+		}
+	}))
+	defer target.Close()
+
+	var agents []string
+	for i := 0; i < 3; i++ {
+		agent := httptest.NewServer(NewAgent("s3cr3t"))
+		defer agent.Close()
+		agents = append(agents, strings.TrimPrefix(agent.URL, "http://"))
+	}
+
+	parse := func(st string) *Suite {
+		p := NewParser(strings.NewReader(strings.Replace(st, "${URL}", target.URL, -1)), "agent.wt")
+		s, err := p.ReadSuite()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		return s
+	}
+	bg := parse("----------\nBG\n----------\nGET ${URL}/bg?user=${user}\n")
+	bg.UserData, _ = ReadCSVData(strings.NewReader("user\na\nb\nc\nd\ne\nf\n"))
+	s := parse(`
+----------
+Global
+----------
+GET x
+CONST
+	path  :=  fg
+
+----------
+Foreground
+----------
+GET ${URL}/${path}
+RESPONSE
+	Status-Code == 200
+`)
+
+	c := NewCoordinator(agents, "s3cr3t")
+	if err := c.Setup(bg, s); err != nil {
+		t.Fatalf("Cannot set up agents: %s", err.Error())
+	}
+	result, err := c.Step(6, OpenLoad{}, 2, 10)
+	if err != nil {
+		t.Fatalf("Step failed: %s", err.Error())
+	}
+	if result.Load != 6 || result.N != 6 || result.Pass != 6 || result.Err != 0 {
+		t.Errorf("Bad merged result: load %d, %d tests, %d passed, %d errored",
+			result.Load, result.N, result.Pass, result.Err)
+	}
+	if result.RT.Count() != 6 || result.Detail["Foreground"].Count() != 6 {
+		t.Errorf("Bad merged histograms")
+	}
+	mu.Lock()
+	if len(users) != 6 {
+		t.Errorf("Virtual users on different agents share data: %v", users)
+	}
+	mu.Unlock()
+
+	result, err = c.Step(0, OpenLoad{Rate: 60}, 1, 100)
+	if err != nil {
+		t.Fatalf("Rate step failed: %s", err.Error())
+	}
+	if result.Load != 60 || result.N != 3 || result.BgN == 0 || result.BgRT.Count() != int64(result.BgN) {
+		t.Errorf("Bad merged open-loop result: load %d, %d tests, %d background requests",
+			result.Load, result.N, result.BgN)
+	}
+
+	if _, err = NewCoordinator([]string{agents[0], "localhost:1"}, "s3cr3t").Step(2, OpenLoad{}, 1, 0); err == nil {
+		t.Errorf("Missing error for unreachable agent")
+	}
+}
+
+func TestAgentRefusals(t *testing.T) {
+	agent := httptest.NewServer(NewAgent("s3cr3t"))
+	defer agent.Close()
+	addr := strings.TrimPrefix(agent.URL, "http://")
+	suite := func(st string) *Suite {
+		s, err := NewParser(strings.NewReader(st), "agent.wt").ReadSuite()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		return s
+	}
+	bg := suite("----------\nBG\n----------\nGET http://localhost/\n")
+
+	for _, secret := range []string{"", "wrong"} {
+		err := NewCoordinator([]string{addr}, secret).Setup(bg, bg)
+		if err == nil || !strings.Contains(err.Error(), "403") {
+			t.Errorf("Secret %q: Expected 403, got %v", secret, err)
+		}
+	}
+	if err := NewCoordinator([]string{addr}, "s3cr3t").Setup(bg, bg); err != nil {
+		t.Errorf("Unexpected error: %s", err.Error())
+	}
+
+	for _, section := range []string{
+		"GET http://localhost/\nBEFORE\n\ttouch x",
+		"GET http://localhost/\nAFTER\n\ttouch x",
+		"GET http://localhost/\nLOG\n\t/etc/passwd  ~=  root",
+		"GET http://localhost/\nSNAPSHOT\n\tFile  :=  /etc/passwd",
+		"GET http://localhost/\nIMAGE\n\tPHash:/etc/passwd  <=  4",
+		"GET http://localhost/\nSETTING\n\tDump  :=  1",
+		"POST http://localhost/\nPARAM\n\tf  :=  @file:/etc/passwd",
+		"PUT http://localhost/\nSEND-BODY\n\t@file:/etc/passwd",
+	} {
+		s := suite("----------\nT\n----------\n" + section + "\n")
+		err := NewCoordinator([]string{addr}, "s3cr3t").Setup(bg, s)
+		if err == nil || !strings.Contains(err.Error(), "not allowed on agent") {
+			t.Errorf("%s: Expected refusal, got %v", strings.Fields(section)[2], err)
+		}
+	}
+
+	a := NewAgent("s3cr3t")
+	for _, text := range []string{"INCLUDE common.wt\n", "----------\nT\n----------\nGET http://localhost/\nDATA\n\tFile := users.csv\n"} {
+		if err := a.setup(AgentJob{Background: text, Suite: text}); err == nil ||
+			!strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("%q: Expected refusal, got %v", text, err)
+		}
+	}
+
+	job := AgentJob{Background: bg.String(), Suite: bg.String(), Const: map[string]string{"agentHost": "h1"}}
+	if err := a.setup(job); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if _, ok := Const["agentHost"]; ok {
+		t.Errorf("Constants of job leaked into global Const")
+	}
+	if v := a.s.Test[0].Const["agentHost"]; v != "h1" {
+		t.Errorf("Expected constant h1 in test, got %q", v)
+	}
+}
+
+func TestShare(t *testing.T) {
+	for _, tc := range []struct{ total, k, want0, want2 int }{
+		{10, 3, 4, 3}, {2, 3, 1, 0}, {0, 2, 0, 0}, {9, 3, 3, 3},
+	} {
+		sum := 0
+		for i := 0; i < tc.k; i++ {
+			sum += share(tc.total, i, tc.k)
+		}
+		if sum != tc.total || share(tc.total, 0, tc.k) != tc.want0 ||
+			(tc.k > 2 && share(tc.total, 2, tc.k) != tc.want2) {
+			t.Errorf("Bad shares of %d for %d agents", tc.total, tc.k)
+		}
+	}
+}
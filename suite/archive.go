@@ -0,0 +1,200 @@
+package suite
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// A single file in an archive.
+type archiveEntry struct {
+	Name string
+	Data []byte
+}
+
+// Check for gzip magic bytes.
+func isGzip(body []byte) bool {
+	return len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b
+}
+
+// Check for zip magic bytes (local file header or empty archive).
+func isZip(body []byte) bool {
+	return bytes.HasPrefix(body, []byte("PK\x03\x04")) || bytes.HasPrefix(body, []byte("PK\x05\x06"))
+}
+
+// Check for the ustar magic of tar files.
+func isTar(body []byte) bool {
+	return len(body) > 262 && string(body[257:262]) == "ustar"
+}
+
+// Read all entries of the zip, tar, tar.gz or gzip archive body. The
+// format is determined by the magic bytes: A gzip file which does not
+// contain a tar archive is considered an archive with one entry.
+func readArchive(body []byte) (format string, entries []archiveEntry, err error) {
+	if isGzip(body) {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(body)); err != nil {
+			return
+		}
+		name := zr.Name
+		if body, err = ioutil.ReadAll(zr); err != nil {
+			return
+		}
+		if !isTar(body) {
+			if name == "" {
+				name = "-"
+			}
+			return "gzip", []archiveEntry{{name, body}}, nil
+		}
+		format = "tar.gz"
+	}
+
+	switch {
+	case isZip(body):
+		format = "zip"
+		var zr *zip.Reader
+		if zr, err = zip.NewReader(bytes.NewReader(body), int64(len(body))); err != nil {
+			return
+		}
+		for _, f := range zr.File {
+			if strings.HasSuffix(f.Name, "/") {
+				continue // directory
+			}
+			var rc io.ReadCloser
+			if rc, err = f.Open(); err != nil {
+				return
+			}
+			data, e := ioutil.ReadAll(rc)
+			rc.Close()
+			if e != nil {
+				return format, entries, e
+			}
+			entries = append(entries, archiveEntry{f.Name, data})
+		}
+	case isTar(body):
+		if format == "" {
+			format = "tar"
+		}
+		tr := tar.NewReader(bytes.NewReader(body))
+		for {
+			hdr, e := tr.Next()
+			if e == io.EOF {
+				break
+			}
+			if e != nil {
+				return format, entries, e
+			}
+			if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+				continue
+			}
+			data, e := ioutil.ReadAll(tr)
+			if e != nil {
+				return format, entries, e
+			}
+			entries = append(entries, archiveEntry{hdr.Name, data})
+		}
+	default:
+		err = errors.New("Unknown archive format")
+	}
+	return
+}
+
+// Decode body according to the Content-Encoding enc. Unknown encodings
+// and undecodable bodies are returned unchanged.
+func decodeContent(body []byte, enc string) []byte {
+	enc = strings.ToLower(strings.TrimSpace(enc))
+	if enc != "gzip" && enc != "x-gzip" {
+		return body
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		warnf("Cannot decode gzip body: %s", err.Error())
+		return body
+	}
+	dec, err := ioutil.ReadAll(zr)
+	if err != nil {
+		warnf("Cannot decode gzip body: %s", err.Error())
+		return body
+	}
+	tracef("Decoded gzip body from %d to %d bytes.", len(body), len(dec))
+	return dec
+}
+
+// Check if key is a valid key in the ARCHIVE section.
+func validArchiveKey(key string) bool {
+	return key == "Entries" || key == "Count" || (hp(key, "Entry:") && len(key) > 6)
+}
+
+// Perform the archive checks on body.
+func testArchive(body []byte, t, orig *Test) {
+	if len(t.ArchiveCond) > 0 {
+		debugf("Testing Archive")
+	} else {
+		return
+	}
+
+	format, entries, err := readArchive(body)
+	if err != nil {
+		orig.Error("Archive", "Unreadable archive", err.Error())
+		return
+	}
+	tracef("Read %s archive with %d entries.", format, len(entries))
+
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name
+	}
+
+	for _, c := range t.ArchiveCond {
+		cs := c.Info("archive")
+		var v string
+		switch {
+		case c.Key == "Entries":
+			v = strings.Join(names, "\n")
+		case c.Key == "Count":
+			v = strconv.Itoa(len(entries))
+		case hp(c.Key, "Entry:"):
+			name, found := c.Key[6:], false
+			for _, e := range entries {
+				if e.Name == name {
+					v, found = string(e.Data), true
+					break
+				}
+			}
+			if c.Op == "." {
+				if found != c.Neg {
+					orig.Passed(cs)
+				} else {
+					orig.Failed(c.Id, "Archive Failed",
+						fmt.Sprintf("%s\nTesting for %s\nEntries: %s", c.Id, c.String(),
+							strings.Join(names, ", ")))
+				}
+				continue
+			}
+			if !found {
+				orig.Failed(c.Id, "Archive Failed",
+					fmt.Sprintf("%s\nTesting for %s\nBut no such entry. Entries: %s",
+						c.Id, c.String(), strings.Join(names, ", ")))
+				continue
+			}
+		default:
+			errorf("Unkown archive condition '%s' (%s). Ignored.", c.Key, c.Id)
+			continue
+		}
+
+		if ok, was := c.Fullfilled(v); ok {
+			orig.Passed(cs)
+		} else {
+			orig.Failed(c.Id, "Archive Failed",
+				fmt.Sprintf("%s\nTesting for %s\nBut got: %s%s", c.Id, c.String(), was,
+					c.Diff(v)))
+		}
+	}
+}
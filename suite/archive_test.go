@@ -0,0 +1,128 @@
+package suite
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+var archiveFiles = []archiveEntry{
+	{"report.csv", []byte("id,value\n1,42\n")},
+	{"doc/readme.txt", []byte("Hello World\n")},
+}
+
+func makeZip(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, f := range archiveFiles {
+		w, err := zw.Create(f.Name)
+		if err != nil {
+			t.Fatalf("Cannot create zip entry: %s", err.Error())
+		}
+		w.Write(f.Data)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func makeTarGz(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, f := range archiveFiles {
+		hdr := &tar.Header{Name: f.Name, Mode: 0644, Size: int64(len(f.Data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Cannot write tar header: %s", err.Error())
+		}
+		tw.Write(f.Data)
+	}
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
+
+func gzipped(data []byte) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	gw.Name = "data.txt"
+	gw.Write(data)
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestReadArchive(t *testing.T) {
+	for _, c := range []struct {
+		format string
+		body   []byte
+		n      int
+	}{
+		{"zip", makeZip(t), 2},
+		{"tar.gz", makeTarGz(t), 2},
+		{"gzip", gzipped([]byte("plain")), 1},
+	} {
+		format, entries, err := readArchive(c.body)
+		if err != nil {
+			t.Errorf("%s: Unexpected error %s", c.format, err.Error())
+			continue
+		}
+		if format != c.format || len(entries) != c.n {
+			t.Errorf("Expected %s with %d entries, got %s with %d", c.format, c.n, format, len(entries))
+		}
+	}
+	if _, _, err := readArchive([]byte("no archive")); err == nil {
+		t.Errorf("Missing error on non-archive")
+	}
+}
+
+func TestDecodeContent(t *testing.T) {
+	if d := decodeContent(gzipped([]byte("Hello")), "gzip"); string(d) != "Hello" {
+		t.Errorf("Got %q", d)
+	}
+	if d := decodeContent([]byte("Hello"), ""); string(d) != "Hello" {
+		t.Errorf("Got %q", d)
+	}
+}
+
+func TestArchiveConditions(t *testing.T) {
+	st := `
+----------------
+Archive
+----------------
+GET http://localhost/export.zip
+ARCHIVE
+	Count              ==  2
+	Entries            ~=  doc/readme.txt
+	Entry:report.csv   _=  id,value
+	Entry:report.csv   ~=  "1,42"
+	Entry:doc/readme.txt
+	!Entry:secret.txt
+	Entry:report.csv   ~=  "2,17"
+	Entry:missing.txt  ~=  x
+`
+	p := NewParser(strings.NewReader(st), "archive.wt")
+	s, err := p.ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	test := &s.Test[0]
+
+	for _, body := range [][]byte{makeZip(t), makeTarGz(t)} {
+		test.Result = nil
+		testArchive(body, test, test)
+		if len(test.Result) != 8 {
+			t.Fatalf("Expected 8 results, got %d", len(test.Result))
+		}
+		for i, r := range test.Result {
+			exp := TestPassed
+			if i >= 6 {
+				exp = TestFailed
+			}
+			if r.Status != exp {
+				t.Errorf("Condition %d: expected %s, got %s: %s", i, exp, r.Status, r.Message)
+			}
+		}
+	}
+}
@@ -0,0 +1,495 @@
+package suite
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authentication of requests as described in the AUTH section of a test.
+// The Type selects the scheme, the other keys are its parameters:
+//   basic   User, Password
+//   digest  User, Password (challenge/response round-trip on 401)
+//   bearer  Token
+//   oauth2  Token-Url, Client-Id, Client-Secret, Grant (client_credentials
+//           or password), User and Password (password grant), Scope
+//   sigv4   Access-Key, Secret-Key, Region, Service, Session-Token
+// OAuth2 tokens are cached and fetched again once expired.
+
+// Required and optional keys of the authentication types.
+var authKeys = map[string]struct{ required, optional []string }{
+	"basic":  {[]string{"User", "Password"}, nil},
+	"digest": {[]string{"User", "Password"}, nil},
+	"bearer": {[]string{"Token"}, nil},
+	"oauth2": {[]string{"Token-Url", "Client-Id"},
+		[]string{"Client-Secret", "Grant", "User", "Password", "Scope"}},
+	"sigv4": {[]string{"Access-Key", "Secret-Key", "Region", "Service"}, []string{"Session-Token"}},
+}
+
+// Check auth for unknown types and missing or unknown keys.
+func checkAuth(auth map[string]string) error {
+	typ := strings.ToLower(auth["Type"])
+	keys, ok := authKeys[typ]
+	if !ok {
+		return fmt.Errorf("Unknown authentication type '%s'", auth["Type"])
+	}
+	for _, k := range keys.required {
+		if _, ok := auth[k]; !ok {
+			return fmt.Errorf("Missing %s for %s authentication", k, typ)
+		}
+	}
+	valid := append([]string{"Type"}, append(keys.required, keys.optional...)...)
+outer:
+	for k := range auth {
+		for _, v := range valid {
+			if k == v {
+				continue outer
+			}
+		}
+		return fmt.Errorf("Unknown key '%s' for %s authentication", k, typ)
+	}
+	if typ == "oauth2" {
+		switch auth["Grant"] {
+		case "", "client_credentials":
+		case "password":
+			if auth["User"] == "" {
+				return fmt.Errorf("Missing User for oauth2 password grant")
+			}
+		default:
+			return fmt.Errorf("Unknown oauth2 grant '%s'", auth["Grant"])
+		}
+	}
+	return nil
+}
+
+// Time used for signing and token expiry.
+var authNow = time.Now
+
+// Client used to fetch OAuth2 tokens.
+var tokenClient = &http.Client{Timeout: 30 * time.Second}
+
+// Add authentication according to auth to req.
+func authorize(req *http.Request, auth map[string]string) error {
+	if len(auth) == 0 {
+		return nil
+	}
+	switch strings.ToLower(auth["Type"]) {
+	case "basic":
+		req.SetBasicAuth(auth["User"], auth["Password"])
+	case "digest":
+		if c := digestCache.get(req.URL.Host, auth["User"]); c != nil {
+			req.Header.Set("Authorization", c.authorization(req, auth["User"], auth["Password"]))
+		}
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+auth["Token"])
+	case "oauth2":
+		token, err := oauth2Token(auth)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case "sigv4":
+		return signV4(req, auth, authNow())
+	}
+	return nil
+}
+
+// Authentication of a redirect from the initial request ireq to req: Like
+// net/http the credentials are sent only to the host of ireq and its
+// subdomains.
+func redirectAuth(ireq, req *http.Request, auth map[string]string) map[string]string {
+	ih, h := strings.ToLower(ireq.URL.Hostname()), strings.ToLower(req.URL.Hostname())
+	if h == ih || strings.HasSuffix(h, "."+ih) {
+		return auth
+	}
+	return nil
+}
+
+// Perform req of test t authorized according to auth: A digest challenge
+// is answered by repeating the request once.
+func doAuthorized(req *http.Request, t *Test, auth map[string]string) (r *http.Response, err error) {
+	if err = authorize(req, auth); err != nil {
+		return
+	}
+	dumpReq(req, t.Dump)
+	r, err = send(req)
+	if err != nil || r.StatusCode != http.StatusUnauthorized || strings.ToLower(auth["Type"]) != "digest" {
+		return
+	}
+	c := parseDigestChallenge(r.Header.Get("WWW-Authenticate"))
+	if c == nil {
+		return
+	}
+	if req.Body != nil {
+		if req.GetBody == nil {
+			return
+		}
+		body, e := req.GetBody()
+		if e != nil {
+			return
+		}
+		req.Body = body
+	}
+	dumpRes(r, t.Dump)
+	readBody(r.Body)
+	debugf("Answering digest challenge of realm %q", c.realm)
+	digestCache.put(req.URL.Host, auth["User"], c)
+	req.Header.Set("Authorization", c.authorization(req, auth["User"], auth["Password"]))
+	dumpReq(req, t.Dump)
+	return send(req)
+}
+
+// ---------------------------------------------------------------------------
+// Digest
+
+// A digest challenge from a WWW-Authenticate header.
+type digestChallenge struct {
+	realm, nonce, opaque, algorithm, qop string
+
+	mutex sync.Mutex
+	nc    int // nonce count
+}
+
+// Challenges by host and user so later requests need no round-trip.
+type digestChallenges struct {
+	sync.Mutex
+	m map[string]*digestChallenge
+}
+
+var digestCache = digestChallenges{m: make(map[string]*digestChallenge)}
+
+func (dc *digestChallenges) get(host, user string) *digestChallenge {
+	dc.Lock()
+	defer dc.Unlock()
+	return dc.m[host+"\x00"+user]
+}
+
+func (dc *digestChallenges) put(host, user string, c *digestChallenge) {
+	dc.Lock()
+	defer dc.Unlock()
+	dc.m[host+"\x00"+user] = c
+}
+
+// Parse comma separated key=value pairs (values possibly quoted).
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		i := strings.Index(s, "=")
+		if i == -1 {
+			return params
+		}
+		key := strings.ToLower(trim(s[:i]))
+		s = trim(s[i+1:])
+		var val string
+		if hp(s, "\"") {
+			j := 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				val, s = s[1:], ""
+			} else {
+				val, s = s[1:j], s[j+1:]
+			}
+			val = strings.Replace(val, "\\", "", -1)
+		} else {
+			j := strings.Index(s, ",")
+			if j == -1 {
+				j = len(s)
+			}
+			val, s = trim(s[:j]), s[j:]
+		}
+		params[key] = val
+	}
+}
+
+// Parse the Digest challenge in the WWW-Authenticate header h. Returns nil
+// if h contains no usable digest challenge.
+func parseDigestChallenge(h string) *digestChallenge {
+	if !hp(strings.ToLower(h), "digest ") {
+		return nil
+	}
+	p := parseAuthParams(h[len("digest "):])
+	if p["nonce"] == "" {
+		return nil
+	}
+	c := &digestChallenge{realm: p["realm"], nonce: p["nonce"], opaque: p["opaque"], algorithm: p["algorithm"]}
+	for _, q := range strings.Split(p["qop"], ",") {
+		if trim(q) == "auth" {
+			c.qop = "auth"
+		}
+	}
+	return c
+}
+
+// Random hex string of n bytes.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Authorization header answering c for req.
+func (c *digestChallenge) authorization(req *http.Request, user, password string) string {
+	c.mutex.Lock()
+	c.nc++
+	nc := fmt.Sprintf("%08x", c.nc)
+	c.mutex.Unlock()
+	return c.header(req.Method, req.URL.RequestURI(), user, password, nc, randomHex(8))
+}
+
+// Authorization header answering c for a request to uri (RFC 2617 and
+// RFC 7616 for SHA-256).
+func (c *digestChallenge) header(method, uri, user, password, nc, cnonce string) string {
+	var newHash func() hash.Hash = md5.New
+	alg := strings.ToUpper(c.algorithm)
+	if hp(alg, "SHA-256") {
+		newHash = sha256.New
+	}
+	H := func(s string) string {
+		h := newHash()
+		io.WriteString(h, s)
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	ha1 := H(user + ":" + c.realm + ":" + password)
+	if hs(alg, "-SESS") {
+		ha1 = H(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := H(method + ":" + uri)
+	var response string
+	if c.qop != "" {
+		response = H(strings.Join([]string{ha1, c.nonce, nc, cnonce, c.qop, ha2}, ":"))
+	} else {
+		response = H(ha1 + ":" + c.nonce + ":" + ha2)
+	}
+
+	s := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		escapeQuotes(user), escapeQuotes(c.realm), c.nonce, uri, response)
+	if c.algorithm != "" {
+		s += ", algorithm=" + c.algorithm
+	}
+	if c.opaque != "" {
+		s += fmt.Sprintf(`, opaque="%s"`, c.opaque)
+	}
+	if c.qop != "" {
+		s += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, c.qop, nc, cnonce)
+	}
+	return s
+}
+
+// ---------------------------------------------------------------------------
+// OAuth2
+
+// A cached OAuth2 access token.
+type oauth2Entry struct {
+	token, refresh string
+	expires        time.Time
+}
+
+var tokenCache = struct {
+	sync.Mutex
+	m map[string]*oauth2Entry
+}{m: make(map[string]*oauth2Entry)}
+
+// An access token for auth: Cached tokens are used until they expire, then
+// they are refreshed (if a refresh token was issued) or fetched again.
+func oauth2Token(auth map[string]string) (string, error) {
+	key := strings.Join([]string{auth["Token-Url"], auth["Grant"], auth["Client-Id"],
+		auth["User"], auth["Scope"]}, "\x00")
+	tokenCache.Lock()
+	defer tokenCache.Unlock()
+
+	e := tokenCache.m[key]
+	if e != nil && authNow().Before(e.expires) {
+		return e.token, nil
+	}
+	if e != nil && e.refresh != "" {
+		form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {e.refresh}}
+		if ne, err := fetchToken(auth, form); err == nil {
+			tokenCache.m[key] = ne
+			return ne.token, nil
+		} else {
+			debugf("Cannot refresh oauth2 token: %s", err.Error())
+		}
+	}
+
+	grant := auth["Grant"]
+	if grant == "" {
+		grant = "client_credentials"
+	}
+	form := url.Values{"grant_type": {grant}}
+	if grant == "password" {
+		form.Set("username", auth["User"])
+		form.Set("password", auth["Password"])
+	}
+	if auth["Scope"] != "" {
+		form.Set("scope", auth["Scope"])
+	}
+	ne, err := fetchToken(auth, form)
+	if err != nil {
+		return "", err
+	}
+	tokenCache.m[key] = ne
+	return ne.token, nil
+}
+
+// Request a token with the parameters form from the token endpoint of auth.
+func fetchToken(auth map[string]string, form url.Values) (*oauth2Entry, error) {
+	req, err := http.NewRequest("POST", auth["Token-Url"], strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(auth["Client-Id"], auth["Client-Secret"])
+	resp, err := tokenClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot fetch oauth2 token: %s", err.Error())
+	}
+	body := readBody(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Cannot fetch oauth2 token from %s: %s: %s", auth["Token-Url"],
+			resp.Status, strings.TrimSpace(string(body)))
+	}
+	var tr struct {
+		AccessToken  string `json:"access_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err = json.Unmarshal(body, &tr); err != nil || tr.AccessToken == "" {
+		return nil, fmt.Errorf("Bad oauth2 token response from %s: %s", auth["Token-Url"], string(body))
+	}
+	lifetime := time.Hour // if the server does not tell
+	if tr.ExpiresIn > 0 {
+		lifetime = time.Duration(tr.ExpiresIn) * time.Second
+		margin := lifetime / 10 // refresh a bit early
+		if margin > 10*time.Second {
+			margin = 10 * time.Second
+		}
+		lifetime -= margin
+	}
+	infof("Fetched oauth2 token from %s (%s grant).", auth["Token-Url"], form.Get("grant_type"))
+	return &oauth2Entry{token: tr.AccessToken, refresh: tr.RefreshToken, expires: authNow().Add(lifetime)}, nil
+}
+
+// ---------------------------------------------------------------------------
+// AWS Signature Version 4
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	io.WriteString(mac, data)
+	return mac.Sum(nil)
+}
+
+// The body of req, which is left readable.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return ioutil.ReadAll(body)
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(strings.NewReader(string(b)))
+	return b, err
+}
+
+// Escaping of URI components as required by AWS.
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// Sign req with AWS Signature Version 4 for the time now.
+func signV4(req *http.Request, auth map[string]string, now time.Time) error {
+	body, err := requestBody(req)
+	if err != nil {
+		return err
+	}
+	now = now.UTC()
+	amzDate, date := now.Format("20060102T150405Z"), now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if tok := auth["Session-Token"]; tok != "" {
+		req.Header.Set("X-Amz-Security-Token", tok)
+	}
+	if auth["Service"] == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for _, h := range []string{"Content-Type", "X-Amz-Date", "X-Amz-Security-Token", "X-Amz-Content-Sha256"} {
+		if v := req.Header.Get(h); v != "" {
+			headers[strings.ToLower(h)] = trim(v)
+		}
+	}
+	var names []string
+	for h := range headers {
+		names = append(names, h)
+	}
+	sort.Strings(names)
+	canonHeaders := ""
+	for _, h := range names {
+		canonHeaders += h + ":" + headers[h] + "\n"
+	}
+	signed := strings.Join(names, ";")
+
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	query := req.URL.Query()
+	var params []string
+	for k, vs := range query {
+		for _, v := range vs {
+			params = append(params, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(params)
+
+	canonReq := strings.Join([]string{req.Method, uri, strings.Join(params, "&"),
+		canonHeaders, signed, payloadHash}, "\n")
+	scope := date + "/" + auth["Region"] + "/" + auth["Service"] + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonReq))
+	tracef("Canonical request:\n%s\nString to sign:\n%s", canonReq, toSign)
+
+	key := hmacSHA256([]byte("AWS4"+auth["Secret-Key"]), date)
+	for _, s := range []string{auth["Region"], auth["Service"], "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		auth["Access-Key"], scope, signed, signature))
+	return nil
+}
@@ -0,0 +1,259 @@
+package suite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSigV4(t *testing.T) {
+	// get-vanilla of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	auth := map[string]string{"Type": "sigv4", "Access-Key": "AKIDEXAMPLE",
+		"Secret-Key": "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "Region": "us-east-1", "Service": "service"}
+	if err := signV4(req, auth, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Bad signature:\n got %s\nwant %s", got, want)
+	}
+	if req.Header.Get("X-Amz-Date") != "20150830T123600Z" {
+		t.Errorf("Bad X-Amz-Date %q", req.Header.Get("X-Amz-Date"))
+	}
+
+	body := "a=1"
+	req, _ = http.NewRequest("POST", "https://example.amazonaws.com/?b=2&a=1", strings.NewReader(body))
+	if err := signV4(req, auth, time.Now()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if b := readBody(req.Body); string(b) != body {
+		t.Errorf("Body consumed by signing: %q", b)
+	}
+}
+
+func TestDigestResponse(t *testing.T) {
+	// example of RFC 2617, section 3.5
+	c := parseDigestChallenge(`Digest realm="testrealm@host.com", qop="auth,auth-int", ` +
+		`nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+	if c == nil {
+		t.Fatalf("Cannot parse challenge")
+	}
+	h := c.header("GET", "/dir/index.html", "Mufasa", "Circle Of Life", "00000001", "0a4f113b")
+	if p := parseAuthParams(h[len("Digest "):]); p["response"] != "6629fae49393a05397450978507c4ef1" ||
+		p["opaque"] != c.opaque || p["nc"] != "00000001" || p["qop"] != "auth" {
+		t.Errorf("Bad digest answer %s", h)
+	}
+}
+
+// Run the single test of st against ts.
+func runAuthSuite(t *testing.T, st string, ts *httptest.Server) *Test {
+	s, err := NewParser(strings.NewReader(strings.Replace(st, "${URL}", ts.URL, -1)), "auth.wt").ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	s.RunTest(0)
+	return &s.Test[0]
+}
+
+func TestDigestAuth(t *testing.T) {
+	var mu sync.Mutex
+	challenges, authorized := 0, 0
+	challenge := &digestChallenge{realm: "webtest", nonce: "abc123", opaque: "xyz", qop: "auth"}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		h := r.Header.Get("Authorization")
+		if hp(h, "Digest ") {
+			p := parseAuthParams(h[len("Digest "):])
+			want := challenge.header(r.Method, p["uri"], "alice", "secret", p["nc"], p["cnonce"])
+			if h == want && p["uri"] == r.URL.RequestURI() {
+				authorized++
+				fmt.Fprintf(w, "Welcome %s", p["username"])
+				return
+			}
+		}
+		challenges++
+		w.Header().Set("WWW-Authenticate", `Digest realm="webtest", qop="auth", nonce="abc123", opaque="xyz"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	st := `
+----------
+Digest
+----------
+GET ${URL}/private?x=1
+AUTH
+	Type      :=  digest
+	User      :=  alice
+	Password  :=  ${PW}
+CONST
+	PW  :=  secret
+RESPONSE
+	Status-Code  ==  200
+BODY
+	Txt  ~=  "Welcome alice"
+`
+	for i := 1; i <= 2; i++ {
+		test := runAuthSuite(t, st, ts)
+		if _, f, e := test.Stat(); f+e > 0 {
+			t.Errorf("Run %d: Digest authentication failed: %s", i, test.Status())
+		}
+	}
+	if challenges != 1 || authorized != 2 {
+		t.Errorf("Got %d challenges and %d authorized requests, want 1 and 2", challenges, authorized)
+	}
+}
+
+func TestOAuth2Auth(t *testing.T) {
+	var mu sync.Mutex
+	var grants []string
+	tokens, lastAuth := 0, ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/token" {
+			id, secret, _ := r.BasicAuth()
+			if id != "client" || secret != "s3cret" || r.FormValue("scope") == "bad" {
+				http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+				return
+			}
+			grant := r.FormValue("grant_type")
+			if grant == "password" && (r.FormValue("username") != "bob" || r.FormValue("password") != "pw") {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			grants = append(grants, grant)
+			tokens++
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token":"tok%d","token_type":"bearer","expires_in":60,"refresh_token":"r%d"}`,
+				tokens, tokens)
+			return
+		}
+		if !hp(r.Header.Get("Authorization"), "Bearer tok") {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		lastAuth = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	authNow = func() time.Time { return now }
+	defer func() { authNow = time.Now }()
+
+	st := `
+----------
+OAuth2
+----------
+GET ${URL}/api
+AUTH
+	Type           :=  oauth2
+	Token-Url      :=  ${URL}/token
+	Client-Id      :=  client
+	Client-Secret  :=  s3cret
+	Scope          :=  read
+RESPONSE
+	Status-Code  ==  200
+`
+	body := func(test *Test) string {
+		if _, f, e := test.Stat(); f+e > 0 {
+			t.Errorf("OAuth2 authentication failed: %s", test.Status())
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return "token " + strings.TrimPrefix(lastAuth, "Bearer ")
+	}
+	if b := body(runAuthSuite(t, st, ts)); b != "token tok1" {
+		t.Errorf("First request: got %q", b)
+	}
+	if b := body(runAuthSuite(t, st, ts)); b != "token tok1" {
+		t.Errorf("Cached token not used: got %q", b)
+	}
+	now = now.Add(2 * time.Minute)
+	if b := body(runAuthSuite(t, st, ts)); b != "token tok2" {
+		t.Errorf("Expired token not refreshed: got %q", b)
+	}
+	pw := strings.Replace(strings.Replace(st, "read", "write", 1), "Client-Secret", "Grant  :=  password\n\tUser  :=  bob\n\tPassword  :=  pw\n\tClient-Secret", 1)
+	if b := body(runAuthSuite(t, pw, ts)); b != "token tok3" {
+		t.Errorf("Password grant: got %q", b)
+	}
+	if g := strings.Join(grants, ","); g != "client_credentials,refresh_token,password" {
+		t.Errorf("Bad grants %s", g)
+	}
+
+	test := runAuthSuite(t, strings.Replace(st, "read", "bad", 1), ts)
+	if _, _, e := test.Stat(); e == 0 {
+		t.Errorf("Missing error for failing token request")
+	}
+}
+
+func TestRedirectAuth(t *testing.T) {
+	var mu sync.Mutex
+	got := make(map[string]string)
+	record := func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got[r.URL.Path] = r.Header.Get("Authorization")
+		mu.Unlock()
+	}
+	other := httptest.NewServer(http.HandlerFunc(record))
+	defer other.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(w, r)
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/same", http.StatusFound)
+		case "/same":
+			http.Redirect(w, r, other.URL+"/other", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	// The suite talks to localhost, other is reached as 127.0.0.1.
+	ts.URL = strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	runAuthSuite(t, "----------\nRedirect\n----------\nGET ${URL}/\nAUTH\n\tType  :=  bearer\n\tToken  :=  abc\n", ts)
+	mu.Lock()
+	defer mu.Unlock()
+	for path, want := range map[string]string{"/": "Bearer abc", "/same": "Bearer abc", "/other": ""} {
+		if h, ok := got[path]; !ok || h != want {
+			t.Errorf("%s: Expected authorization %q, got %q (requested %t)", path, want, h, ok)
+		}
+	}
+}
+
+func TestBearerAndBasicAuth(t *testing.T) {
+	var mu sync.Mutex
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = r.Header.Get("Authorization")
+		mu.Unlock()
+	}))
+	defer ts.Close()
+	runAuthSuite(t, "----------\nBearer\n----------\nGET ${URL}/\nAUTH\n\tType  :=  bearer\n\tToken  :=  abc\n", ts)
+	if mu.Lock(); got != "Bearer abc" {
+		t.Errorf("Bad bearer authorization %q", got)
+	}
+	mu.Unlock()
+	runAuthSuite(t, "----------\nBasic\n----------\nGET ${URL}/\nAUTH\n\tType  :=  basic\n\tUser  :=  u\n\tPassword  :=  p\n", ts)
+	if mu.Lock(); got != "Basic dTpw" {
+		t.Errorf("Bad basic authorization %q", got)
+	}
+	mu.Unlock()
+
+	for _, auth := range []string{"\tType  :=  kerberos\n", "\tType  :=  bearer\n",
+		"\tType  :=  bearer\n\tToken  :=  x\n\tUser  :=  y\n",
+		"\tType  :=  oauth2\n\tToken-Url  :=  x\n\tClient-Id  :=  y\n\tGrant  :=  implicit\n"} {
+		_, err := NewParser(strings.NewReader("----------\nA\n----------\nGET http://localhost/\nAUTH\n"+auth), "auth.wt").ReadSuite()
+		if err == nil {
+			t.Errorf("Missing error for AUTH\n%s", auth)
+		}
+	}
+}
@@ -78,6 +78,8 @@ type Condition struct {
 	Neg   bool
 	Id    string
 	Range Range
+
+	dir string // directory files named in Key are relative to
 }
 
 type Range struct {
@@ -100,6 +102,37 @@ func (r Range) String() (s string) {
 	return
 }
 
+// Limits of r applied to a slice of length n.
+func (r Range) limits(n int) (low, high int) {
+	low, high = 0, n
+	if r.Low {
+		low = bound(r.N, n)
+	}
+	if r.High {
+		high = bound(r.M, n)
+	}
+	if high < low {
+		high = low
+	}
+	return
+}
+
+// The lines of v selected by r.
+func (r Range) Lines(v string) string {
+	if !r.Low && !r.High {
+		return v
+	}
+	vv := strings.Split(v, "\n")
+	low, high := r.limits(len(vv))
+	return strings.Join(vv[low:high], "\n")
+}
+
+// The bytes of v selected by r.
+func (r Range) Bytes(v []byte) []byte {
+	low, high := r.limits(len(v))
+	return v[low:high]
+}
+
 // Represent a condition in a logfile
 type LogCondition struct {
 	Path string // path to the logfile
@@ -171,21 +204,7 @@ func snippet(s string, n int) (snip string) {
 
 // Check whether v fullfills the condition cond.
 func (cond *Condition) Fullfilled(v string) (ans bool, was string) {
-	if cond.Range.Low || cond.Range.High {
-		vv := strings.Split(v, "\n")
-		low, high := 0, len(vv)
-		if cond.Range.Low {
-			low = bound(cond.Range.N, high)
-		}
-		if cond.Range.High {
-			high = bound(cond.Range.M, high)
-		}
-		if high < low {
-			high = low
-		}
-		vv = vv[low:high]
-		v = strings.Join(vv, "\n")
-	}
+	v = cond.Range.Lines(v)
 
 	switch cond.Op {
 	case ".": // Empty operator: tests existance only.
@@ -291,17 +310,7 @@ func (cond *Condition) BinFullfilled(v []byte) (ans bool, was string) {
 	ans = false
 	val := hexToBytes(cond.Val)
 
-	low, high := 0, len(v)
-	if cond.Range.Low {
-		low = bound(cond.Range.N, high)
-	}
-	if cond.Range.High {
-		high = bound(cond.Range.M, high)
-	}
-	if high < low {
-		high = low
-	}
-	v = v[low:high]
+	v = cond.Range.Bytes(v)
 
 	switch cond.Op {
 	case ".": // Empty operator: tests existance only.
@@ -53,7 +53,7 @@ func expiredOrDeleted(c *http.Cookie) bool {
 		return true
 	}
 
-	if c.Expires.Year() == 0 {
+	if c.Expires.IsZero() {
 		return false
 	}
 
@@ -2,8 +2,9 @@ package suite
 
 import (
 	"fmt"
-	"http"
+	"net/http"
 	"testing"
+	"time"
 )
 
 func TestJarUpdate(t *testing.T) {
@@ -43,3 +44,19 @@ func TestJarUpdate(t *testing.T) {
 		t.Error(fmt.Sprintf("myCookie3 on pos 2: %v", jar.cookies[1]))
 	}
 }
+
+func TestExpiredOrDeleted(t *testing.T) {
+	for i, tc := range []struct {
+		c    http.Cookie
+		want bool
+	}{
+		{http.Cookie{Name: "session"}, false},
+		{http.Cookie{Name: "deleted", MaxAge: -1}, true},
+		{http.Cookie{Name: "future", Expires: time.Now().Add(time.Hour)}, false},
+		{http.Cookie{Name: "past", Expires: time.Now().Add(-time.Hour)}, true},
+	} {
+		if got := expiredOrDeleted(&tc.c); got != tc.want {
+			t.Errorf("%d: %s: got %t, want %t", i, tc.c.Name, got, tc.want)
+		}
+	}
+}
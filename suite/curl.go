@@ -0,0 +1,116 @@
+package suite
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Quote s for a POSIX shell if needed.
+func shellQuote(s string) string {
+	plain := s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r < 128 && (isLetter(uint8(r)) || isDigit(uint8(r)))) && !strings.ContainsRune("-_./:=@,+%", r)
+	}) == -1
+	if plain {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Curl returns a curl command line which sends the request of test like
+// webtest does: Variables are substituted, the global test is merged and
+// header fields, cookies, authentication and the body are added.  Redirects
+// are followed.  Tests with STEPs result in one command per step.
+func (test *Test) Curl(global *Test) (string, error) {
+	if len(test.Steps) > 0 {
+		var cmds []string
+		for i := range test.Steps {
+			c, err := test.Steps[i].Curl(global)
+			if err != nil {
+				return "", fmt.Errorf("Step '%s': %s", test.Steps[i].Title, err.Error())
+			}
+			cmds = append(cmds, "# Step "+test.Steps[i].Title+"\n"+c)
+		}
+		return strings.Join(cmds, "\n"), nil
+	}
+
+	t := test.Copy()
+	t.Result = nil
+	ti := prepareTest(t, global)
+	for _, r := range append(t.Result, ti.Result...) {
+		if r.Status != TestPassed {
+			return "", fmt.Errorf("%s: %s", r.Cause, r.Message)
+		}
+	}
+	if ti.Method == "" {
+		return "", errors.New("No request")
+	}
+	req, err := newRequest(ti)
+	if err != nil {
+		return "", err
+	}
+	addHeadersAndCookies(req, ti)
+
+	args := []string{"curl", "--location"}
+	switch strings.ToLower(ti.Auth["Type"]) {
+	case "digest":
+		args = append(args, "--digest", "--user "+shellQuote(ti.Auth["User"]+":"+ti.Auth["Password"]))
+	default:
+		if err := authorize(req, ti.Auth); err != nil {
+			return "", err
+		}
+	}
+
+	multipart := hp(req.Header.Get("Content-Type"), "multipart/form-data")
+	switch {
+	case req.Method == "HEAD":
+		args = append(args, "--head")
+	case req.Method == "POST" && req.Body != nil:
+		// implied by the body
+	case req.Method != "GET":
+		args = append(args, "--request "+req.Method)
+	}
+	args = append(args, shellQuote(req.URL.String()))
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		if name == "Content-Type" && multipart {
+			continue // curl sets the boundary itself
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range req.Header[name] {
+			args = append(args, "--header "+shellQuote(name+": "+v))
+		}
+	}
+
+	switch {
+	case multipart:
+		keys := make([]string, 0, len(ti.Param))
+		for k := range ti.Param {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, v := range ti.Param[k] {
+				if hp(v, "@file:") {
+					args = append(args, "--form "+shellQuote(k+"=@"+v[6:]))
+				} else {
+					args = append(args, "--form-string "+shellQuote(k+"="+v))
+				}
+			}
+		}
+	case hp(ti.SendBody, "@file:"):
+		args = append(args, "--data-binary "+shellQuote("@"+trim(ti.SendBody[6:])))
+	case req.GetBody != nil:
+		rc, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		args = append(args, "--data-binary "+shellQuote(string(readBody(rc))))
+	}
+	return strings.Join(args, " \\\n    "), nil
+}
@@ -0,0 +1,94 @@
+package suite
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	for _, tc := range []struct{ s, want string }{
+		{"http://x.org/a?b=1", "'http://x.org/a?b=1'"},
+		{"x.org/a-b_c", "x.org/a-b_c"},
+		{"", "''"},
+		{"it's", `'it'\''s'`},
+		{"X: a b", "'X: a b'"},
+	} {
+		if got := shellQuote(tc.s); got != tc.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestCurl(t *testing.T) {
+	st := `
+----------
+Global
+----------
+CONST
+	HOST  :=  http://x.org
+HEADER
+	X-App  :=  shop
+
+----------
+Update
+----------
+PUT ${HOST}/cart/7
+SEND-COOKIE
+	sid  :=  abc
+HEADER
+	Content-Type  :=  application/json
+SEND-BODY
+	{"qty": 2}
+
+----------
+Search
+----------
+GET ${HOST}/search
+PARAM
+	q  :=  "red shoes"
+
+----------
+Upload
+----------
+POST:mp ${HOST}/upload
+PARAM
+	name  :=  "a b"
+	file  :=  @file:/tmp/x.txt
+
+----------
+Broken
+----------
+HEADER
+	X  :=  y
+`
+	s, err := NewParser(strings.NewReader(st), "curl.wt").ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	for i, want := range [][]string{
+		{"curl \\\n    --location", "--request PUT", "http://x.org/cart/7", "--header 'Content-Type: application/json'",
+			"--header 'Cookie: sid=abc'", "--header 'X-App: shop'", `--data-binary '{"qty": 2}'`},
+		{"'http://x.org/search?q=red+shoes'", "--header 'X-App: shop'"},
+		{"http://x.org/upload", "--form-string 'name=a b'", "--form file=@/tmp/x.txt"},
+	} {
+		cmd, err := s.Test[i].Curl(s.Global)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s", s.Test[i].Title, err.Error())
+			continue
+		}
+		for _, w := range want {
+			if !strings.Contains(cmd, w) {
+				t.Errorf("%s: missing %q in\n%s", s.Test[i].Title, w, cmd)
+			}
+		}
+		if i > 0 && strings.Contains(cmd, "--request") {
+			t.Errorf("%s: superfluous method in\n%s", s.Test[i].Title, cmd)
+		}
+		if i == 2 && strings.Contains(cmd, "Content-Type") {
+			t.Errorf("%s: multipart content type sent in\n%s", s.Test[i].Title, cmd)
+		}
+	}
+	if _, err := s.Test[3].Curl(s.Global); err == nil {
+		t.Errorf("Missing error for test without request")
+	}
+}
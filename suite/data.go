@@ -0,0 +1,167 @@
+package suite
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// DataTable holds rows of variables e.g. for data driven tests (see DATA
+// section) or for virtual users in stresstests.
+type DataTable struct {
+	Names []string   // the variable names
+	Rows  [][]string // the values, one row per set of variables
+}
+
+// ReadDataFile reads a data table from a CSV file or (if the filename ends
+// in .json) from a JSON file.
+func ReadDataFile(filename string) (*DataTable, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if strings.ToLower(path.Ext(filename)) == ".json" {
+		return ReadJSONData(file)
+	}
+	return ReadCSVData(file)
+}
+
+// ReadCSVData reads a data table from r: The first row contains the
+// variable names, the following rows the values.
+func ReadCSVData(r io.Reader) (*DataTable, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 {
+		return nil, errors.New("CSV data needs a header row and at least one data row")
+	}
+	data := &DataTable{Rows: records[1:]}
+	for _, name := range records[0] {
+		data.Names = append(data.Names, strings.TrimSpace(name))
+	}
+	return data, nil
+}
+
+// ReadJSONData reads a data table from r which must contain an array of
+// objects. The variable names are the keys of the objects in the order of
+// first occurence. Numbers and booleans are converted to strings, other
+// non-string values are kept as JSON.
+func ReadJSONData(r io.Reader) (*DataTable, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+		return nil, errors.New("JSON data must be an array of objects")
+	}
+	data := &DataTable{}
+	column := make(map[string]int)
+	for dec.More() {
+		if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+			return nil, errors.New("JSON data must be an array of objects")
+		}
+		row := make([]string, len(data.Names))
+		for dec.More() {
+			t, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			name := t.(string)
+			var val interface{}
+			if err = dec.Decode(&val); err != nil {
+				return nil, err
+			}
+			c, ok := column[name]
+			if !ok {
+				c = len(data.Names)
+				column[name] = c
+				data.Names = append(data.Names, name)
+			}
+			for len(row) <= c {
+				row = append(row, "")
+			}
+			row[c] = jsonString(val)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	if len(data.Rows) == 0 {
+		return nil, errors.New("JSON data contains no rows")
+	}
+	if len(data.Names) == 0 {
+		return nil, errors.New("JSON data contains no variables")
+	}
+	return data, nil
+}
+
+// String representation of a decoded JSON value.
+func jsonString(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprintf("%t", v)
+	}
+	b, _ := json.Marshal(val)
+	return string(b)
+}
+
+// Vars returns the variables of row n modulo number of rows. DataTable
+// thus implements UserData with rows assigned round robin to the users.
+func (d *DataTable) Vars(n int) map[string]string {
+	vars := make(map[string]string, len(d.Names))
+	if len(d.Rows) == 0 {
+		return vars
+	}
+	row := d.Rows[n%len(d.Rows)]
+	for i, name := range d.Names {
+		if i < len(row) {
+			vars[name] = row[i]
+		}
+	}
+	return vars
+}
+
+// Expand test into one test per row of data: The variables of the row are
+// added as CONST variables and the title is extended by the row number and
+// the value of the first variable, e.g. "Login [row 3: user=alice]".
+func expandData(test *Test, data *DataTable) (tests []Test) {
+	if data == nil {
+		return []Test{*test}
+	}
+	for n := range data.Rows {
+		t := test.Copy()
+		vars := data.Vars(n)
+		for k, v := range vars {
+			t.Const[k] = v
+		}
+		t.Title = fmt.Sprintf("%s [row %d: %s=%s]", test.Title, n+1, data.Names[0], vars[data.Names[0]])
+		if t.Snapshot != nil && t.Snapshot.File == "" {
+			// each row has its own golden file
+			t.Snapshot.path = path.Join(path.Dir(t.Snapshot.path), sanitizeFilename(t.Title)+".snap")
+		}
+		tests = append(tests, *t)
+	}
+	return
+}
+
+// ExpandData replaces each test of s by one test per row of data (see the
+// DATA section).
+func (s *Suite) ExpandData(data *DataTable) {
+	var tests []Test
+	for i := range s.Test {
+		tests = append(tests, expandData(&s.Test[i], data)...)
+	}
+	s.Test = tests
+}
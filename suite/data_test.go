@@ -0,0 +1,91 @@
+package suite
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestReadJSONData(t *testing.T) {
+	data, err := ReadJSONData(strings.NewReader(`[
+		{"user": "alice", "age": 31, "admin": true},
+		{"user": "bob", "tags": ["a", "b"]}
+	]`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if got := strings.Join(data.Names, ","); got != "user,age,admin,tags" {
+		t.Errorf("Got names %s", got)
+	}
+	if len(data.Rows) != 2 {
+		t.Fatalf("Got %d rows", len(data.Rows))
+	}
+	if v := data.Vars(0); v["age"] != "31" || v["admin"] != "true" || v["tags"] != "" {
+		t.Errorf("Bad first row %v", v)
+	}
+	if v := data.Vars(1); v["user"] != "bob" || v["tags"] != `["a","b"]` {
+		t.Errorf("Bad second row %v", v)
+	}
+
+	for _, bad := range []string{`{"user": "alice"}`, `[1, 2]`, `[]`, `[{}]`, `[{}, {}]`} {
+		if _, err := ReadJSONData(strings.NewReader(bad)); err == nil {
+			t.Errorf("Missing error for %s", bad)
+		}
+	}
+}
+
+func TestDataSection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webtest-data")
+	if err != nil {
+		t.Fatalf("Cannot create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	csv := "user,password\nalice,secret\nbob,geheim\ncarl,hemligt\n"
+	if err = ioutil.WriteFile(path.Join(dir, "users.csv"), []byte(csv), 0644); err != nil {
+		t.Fatalf("Cannot write data: %s", err.Error())
+	}
+
+	st := `
+----------------
+Login
+----------------
+GET http://localhost/login?user=${user}&pw=${password}
+DATA
+	File  :=  users.csv
+
+----------------
+Home
+----------------
+GET http://localhost/
+`
+	p := NewParser(strings.NewReader(st), "login.wt")
+	p.Dir = dir
+	s, err := p.ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(s.Test) != 4 {
+		t.Fatalf("Expected 4 tests, got %d", len(s.Test))
+	}
+	if s.Test[2].Title != "Login [row 3: user=carl]" || s.Test[2].Const["password"] != "hemligt" {
+		t.Errorf("Bad third test %q %v", s.Test[2].Title, s.Test[2].Const)
+	}
+	if s.Test[3].Title != "Home" {
+		t.Errorf("Test without DATA expanded: %q", s.Test[3].Title)
+	}
+
+	// -data flag
+	data, _ := ReadCSVData(strings.NewReader("lang\nde\nfr\n"))
+	s.ExpandData(data)
+	if len(s.Test) != 8 || s.Test[7].Title != "Home [row 2: lang=fr]" || s.Test[0].Const["lang"] != "de" {
+		t.Errorf("Bad expansion: %d tests, last %q", len(s.Test), s.Test[len(s.Test)-1].Title)
+	}
+
+	p = NewParser(strings.NewReader(st+"DATA\n\tFile := missing.csv\n"), "login.wt")
+	p.Dir = dir
+	if _, err = p.ReadSuite(); err == nil {
+		t.Errorf("Missing error for missing data file")
+	}
+}
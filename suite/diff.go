@@ -0,0 +1,356 @@
+package suite
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Maximum size in bytes of a diff included in the message of a failed
+// body condition. Longer diffs are truncated, 0 disables diffs completely.
+var MaxDiffSize = 4000
+
+// Number of unchanged lines (or hex dump rows) shown around a difference.
+var DiffContext = 3
+
+// Upper limit of the product of the number of differing lines for which a
+// real LCS diff is computed. Larger bodies are reported as a block change.
+const maxDiffWork = 4000000
+
+// Limit s to MaxDiffSize bytes.
+func truncateDiff(s string) string {
+	if len(s) <= MaxDiffSize {
+		return s
+	}
+	s = s[:MaxDiffSize]
+	if i := strings.LastIndex(s, "\n"); i > 0 {
+		s = s[:i+1]
+	}
+	return s + "[... diff truncated]\n"
+}
+
+// Diff of the expected and actual body for a failed Txt condition cond.
+// The empty string is returned if no diff makes sense for cond.
+func (cond *Condition) Diff(body string) string {
+	if MaxDiffSize <= 0 || cond.Neg {
+		return ""
+	}
+	v := cond.Range.Lines(body)
+	var d string
+	switch cond.Op {
+	case "==":
+		d = textDiff(cond.Val, v)
+	case "_=":
+		d = textDiff(cond.Val, snippetLines(v, strings.Count(cond.Val, "\n")+1))
+	case "=_":
+		d = textDiff(cond.Val, snippetLines(v, -(strings.Count(cond.Val, "\n")+1)))
+	case "~=":
+		d = nearestMatch(cond.Val, v)
+	}
+	if d == "" {
+		return ""
+	}
+	return "\n" + truncateDiff(d)
+}
+
+// Hex dump diff of the expected and actual body for a failed Bin
+// condition cond. The empty string is returned if no diff makes sense.
+func (cond *Condition) BinDiff(body []byte) string {
+	if MaxDiffSize <= 0 || cond.Neg {
+		return ""
+	}
+	v := cond.Range.Bytes(body)
+	val := hexToBytes(cond.Val)
+	var d string
+	switch cond.Op {
+	case "==":
+		d = hexDiff(val, v, 0)
+	case "_=":
+		if len(v) > len(val) {
+			v = v[:len(val)]
+		}
+		d = hexDiff(val, v, 0)
+	case "=_":
+		off := 0
+		if len(v) > len(val) {
+			off = len(v) - len(val)
+			v = v[off:]
+		}
+		d = hexDiff(val, v, off)
+	}
+	if d == "" {
+		return ""
+	}
+	return "\n" + truncateDiff(d)
+}
+
+// The first n (n>0) or last -n (n<0) lines of s.
+func snippetLines(s string, n int) string {
+	lines := strings.Split(s, "\n")
+	if n > 0 && n < len(lines) {
+		lines = lines[:n]
+	} else if n < 0 && -n < len(lines) {
+		lines = lines[len(lines)+n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// A single line of an edit script: op is one of ' ', '-' or '+'.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// Compute the edit script transforming a into b based on the longest
+// common subsequence of lines.
+func diffLines(a, b []string) (script []diffLine) {
+	// Strip common prefix and suffix to keep the quadratic part small.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	for _, l := range a[:pre] {
+		script = append(script, diffLine{' ', l})
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+
+	if len(ma)*len(mb) > maxDiffWork {
+		for _, l := range ma {
+			script = append(script, diffLine{'-', l})
+		}
+		for _, l := range mb {
+			script = append(script, diffLine{'+', l})
+		}
+	} else {
+		// lcs[i][j] is the length of the LCS of ma[i:] and mb[j:].
+		n, m := len(ma), len(mb)
+		lcs := make([][]int, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && ma[i] == mb[j]:
+				script = append(script, diffLine{' ', ma[i]})
+				i++
+				j++
+			case j == m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+				script = append(script, diffLine{'-', ma[i]})
+				i++
+			default:
+				script = append(script, diffLine{'+', mb[j]})
+				j++
+			}
+		}
+	}
+
+	for _, l := range a[len(a)-suf:] {
+		script = append(script, diffLine{' ', l})
+	}
+	return
+}
+
+// Unified diff (with DiffContext lines of context) of the expected text exp
+// and the actual text got. Returns "" if both are equal.
+func textDiff(exp, got string) string {
+	script := diffLines(strings.Split(exp, "\n"), strings.Split(got, "\n"))
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("--- expected\n+++ got\n")
+	changed := false
+	for start := 0; start < len(script); {
+		// find next change
+		for start < len(script) && script[start].op == ' ' {
+			start++
+		}
+		if start == len(script) {
+			break
+		}
+		changed = true
+
+		// extend hunk as long as changes are closer than 2*DiffContext
+		end, quiet := start, 0
+		for i := start; i < len(script) && quiet <= 2*DiffContext; i++ {
+			if script[i].op == ' ' {
+				quiet++
+			} else {
+				quiet = 0
+				end = i + 1
+			}
+		}
+		lo, hi := start-DiffContext, end+DiffContext
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(script) {
+			hi = len(script)
+		}
+
+		// line numbers (1 based) of the hunk in exp and got
+		la, lb := 1, 1
+		for _, dl := range script[:lo] {
+			if dl.op != '+' {
+				la++
+			}
+			if dl.op != '-' {
+				lb++
+			}
+		}
+		na, nb := 0, 0
+		for _, dl := range script[lo:hi] {
+			if dl.op != '+' {
+				na++
+			}
+			if dl.op != '-' {
+				nb++
+			}
+		}
+		fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", la, na, lb, nb)
+		for _, dl := range script[lo:hi] {
+			buf.WriteByte(dl.op)
+			buf.WriteString(dl.text)
+			buf.WriteByte('\n')
+		}
+		start = hi
+	}
+	if !changed {
+		return ""
+	}
+	return buf.String()
+}
+
+// Describe where in v the longest prefix of val occurs and how the
+// expected continuation differs from the actual one.
+func nearestMatch(val, v string) string {
+	if val == "" {
+		return ""
+	}
+	// Binary search for the longest prefix of val contained in v.
+	lo, hi := 0, len(val) // prefix of length lo is contained, hi not
+	if strings.Contains(v, val) {
+		return ""
+	}
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if strings.Contains(v, val[:mid]) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	if lo == 0 {
+		return "Nearest match: none, not even the first character was found.\n"
+	}
+	pos := strings.Index(v, val[:lo])
+	line := strings.Count(v[:pos], "\n") + 1
+	end := pos + lo
+	got := v[end:]
+	exp := val[lo:]
+	if len(got) > len(exp)+10 {
+		got = got[:len(exp)+10]
+	}
+	return fmt.Sprintf("Nearest match: %d of %d characters in line %d, differs after %q\n"+
+		"  expected: %q\n  got:      %q\n", lo, len(val), line, snippet(val[:lo], -20), exp, got)
+}
+
+// Bytes per row of a hex dump.
+const hexRow = 16
+
+// One row of a hex dump of b starting at offset off.
+func hexDumpRow(b []byte, off int) string {
+	h := fmt.Sprintf("%08x ", off)
+	for i := 0; i < hexRow; i++ {
+		if i < len(b) {
+			h += fmt.Sprintf(" %02x", b[i])
+		} else {
+			h += "   "
+		}
+	}
+	h += "  |"
+	for _, c := range b {
+		if c >= 32 && c < 127 {
+			h += string(rune(c))
+		} else {
+			h += "."
+		}
+	}
+	return h + "|"
+}
+
+// Row r of b or nil if b is shorter.
+func hexRowOf(b []byte, r int) []byte {
+	lo, hi := r*hexRow, (r+1)*hexRow
+	if lo >= len(b) {
+		return nil
+	}
+	if hi > len(b) {
+		hi = len(b)
+	}
+	return b[lo:hi]
+}
+
+// Hex dump diff of the expected bytes exp and the actual bytes got. Rows
+// which differ are printed as expected (-) and got (+) pair, surrounded
+// by DiffContext equal rows. Offsets are printed relative to off.
+func hexDiff(exp, got []byte, off int) string {
+	if bytes.Equal(exp, got) {
+		return ""
+	}
+	n := len(exp)
+	if len(got) > n {
+		n = len(got)
+	}
+	rows := (n + hexRow - 1) / hexRow
+	differs := make([]bool, rows)
+	for r := range differs {
+		differs[r] = !bytes.Equal(hexRowOf(exp, r), hexRowOf(got, r))
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "--- expected (%d bytes)\n+++ got (%d bytes)\n", len(exp), len(got))
+	last := -1 // last row printed
+	for r := 0; r < rows; r++ {
+		near := false
+		for i := r - DiffContext; i <= r+DiffContext; i++ {
+			if i >= 0 && i < rows && differs[i] {
+				near = true
+				break
+			}
+		}
+		if !near {
+			continue
+		}
+		if last != -1 && last != r-1 {
+			buf.WriteString("...\n")
+		}
+		last = r
+		e, g := hexRowOf(exp, r), hexRowOf(got, r)
+		if !differs[r] {
+			fmt.Fprintf(buf, " %s\n", hexDumpRow(e, off+r*hexRow))
+			continue
+		}
+		if e != nil {
+			fmt.Fprintf(buf, "-%s\n", hexDumpRow(e, off+r*hexRow))
+		}
+		if g != nil {
+			fmt.Fprintf(buf, "+%s\n", hexDumpRow(g, off+r*hexRow))
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,100 @@
+package suite
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTextDiff(t *testing.T) {
+	exp := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj"
+	got := "a\nb\nc\nd\nE\nf\ng\nh\ni\nj\nk"
+	d := textDiff(exp, got)
+	want := `--- expected
++++ got
+@@ -2,9 +2,10 @@
+ b
+ c
+ d
+-e
++E
+ f
+ g
+ h
+ i
+ j
++k
+`
+	if d != want {
+		t.Errorf("Got diff\n%s\nwanted\n%s", d, want)
+	}
+
+	if d := textDiff(exp, exp); d != "" {
+		t.Errorf("Expected empty diff for equal text, got\n%s", d)
+	}
+
+	// two hunks
+	exp = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15"
+	got = "0\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\nX"
+	d = textDiff(exp, got)
+	if strings.Count(d, "@@ -") != 2 {
+		t.Errorf("Expected two hunks, got\n%s", d)
+	}
+	if !strings.Contains(d, "@@ -1,4 +1,4 @@\n-1\n+0\n") || !strings.Contains(d, "@@ -12,4 +12,4 @@") {
+		t.Errorf("Bad hunks in\n%s", d)
+	}
+}
+
+func TestNearestMatch(t *testing.T) {
+	body := "Hello World\nThe quick brown fox jumps."
+	nm := nearestMatch("quick red fox", body)
+	if !strings.Contains(nm, "6 of 13 characters in line 2") || !strings.Contains(nm, `"red fox"`) {
+		t.Errorf("Bad nearest match %q", nm)
+	}
+	if nm := nearestMatch("brown fox", body); nm != "" {
+		t.Errorf("Unexpected nearest match for contained text: %q", nm)
+	}
+}
+
+func TestHexDiff(t *testing.T) {
+	exp := make([]byte, 100)
+	got := make([]byte, 100)
+	for i := range exp {
+		exp[i], got[i] = byte(i), byte(i)
+	}
+	got[70] = 0xff
+	d := hexDiff(exp, got, 0)
+	if !strings.Contains(d, "-00000040  40 41 42 43 44 45 46") ||
+		!strings.Contains(d, "+00000040  40 41 42 43 44 45 ff") {
+		t.Errorf("Missing differing rows in\n%s", d)
+	}
+	if strings.Contains(d, "00000000 ") {
+		t.Errorf("Row far from difference printed\n%s", d)
+	}
+	if hexDiff(exp, exp, 0) != "" {
+		t.Errorf("Expected empty hex diff for equal data")
+	}
+}
+
+func TestConditionDiff(t *testing.T) {
+	MaxDiffSize = 4000
+	c := Condition{Key: "Txt", Op: "==", Val: "abc\ndef"}
+	if d := c.Diff("abc\nxyz"); !strings.Contains(d, "-def\n+xyz\n") {
+		t.Errorf("Bad diff %q", d)
+	}
+	c.Neg = true
+	if d := c.Diff("abc\ndef"); d != "" {
+		t.Errorf("Negated conditions should not produce diff, got %q", d)
+	}
+
+	c = Condition{Key: "Bin", Op: "_=", Val: "cafebabe"}
+	if d := c.BinDiff([]byte{0xca, 0xfe, 0xba, 0xbf, 0x00}); !strings.Contains(d, "+00000000  ca fe ba bf") {
+		t.Errorf("Bad bin diff %q", d)
+	}
+
+	MaxDiffSize = 30
+	c = Condition{Key: "Txt", Op: "==", Val: strings.Repeat("line\n", 20)}
+	if d := c.Diff(strings.Repeat("LINE\n", 20)); len(d) > 60 || !strings.HasSuffix(d, "[... diff truncated]\n") {
+		t.Errorf("Diff not truncated: %q", d)
+	}
+	MaxDiffSize = 4000
+}
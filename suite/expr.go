@@ -0,0 +1,313 @@
+package suite
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Expressions in ${...}: Besides plain variables ${name} and ${NOW ...} the
+// following expressions are understood:
+//   ${name:-default}   value of variable name or default if name is unset
+//   ${env.HOME}        the environment variable HOME (may have a default too)
+//   ${func(arg, ...)}  a function applied to its arguments (see exprFuncs)
+// Arguments of functions are numbers, variables, nested function calls or
+// (quoted) text which may contain ${...} expressions.
+
+// A function usable in expressions with its minimum and maximum number of
+// arguments.
+type exprFunc struct {
+	min, max int
+	f        func(args []string) (string, error)
+}
+
+// The functions usable in expressions.
+var exprFuncs = map[string]exprFunc{
+	"urlencode": {1, 1, func(a []string) (string, error) { return url.QueryEscape(a[0]), nil }},
+	"base64": {1, 1, func(a []string) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(a[0])), nil
+	}},
+	"sha256": {1, 1, func(a []string) (string, error) {
+		sum := sha256.Sum256([]byte(a[0]))
+		return hex.EncodeToString(sum[:]), nil
+	}},
+	"hmac": {2, 2, func(a []string) (string, error) {
+		mac := hmac.New(sha256.New, []byte(a[0]))
+		mac.Write([]byte(a[1]))
+		return hex.EncodeToString(mac.Sum(nil)), nil
+	}},
+	"uuid":       {0, 0, func(a []string) (string, error) { return newUUID() }},
+	"randint":    {2, 2, randint},
+	"randstr":    {1, 1, randstr},
+	"upper":      {1, 1, func(a []string) (string, error) { return strings.ToUpper(a[0]), nil }},
+	"lower":      {1, 1, func(a []string) (string, error) { return strings.ToLower(a[0]), nil }},
+	"substr":     {2, 3, substr},
+	"jsonescape": {1, 1, jsonescape},
+}
+
+// A random (version 4) UUID.
+func newUUID() (string, error) {
+	u := make([]byte, 16)
+	if _, err := rand.Read(u); err != nil {
+		return "", err
+	}
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
+
+// Convert the arguments of f to integers.
+func intArgs(f string, args []string) ([]int, error) {
+	n := make([]int, len(args))
+	for i, a := range args {
+		var err error
+		if n[i], err = strconv.Atoi(a); err != nil {
+			return nil, fmt.Errorf("%s: argument %d '%s' is not an integer", f, i+1, a)
+		}
+	}
+	return n, nil
+}
+
+// Random integer from [a[0], a[1]].
+func randint(a []string) (string, error) {
+	n, err := intArgs("randint", a)
+	if err != nil {
+		return "", err
+	}
+	if n[1] < n[0] {
+		return "", fmt.Errorf("randint: empty range %d to %d", n[0], n[1])
+	}
+	randomLock.Lock()
+	r := n[0] + Random.Intn(n[1]-n[0]+1)
+	randomLock.Unlock()
+	return strconv.Itoa(r), nil
+}
+
+// Random alphanumeric string of length a[0].
+func randstr(a []string) (string, error) {
+	n, err := intArgs("randstr", a)
+	if err != nil {
+		return "", err
+	}
+	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	s := make([]byte, n[0])
+	randomLock.Lock()
+	for i := range s {
+		s[i] = chars[Random.Intn(len(chars))]
+	}
+	randomLock.Unlock()
+	return string(s), nil
+}
+
+// Substring of a[0] starting at character a[1] (counting from 0) of length
+// a[2] (or up to the end).
+func substr(a []string) (string, error) {
+	n, err := intArgs("substr", a[1:])
+	if err != nil {
+		return "", err
+	}
+	s := []rune(a[0])
+	start := n[0]
+	if start < 0 {
+		start = 0
+	} else if start > len(s) {
+		start = len(s)
+	}
+	end := len(s)
+	if len(n) > 1 && start+n[1] < end {
+		end = start + n[1]
+		if end < start {
+			end = start
+		}
+	}
+	return string(s[start:end]), nil
+}
+
+// a[0] escaped for use inside a JSON string.
+func jsonescape(a []string) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(a[0]); err != nil {
+		return "", err
+	}
+	s := strings.TrimSpace(buf.String())
+	return s[1 : len(s)-1], nil
+}
+
+// Check if s is a variable name: Letters, digits and underscores, not
+// starting with a digit.
+func isName(s string) bool {
+	if s == "" || isDigit(s[0]) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isLetter(s[i]) && !isDigit(s[i]) && s[i] != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// Check if s is a NOW expression like "NOW +3days | 2006-01-02".
+func isNowExpr(s string) bool {
+	return hp(s, "NOW") && (len(s) == 3 || !(isLetter(s[3]) || isDigit(s[3]) || s[3] == '_'))
+}
+
+// Value of NOW expression s.
+func nowExpr(s string) string {
+	tf := http.TimeFormat
+	s = strings.Trim(s[3:], " \t")
+	if i := strings.Index(s, "|"); i != -1 {
+		tf = strings.Trim(s[i+1:], " ")
+		s = strings.Trim(s[:i], " ")
+	}
+	return nowValue(s, tf, true)
+}
+
+// Check if s (the part between ${ and }) looks like an expression.
+func isExpr(s string) bool {
+	if isNowExpr(s) || isName(s) {
+		return true
+	}
+	name := strings.TrimPrefix(s, "env.")
+	if i := strings.Index(name, ":-"); i != -1 {
+		return isName(name[:i])
+	}
+	if name != s {
+		return isName(name)
+	}
+	if i := strings.Index(s, "("); i > 0 && hs(s, ")") {
+		_, ok := exprFuncs[s[:i]]
+		return ok
+	}
+	return false
+}
+
+// Lookup of variables during evaluation of expressions.
+type exprLookup func(name string) (value string, ok bool)
+
+// Evaluate the expression expr (see isExpr).
+func evalExpr(expr string, lookup exprLookup) (string, error) {
+	expr = trim(expr)
+	switch {
+	case isNowExpr(expr):
+		return nowExpr(expr), nil
+	case isName(expr):
+		if v, ok := lookup(expr); ok {
+			return v, nil
+		}
+		return "", fmt.Errorf("Cannot find value for variable '%s'", expr)
+	}
+
+	name, def, hasDefault := expr, "", false
+	if i := strings.Index(expr, ":-"); i != -1 {
+		name, def, hasDefault = expr[:i], expr[i+2:], true
+	}
+	if env := strings.TrimPrefix(name, "env."); env != name && isName(env) {
+		if v := os.Getenv(env); v != "" || !hasDefault {
+			return v, nil
+		}
+		return expandExprs(def, lookup)
+	}
+	if hasDefault && isName(name) {
+		if v, ok := lookup(name); ok && v != "" {
+			return v, nil
+		}
+		return expandExprs(def, lookup)
+	}
+
+	i := strings.Index(expr, "(")
+	if i <= 0 || !hs(expr, ")") {
+		return "", fmt.Errorf("Malformed expression '%s'", expr)
+	}
+	fn, ok := exprFuncs[expr[:i]]
+	if !ok {
+		return "", fmt.Errorf("Unknown function '%s'", expr[:i])
+	}
+	argList, err := splitArgs(expr[i+1 : len(expr)-1])
+	if err != nil {
+		return "", err
+	}
+	if len(argList) < fn.min || len(argList) > fn.max {
+		return "", fmt.Errorf("Wrong number of arguments for %s: %d", expr[:i], len(argList))
+	}
+	args := make([]string, len(argList))
+	for k, a := range argList {
+		if args[k], err = evalArg(a, lookup); err != nil {
+			return "", err
+		}
+	}
+	return fn.f(args)
+}
+
+// Evaluate one argument of a function: Quoted strings and other text may
+// contain ${...} expressions.
+func evalArg(a string, lookup exprLookup) (string, error) {
+	if _, err := strconv.ParseFloat(a, 64); err == nil {
+		return a, nil
+	}
+	if isExpr(a) {
+		return evalExpr(a, lookup)
+	}
+	if hp(a, "\"") {
+		s, err := dequote(a)
+		if err != nil {
+			return "", err
+		}
+		a = s
+	}
+	return expandExprs(a, lookup)
+}
+
+// Split the arguments of a function call at top level commas.
+func splitArgs(s string) (args []string, err error) {
+	if trim(s) == "" {
+		return nil, nil
+	}
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '{':
+			depth++
+		case c == ')' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, trim(s[start:i]))
+			start = i + 1
+		}
+	}
+	if quoted || depth != 0 {
+		return nil, fmt.Errorf("Unbalanced quotes or parenthesis in '%s'", s)
+	}
+	return append(args, trim(s[start:])), nil
+}
+
+// Replace all ${...} expressions in s.
+func expandExprs(s string, lookup exprLookup) (string, error) {
+	pre, vn, rest := nextPart(s)
+	if vn == "" {
+		return pre, nil
+	}
+	val, err := evalExpr(vn, lookup)
+	if err != nil {
+		return "", err
+	}
+	rest, err = expandExprs(rest, lookup)
+	return pre + val + rest, err
+}
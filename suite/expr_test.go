@@ -0,0 +1,85 @@
+package suite
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestEvalExpr(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		v, ok := map[string]string{"HOST": "example.org", "EMPTY": "", "Q": "a b&c", "N": "3"}[name]
+		return v, ok
+	}
+	Const["CONST_VAR"] = "c"
+	defer delete(Const, "CONST_VAR")
+	for _, tc := range []struct{ expr, want string }{
+		{"HOST", "example.org"},
+		{"HOST:-localhost", "example.org"},
+		{"PORT:-8080", "8080"},
+		{"EMPTY:-default", "default"},
+		{"PORT:-${HOST}:80", "example.org:80"},
+		{"env.WEBTEST_EXPR_UNSET:-none", "none"},
+		{"urlencode(Q)", "a+b%26c"},
+		{"urlencode(\"x/y z\")", "x%2Fy+z"},
+		{"base64(\"user:pass\")", "dXNlcjpwYXNz"},
+		{"sha256(\"abc\")", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"hmac(\"key\", \"The quick brown fox jumps over the lazy dog\")",
+			"f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"},
+		{"upper(HOST)", "EXAMPLE.ORG"},
+		{"lower(\"AbC\")", "abc"},
+		{"substr(HOST, 0, 7)", "example"},
+		{"substr(HOST, 8)", "org"},
+		{"substr(\"ab\", 1, 10)", "b"},
+		{"jsonescape(\"say \\\"hi\\\"\\n<b>\")", `say \"hi\"\n<b>`},
+		{"upper(substr(${HOST}, N))", "MPLE.ORG"},
+		{"randint(7, 7)", "7"},
+		{"NOW | 2006", ""},
+	} {
+		got, err := evalExpr(tc.expr, lookup)
+		if err != nil {
+			t.Errorf("%s: Unexpected error %s", tc.expr, err.Error())
+		} else if tc.want != "" && got != tc.want {
+			t.Errorf("%s: Expected %q, got %q", tc.expr, tc.want, got)
+		}
+	}
+
+	uuid, _ := evalExpr("uuid()", lookup)
+	if !regexp.MustCompile("^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$").MatchString(uuid) {
+		t.Errorf("Bad uuid %q", uuid)
+	}
+	if s, _ := evalExpr("randstr(12)", lookup); len(s) != 12 {
+		t.Errorf("Bad randstr %q", s)
+	}
+
+	for _, expr := range []string{"UNSET", "randint(1)", "randint(a, 2)", "substr(\"a\", x)",
+		"upper(\"a\", \"b\")", "upper(\"a)", "nope(1)"} {
+		if _, err := evalExpr(expr, lookup); err == nil {
+			t.Errorf("%s: Missing error", expr)
+		}
+	}
+}
+
+func TestSubstituteExpr(t *testing.T) {
+	test := NewTest("Expr")
+	test.Const["KEY"] = "secret"
+	test.Const["PATH"] = "/api/v1"
+	test.Seq["ID"] = []string{"1", "2"}
+	got := substitute("${PATH}?id=${ID}&sig=${hmac(KEY, \"${PATH}${ID}\")}&id2=${ID}&port=${PORT:-80}",
+		test, nil, test)
+	want := "/api/v1?id=1&sig=" + hmacHex("secret", "/api/v11") + "&id2=1&port=80"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if s := substitute("${nosuchfunc(x)} ${a.b}", test, nil, test); s != "${nosuchfunc(x)} ${a.b}" {
+		t.Errorf("Non-expressions changed: %q", s)
+	}
+	if strings.Contains(substitute("${uuid()}", test, nil, test), "$") {
+		t.Errorf("uuid not substituted")
+	}
+}
+
+func hmacHex(key, msg string) string {
+	s, _ := exprFuncs["hmac"].f([]string{key, msg})
+	return s
+}
@@ -0,0 +1,142 @@
+package suite
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestExtends(t *testing.T) {
+	st := `
+----------
+Global
+----------
+GET http://localhost/
+HEADER
+	User-Agent  :=  webtest
+
+----------
+Base
+----------
+GET http://localhost/base
+HEADER
+	Accept  :=  text/html
+PARAM
+	a  :=  1
+	b  :=  2
+RESPONSE
+	Status-Code  ==  200
+BODY
+	Txt  ~=  "base"
+SETTINGS
+	Repeat    :=  0
+	Max-Time  :=  500
+BEFORE
+	echo base
+
+----------
+Middle
+----------
+EXTENDS Base
+PARAM
+	b  :=  3
+RESPONSE
+	Status-Code  ==  201
+
+----------
+Leaf
+----------
+EXTENDS Middle
+POST http://localhost/leaf
+BODY
+	Txt  ~=  "leaf"
+BEFORE
+	echo leaf
+`
+	p := NewParser(strings.NewReader(st), "extends.wt")
+	s, err := p.ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(s.Test) != 3 {
+		t.Fatalf("Expected 3 tests, got %d", len(s.Test))
+	}
+	base, middle, leaf := s.Test[0], s.Test[1], s.Test[2]
+	if base.Setting["Repeat"] != 0 || middle.Setting["Repeat"] != 1 || middle.Setting["Max-Time"] != 500 {
+		t.Errorf("Bad settings: %v %v", base.Setting, middle.Setting)
+	}
+	if middle.Method != "GET" || middle.Url != "http://localhost/base" ||
+		leaf.Method != "POST" || leaf.Url != "http://localhost/leaf" {
+		t.Errorf("Bad request lines: %s %s, %s %s", middle.Method, middle.Url, leaf.Method, leaf.Url)
+	}
+	if leaf.Extends != "" || leaf.Param["a"][0] != "1" || leaf.Param["b"][0] != "3" ||
+		leaf.Header["Accept"] != "text/html" {
+		t.Errorf("Bad inherited values: %v %v", leaf.Param, leaf.Header)
+	}
+	if len(leaf.RespCond) != 1 || leaf.RespCond[0].Val != "201" {
+		t.Errorf("Bad response conditions: %v", leaf.RespCond)
+	}
+	if len(leaf.BodyCond) != 2 || len(middle.BodyCond) != 1 || len(base.BodyCond) != 1 {
+		t.Errorf("Bad body conditions: %v", leaf.BodyCond)
+	}
+	if len(leaf.Before) != 2 || leaf.Before[0][1] != "base" || leaf.Before[1][1] != "leaf" {
+		t.Errorf("Bad before commands: %v", leaf.Before)
+	}
+
+	for _, tc := range []struct{ suite, err string }{
+		{"----------\nA\n----------\nEXTENDS Nope\nGET http://localhost/\n",
+			"extends.wt:4: Test 'A' extends unknown test 'Nope'."},
+		{"----------\nA\n----------\nEXTENDS B\n\n----------\nB\n----------\nEXTENDS A\nGET http://localhost/\n",
+			"Cyclic EXTENDS"},
+		{"----------\nGlobal\n----------\nEXTENDS B\nGET http://localhost/\n",
+			"No EXTENDS allowed in Global"},
+	} {
+		_, err := NewParser(strings.NewReader(tc.suite), "extends.wt").ReadSuite()
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Expected error %q, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestExtendsData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webtest-extends")
+	if err != nil {
+		t.Fatalf("Cannot create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(path.Join(dir, "users.csv"), []byte("user\nalice\nbob\n"), 0644); err != nil {
+		t.Fatalf("Cannot write users.csv: %s", err.Error())
+	}
+	st := `
+----------
+Login
+----------
+POST http://localhost/login
+PARAM
+	user  :=  ${user}
+DATA
+	File  :=  users.csv
+
+----------
+Relogin
+----------
+EXTENDS Login
+PARAM
+	again  :=  1
+`
+	p := NewParser(strings.NewReader(st), "extends.wt")
+	p.Dir = dir
+	s, err := p.ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(s.Test) != 3 || s.Test[0].Title != "Login [row 1: user=alice]" || s.Test[2].Title != "Relogin" {
+		t.Fatalf("Bad tests %v", s.Test)
+	}
+	relogin := s.Test[2]
+	if relogin.Method != "POST" || relogin.Param["user"][0] != "${user}" || relogin.Param["again"][0] != "1" {
+		t.Errorf("Bad inherited values: %s %v", relogin.Method, relogin.Param)
+	}
+}
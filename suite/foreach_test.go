@@ -0,0 +1,73 @@
+package suite
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestForeach(t *testing.T) {
+	st := `
+FOREACH ${LANG} IN de "fr ch"
+----------
+Start Page
+----------
+GET http://localhost/${LANG}/
+IF ${ENV} == staging
+
+FOREACH ${PAGE_NO} IN 1 2
+----------
+Page ${PAGE_NO}
+----------
+GET http://localhost/${LANG}/page${PAGE_NO}
+END
+END
+
+----------
+Other
+----------
+GET http://localhost/other
+IF ${ENV} != staging
+`
+	p := NewParser(strings.NewReader(st), "foreach.wt")
+	s, err := p.ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	want := []string{"Start Page [LANG=de]", "Page 1 [LANG=de] [PAGE_NO=1]", "Page 2 [LANG=de] [PAGE_NO=2]",
+		"Start Page [LANG=fr ch]", "Page 1 [LANG=fr ch] [PAGE_NO=1]", "Page 2 [LANG=fr ch] [PAGE_NO=2]", "Other"}
+	if len(s.Test) != len(want) {
+		t.Fatalf("Expected %d tests, got %d", len(want), len(s.Test))
+	}
+	for i, w := range want {
+		if s.Test[i].Title != w {
+			t.Errorf("Test %d: Expected title %q, got %q", i, w, s.Test[i].Title)
+		}
+	}
+	if s.Test[5].Url != "http://localhost/fr ch/page2" {
+		t.Errorf("Bad url %q", s.Test[5].Url)
+	}
+
+	if !s.Test[0].skip(nil) || s.Test[1].skip(nil) || s.Test[6].skip(nil) {
+		t.Errorf("Bad IF without ENV")
+	}
+	Const["ENV"] = "staging"
+	defer delete(Const, "ENV")
+	if s.Test[0].skip(nil) || !s.Test[6].skip(nil) {
+		t.Errorf("Bad IF with ENV=staging")
+	}
+
+	for _, tc := range []struct{ suite, err string }{
+		{"FOREACH ${X} IN a b\n----------\nA\n----------\nGET http://localhost/\n",
+			"foreach.wt:1: FOREACH without END."},
+		{"END\n", "foreach.wt:1: END without FOREACH."},
+		{"FOREACH X IN a\nEND\n", "Bad FOREACH"},
+		{"FOREACH ${X} IN\nEND\n", "Bad FOREACH"},
+		{"FOREACH ${1X} IN a\nEND\n", "Bad FOREACH"},
+		{"----------\nA\n----------\nGET http://localhost/\nIF == x\n", "Bad IF"},
+	} {
+		_, err := NewParser(strings.NewReader(tc.suite), "foreach.wt").ReadSuite()
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Expected error %q, got %v", tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package suite
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/vdobler/webtest/tag"
+)
+
+// The last response received, kept in the global test for the FORM of the
+// following test.
+type page struct {
+	body []byte
+	url  string // final URL of the response
+}
+
+// Tag spec for the form selector sel: Either a tag spec like
+// "form id=login" or a simple CSS selector like "#login", "form.search" or
+// "form[name=search]".
+func formSpec(sel string) (*tag.TagSpec, error) {
+	if hp(sel, "#") || hp(sel, ".") || hp(sel, "[") ||
+		hp(sel, "form#") || hp(sel, "form.") || hp(sel, "form[") {
+		var err error
+		if sel, err = cssToTagSpec(sel); err != nil {
+			return nil, err
+		}
+	}
+	ts, err := tag.ParseSimpleTagSpec(sel)
+	if err != nil {
+		return nil, err
+	}
+	if ts.Name != "form" {
+		return nil, fmt.Errorf("Selector '%s' does not select a form", sel)
+	}
+	return ts, nil
+}
+
+// Convert the simple CSS selector sel of a form to a tag spec: Ids, classes
+// and attribute selectors [name] and [name=value] are supported.
+func cssToTagSpec(sel string) (string, error) {
+	spec, s := "form", strings.TrimPrefix(sel, "form")
+	for s != "" {
+		switch s[0] {
+		case '#', '.':
+			i := strings.IndexAny(s[1:], "#.[")
+			if i == -1 {
+				i = len(s) - 1
+			}
+			if i == 0 {
+				return "", fmt.Errorf("Malformed selector '%s'", sel)
+			}
+			if s[0] == '#' {
+				spec += " id=" + s[1:i+1]
+			} else {
+				spec += " class=" + s[1:i+1]
+			}
+			s = s[i+1:]
+		case '[':
+			i := strings.Index(s, "]")
+			if i == -1 {
+				return "", fmt.Errorf("Missing ] in selector '%s'", sel)
+			}
+			attr := s[1:i]
+			if j := strings.Index(attr, "="); j != -1 {
+				attr = attr[:j] + "=" + strings.Trim(attr[j+1:], `"'`)
+			}
+			spec += " " + attr
+			s = s[i+1:]
+		default:
+			return "", fmt.Errorf("Unsupported selector '%s'", sel)
+		}
+	}
+	return spec, nil
+}
+
+// Value of attribute name of node n and whether n has this attribute.
+func nodeAttr(n *tag.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if strings.ToLower(a.Key) == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// All nodes below n named name (in document order).
+func nodesNamed(n *tag.Node, name string) (nodes []*tag.Node) {
+	for _, c := range n.Child {
+		if c.Name == name {
+			nodes = append(nodes, c)
+		}
+		nodes = append(nodes, nodesNamed(c, name)...)
+	}
+	return
+}
+
+// Collect the values a browser would submit for form: Inputs with their
+// value, checked checkboxes and radio buttons, selected options (the first
+// option of a single select if none is selected) and textareas.  Disabled
+// controls, file inputs and buttons are skipped; submit lists the named
+// submit buttons in document order.
+func formValues(form *tag.Node) (values map[string][]string, submit [][2]string) {
+	values = make(map[string][]string)
+	var walk func(n *tag.Node)
+	walk = func(n *tag.Node) {
+		for _, c := range n.Child {
+			name, named := nodeAttr(c, "name")
+			if _, disabled := nodeAttr(c, "disabled"); disabled || !named || name == "" {
+				walk(c)
+				continue
+			}
+			switch c.Name {
+			case "input":
+				typ, _ := nodeAttr(c, "type")
+				value, _ := nodeAttr(c, "value")
+				switch strings.ToLower(typ) {
+				case "checkbox", "radio":
+					if _, checked := nodeAttr(c, "checked"); checked {
+						if value == "" {
+							value = "on"
+						}
+						values[name] = append(values[name], value)
+					}
+				case "submit", "image":
+					submit = append(submit, [2]string{name, value})
+				case "file", "button", "reset":
+				default:
+					values[name] = append(values[name], value)
+				}
+			case "button":
+				if typ, _ := nodeAttr(c, "type"); typ == "" || strings.ToLower(typ) == "submit" {
+					value, _ := nodeAttr(c, "value")
+					submit = append(submit, [2]string{name, value})
+				}
+			case "textarea":
+				values[name] = append(values[name], c.Text)
+			case "select":
+				options := nodesNamed(c, "option")
+				_, multiple := nodeAttr(c, "multiple")
+				var selected []string
+				for _, o := range options {
+					if _, sel := nodeAttr(o, "selected"); sel {
+						selected = append(selected, optionValue(o))
+					}
+				}
+				if len(selected) == 0 && !multiple && len(options) > 0 {
+					selected = []string{optionValue(options[0])}
+				}
+				if len(selected) > 1 && !multiple {
+					selected = selected[len(selected)-1:]
+				}
+				if len(selected) > 0 {
+					values[name] = append(values[name], selected...)
+				}
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(form)
+	return
+}
+
+// The value of an option: Its value attribute or its text.
+func optionValue(o *tag.Node) string {
+	if v, ok := nodeAttr(o, "value"); ok {
+		return v
+	}
+	return o.Text
+}
+
+// Set method, URL and parameters of test from the form selected by
+// test.Form on the last page received with global: The default values of
+// the form are sent unless the parameter is given in PARAM.  Like a
+// browser the first named submit button is sent as if the form was
+// submitted with Enter (unless PARAM contains one of the submit buttons).
+func fillForm(test, global *Test) error {
+	if global == nil || global.lastPage == nil {
+		return errors.New("No previous page to take the form from.")
+	}
+	last := global.lastPage
+	ts, err := formSpec(test.Form)
+	if err != nil {
+		return err
+	}
+	doc, err := tag.ParseHtml(string(last.body))
+	if err != nil {
+		return fmt.Errorf("Cannot parse %s: %s", last.url, err.Error())
+	}
+	form := tag.FindTag(ts, doc)
+	if form == nil {
+		return fmt.Errorf("No form '%s' on %s", test.Form, last.url)
+	}
+
+	base, err := url.Parse(last.url)
+	if err != nil {
+		return err
+	}
+	action, _ := nodeAttr(form, "action")
+	u, err := base.Parse(trim(action))
+	if err != nil {
+		return fmt.Errorf("Bad action '%s': %s", action, err.Error())
+	}
+	u.Fragment = ""
+
+	method, _ := nodeAttr(form, "method")
+	enctype, _ := nodeAttr(form, "enctype")
+	if strings.ToLower(method) == "post" {
+		test.Method = "POST"
+		if strings.ToLower(enctype) == "multipart/form-data" {
+			test.Method = "POST:mp"
+		}
+	} else {
+		test.Method = "GET"
+		u.RawQuery = "" // replaced by form data like browsers do
+	}
+	test.Url = u.String()
+
+	values, submit := formValues(form)
+	for k, v := range values {
+		if _, ok := test.Param[k]; !ok {
+			test.Param[k] = v
+		}
+	}
+	if len(submit) > 0 {
+		clicked := false
+		for _, s := range submit {
+			if _, ok := test.Param[s[0]]; ok {
+				clicked = true
+			}
+		}
+		if !clicked {
+			test.Param[submit[0][0]] = []string{submit[0][1]}
+		}
+	}
+	debugf("Form '%s' submits %s %s", test.Form, test.Method, test.Url)
+	return nil
+}
@@ -0,0 +1,125 @@
+package suite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const formPage = `<html><body>
+<form id="search" action="/search?old=1" class="small">
+  <input type="text" name="q" value="default">
+</form>
+<form id="login" name="login" class="wide box" method="post" action="login">
+  <input type="hidden" name="csrf" value="t0k3n">
+  <input type="text" name="user">
+  <input type="password" name="password" value="">
+  <input type="checkbox" name="remember" checked>
+  <input type="checkbox" name="news" value="yes">
+  <input type="radio" name="lang" value="de">
+  <input type="radio" name="lang" value="fr" checked>
+  <input type="text" name="off" value="x" disabled>
+  <select name="country"><option value="ch">Switzerland</option><option selected>Germany</option></select>
+  <select name="size"><option value="s">S</option><option value="m">M</option></select>
+  <textarea name="comment">Hello</textarea>
+  <div><input type="file" name="avatar"></div>
+  <button type="submit" name="action" value="login">Login</button>
+  <input type="submit" name="cancel" value="Cancel">
+</form>
+</body></html>`
+
+func TestFormSubmission(t *testing.T) {
+	var mu sync.Mutex
+	var got url.Values
+	var method string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dir/page":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, formPage)
+		default:
+			r.ParseForm()
+			mu.Lock()
+			got, method = r.Form, r.Method+" "+r.URL.Path
+			mu.Unlock()
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer ts.Close()
+
+	st := `
+----------
+Page
+----------
+GET ${URL}/dir/page
+
+----------
+Login
+----------
+FORM #login
+PARAM
+	user     :=  alice
+	comment  :=  "Hi there"
+
+----------
+Search
+----------
+FORM form id=search
+`
+	s, err := NewParser(strings.NewReader(strings.Replace(st, "${URL}", ts.URL, -1)), "form.wt").ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if s.Global == nil {
+		t.Fatalf("No global test to keep the last page")
+	}
+	s.RunTest(0)
+	s.RunTest(1)
+	if _, f, e := s.Test[1].Stat(); f+e > 0 {
+		t.Fatalf("Form submission failed: %s %v", s.Test[1].Status(), s.Test[1].Result)
+	}
+	want := url.Values{"csrf": {"t0k3n"}, "user": {"alice"}, "password": {""}, "remember": {"on"},
+		"lang": {"fr"}, "country": {"Germany"}, "size": {"s"}, "comment": {"Hi there"}, "action": {"login"}}
+	mu.Lock()
+	if method != "POST /dir/login" || got.Encode() != want.Encode() {
+		t.Errorf("Bad form submission %s\n got %s\nwant %s", method, got.Encode(), want.Encode())
+	}
+	mu.Unlock()
+
+	// the last page is now the "ok" of the login: no form there
+	s.RunTest(2)
+	if _, _, e := s.Test[2].Stat(); e == 0 {
+		t.Errorf("Missing error for missing form")
+	}
+	s.RunTest(0)
+	s.Test[2].Result = nil
+	s.RunTest(2)
+	mu.Lock()
+	if method != "GET /search" || got.Encode() != "q=default" {
+		t.Errorf("Bad GET form submission %s %s", method, got.Encode())
+	}
+	mu.Unlock()
+}
+
+func TestFormSpec(t *testing.T) {
+	for _, tc := range []struct{ sel, spec string }{
+		{"#login", "form id=login"},
+		{"form.wide.box", "form class=wide class=box"},
+		{"[name=login]", "form name=login"},
+		{"form#x[method='post']", "form id=x method=post"},
+	} {
+		spec, err := cssToTagSpec(tc.sel)
+		if err != nil || spec != tc.spec {
+			t.Errorf("%s: got %q (%v), want %q", tc.sel, spec, err, tc.spec)
+		}
+	}
+	for _, sel := range []string{"div id=x", "form > input", "#", "[name=x"} {
+		if _, err := formSpec(sel); err == nil {
+			t.Errorf("%s: Missing error", sel)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package suite
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// HTTP Archive (HAR 1.2) as written by the developer tools of browsers and
+// by proxies. Only the fields used by webtest are declared.
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []harCookie `json:"cookies"`
+	Headers     []harPair   `json:"headers"`
+	QueryString []harPair   `json:"queryString"`
+	PostData    *harPost    `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []harCookie `json:"cookies"`
+	Headers     []harPair   `json:"headers"`
+	Content     harContent  `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int         `json:"bodySize"`
+}
+
+type harPair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+type harPost struct {
+	MimeType string     `json:"mimeType"`
+	Params   []harParam `json:"params,omitempty"`
+	Text     string     `json:"text"`
+}
+
+type harParam struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// Request header fields not taken over into imported tests: They are set
+// by webtest itself (cookies, body, encoding) or would make the test
+// depend on the state of the browser cache.
+var harSkipHeader = map[string]bool{
+	"host": true, "content-length": true, "connection": true, "cookie": true,
+	"accept-encoding": true, "if-none-match": true, "if-modified-since": true,
+	"upgrade-insecure-requests": true,
+}
+
+// Check if a response of content type ct is a static resource like images,
+// stylesheets, scripts and fonts.
+func isStatic(ct string) bool {
+	ct = strings.ToLower(ct)
+	return hp(ct, "image/") || hp(ct, "font/") || hp(ct, "text/css") ||
+		strings.Contains(ct, "javascript") || hp(ct, "video/") || hp(ct, "audio/")
+}
+
+// Mime type of content type ct without parameters.
+func mimeType(ct string) string {
+	if i := strings.Index(ct, ";"); i != -1 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(trim(ct))
+}
+
+// ImportHAR converts the HTTP Archive read from r into a suite: Each request
+// becomes a test with method, URL, header, parameters, request body and
+// cookies and conditions on the status code and content type of the
+// recorded response.  Scheme and host of the URLs are replaced by the
+// variables HOST, HOST2, ... set in the CONST section of the Global test.
+// Redirects followed by the browser are left to webtest (the final URL is
+// checked instead) and static resources (images, stylesheets, scripts and
+// fonts) are skipped unless static is set.
+func ImportHAR(r io.Reader, static bool) (s *Suite, err error) {
+	var har harFile
+	if err = json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, fmt.Errorf("Cannot read HAR: %s", err.Error())
+	}
+
+	s = NewSuite()
+	s.Global = NewTest("Global")
+	hosts := make(map[string]string) // scheme://host to name of variable
+	titles := make(map[string]int)
+	followed := "" // redirect target followed by the previous test
+	for _, e := range har.Log.Entries {
+		req, resp := e.Request, e.Response
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			debugf("Skipping %s %s", req.Method, req.URL)
+			continue
+		}
+		if followed != "" && req.Method == "GET" && req.URL == followed {
+			followed = ""
+			continue
+		}
+		followed = ""
+		if !static && isStatic(resp.Content.MimeType) {
+			continue
+		}
+		method := strings.ToUpper(req.Method)
+		if method != "GET" && method != "POST" && !isRequestLine(method+" ") {
+			warnf("Cannot import %s request to %s.", req.Method, req.URL)
+			continue
+		}
+
+		origin := u.Scheme + "://" + u.Host
+		name, ok := hosts[origin]
+		if !ok {
+			name = "HOST"
+			if len(hosts) > 0 {
+				name = fmt.Sprintf("HOST%d", len(hosts)+1)
+			}
+			hosts[origin] = name
+			s.Global.Const[name] = origin
+		}
+
+		title := method + " " + u.Path
+		if titles[title]++; titles[title] > 1 {
+			title = fmt.Sprintf("%s (%d)", title, titles[title])
+		}
+		t := NewTest(title)
+		t.Method = method
+		t.Url = "${" + name + "}" + u.EscapedPath()
+		if u.RawQuery != "" {
+			switch method {
+			case "GET", "HEAD", "DELETE", "OPTIONS":
+				// query is sent from the parameters
+				if query, err := url.ParseQuery(u.RawQuery); err == nil {
+					t.Param = query
+				} else {
+					t.Url += "?" + u.RawQuery
+				}
+			default:
+				t.Url += "?" + u.RawQuery
+			}
+		}
+
+		bodyIsParam := false
+		if pd := req.PostData; pd != nil {
+			switch mt := mimeType(pd.MimeType); mt {
+			case "application/x-www-form-urlencoded":
+				bodyIsParam = true
+				values, err := url.ParseQuery(pd.Text)
+				if pd.Text == "" || err != nil {
+					values = make(url.Values)
+					for _, p := range pd.Params {
+						values.Add(p.Name, p.Value)
+					}
+				}
+				for k, v := range values {
+					t.Param[k] = append(t.Param[k], v...)
+				}
+			case "multipart/form-data":
+				bodyIsParam = true
+				if method == "POST" {
+					t.Method = "POST:mp"
+				}
+				for _, p := range pd.Params {
+					v := p.Value
+					if p.FileName != "" {
+						v = "@file:" + p.FileName
+					}
+					t.Param[p.Name] = append(t.Param[p.Name], v)
+				}
+			default:
+				t.SendBody = pd.Text
+			}
+		}
+
+		for _, h := range req.Headers {
+			n := strings.ToLower(h.Name)
+			if harSkipHeader[n] || hp(n, ":") || (n == "content-type" && bodyIsParam) {
+				continue
+			}
+			t.Header[http.CanonicalHeaderKey(h.Name)] = h.Value
+		}
+		for _, c := range req.Cookies {
+			t.Jar.Update(http.Cookie{Name: c.Name, Value: c.Value, Domain: "{CURRENT}", Path: "/"}, "")
+		}
+
+		if shouldRedirect(resp.Status) {
+			if target, err := u.Parse(resp.RedirectURL); err == nil && resp.RedirectURL != "" {
+				followed = target.String()
+				final := followed
+				if n, ok := hosts[target.Scheme+"://"+target.Host]; ok {
+					final = "${" + n + "}" + strings.TrimPrefix(final, target.Scheme+"://"+target.Host)
+				}
+				t.RespCond = append(t.RespCond, Condition{Key: "Final-Url", Op: "==", Val: final})
+			}
+		} else if resp.Status > 0 {
+			t.RespCond = append(t.RespCond, Condition{Key: "Status-Code", Op: "==",
+				Val: fmt.Sprintf("%d", resp.Status)})
+			if mt := mimeType(resp.Content.MimeType); mt != "" {
+				t.RespCond = append(t.RespCond, Condition{Key: "Content-Type", Op: "_=", Val: mt})
+			}
+		}
+		s.Test = append(s.Test, *t)
+	}
+	return s, nil
+}
+
+// HARRecorder records the requests sent and the responses received as an
+// HTTP Archive.
+type HARRecorder struct {
+	mutex sync.Mutex
+	har   harFile
+}
+
+// Recorder records all requests and responses if non nil.
+var Recorder *HARRecorder
+
+// NewHARRecorder sets up an empty recorder.
+func NewHARRecorder() *HARRecorder {
+	rec := new(HARRecorder)
+	rec.har.Log.Version = "1.2"
+	rec.har.Log.Creator = harCreator{Name: "webtest", Version: "1.0"}
+	rec.har.Log.Entries = []harEntry{}
+	return rec
+}
+
+// Header h as list of name/value pairs sorted by name.
+func harHeader(h http.Header) []harPair {
+	pairs := []harPair{}
+	for name, values := range h {
+		for _, v := range values {
+			pairs = append(pairs, harPair{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+	return pairs
+}
+
+// Cookies as list of HAR cookies.
+func harCookies(cookies []*http.Cookie) []harCookie {
+	list := []harCookie{}
+	for _, c := range cookies {
+		list = append(list, harCookie{Name: c.Name, Value: c.Value, Path: c.Path,
+			Domain: c.Domain, HTTPOnly: c.HttpOnly, Secure: c.Secure})
+	}
+	return list
+}
+
+// Milliseconds in d.
+func harMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Record the request req with body reqBody started at start and the
+// response resp with body respBody received after d.
+func (rec *HARRecorder) record(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte,
+	start time.Time, d time.Duration) {
+	e := harEntry{StartedDateTime: start.Format(time.RFC3339Nano), Time: harMillis(d)}
+	e.Request = harRequest{Method: req.Method, URL: req.URL.String(), HTTPVersion: req.Proto,
+		Cookies: harCookies(req.Cookies()), Headers: harHeader(req.Header),
+		QueryString: []harPair{}, HeadersSize: -1, BodySize: len(reqBody)}
+	query := req.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range query[name] {
+			e.Request.QueryString = append(e.Request.QueryString, harPair{Name: name, Value: v})
+		}
+	}
+	if len(reqBody) > 0 {
+		e.Request.PostData = &harPost{MimeType: req.Header.Get("Content-Type"), Text: string(reqBody)}
+	}
+
+	e.Response = harResponse{Status: resp.StatusCode, StatusText: http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto, Cookies: harCookies(resp.Cookies()), Headers: harHeader(resp.Header),
+		RedirectURL: resp.Header.Get("Location"), HeadersSize: -1, BodySize: len(respBody)}
+	e.Response.Content = harContent{Size: len(respBody), MimeType: resp.Header.Get("Content-Type")}
+	if utf8.Valid(respBody) {
+		e.Response.Content.Text = string(respBody)
+	} else {
+		e.Response.Content.Text = base64.StdEncoding.EncodeToString(respBody)
+		e.Response.Content.Encoding = "base64"
+	}
+	e.Timings = harTimings{Send: 0, Wait: harMillis(d), Receive: 0}
+
+	rec.mutex.Lock()
+	rec.har.Log.Entries = append(rec.har.Log.Entries, e)
+	rec.mutex.Unlock()
+}
+
+// Write the recorded requests and responses as HAR to w.
+func (rec *HARRecorder) Write(w io.Writer) error {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rec.har)
+}
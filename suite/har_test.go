@@ -0,0 +1,167 @@
+package suite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const harCapture = `{"log": {"version": "1.2", "creator": {"name": "Firefox", "version": "120"}, "entries": [
+ {"request": {"method": "GET", "url": "${URL}/search?q=red+shoes", "httpVersion": "HTTP/1.1",
+   "headers": [{"name": "Host", "value": "shop"}, {"name": "Accept", "value": "text/html"},
+     {"name": "If-None-Match", "value": "\"x\""}, {"name": "Cookie", "value": "sid=abc"}],
+   "cookies": [{"name": "sid", "value": "abc"}], "queryString": [{"name": "q", "value": "red shoes"}]},
+  "response": {"status": 200, "content": {"mimeType": "text/html; charset=utf-8"}, "redirectURL": ""}},
+ {"request": {"method": "GET", "url": "${URL}/logo.png", "headers": []},
+  "response": {"status": 200, "content": {"mimeType": "image/png"}}},
+ {"request": {"method": "POST", "url": "${URL}/login", "headers": [{"name": "Content-Type", "value": "application/x-www-form-urlencoded"}],
+   "postData": {"mimeType": "application/x-www-form-urlencoded", "text": "user=alice&pw=s%26cret"}},
+  "response": {"status": 302, "content": {"mimeType": ""}, "redirectURL": "/account"}},
+ {"request": {"method": "GET", "url": "${URL}/account", "headers": []},
+  "response": {"status": 200, "content": {"mimeType": "text/plain"}}},
+ {"request": {"method": "PUT", "url": "${URL}/cart/7?notify=1", "headers": [{"name": "Content-Type", "value": "application/json"}],
+   "postData": {"mimeType": "application/json", "text": "{\n  \"qty\": 2\n}"}},
+  "response": {"status": 204, "content": {"mimeType": ""}}},
+ {"request": {"method": "DELETE", "url": "http://other.example.com/cart/7", "headers": []},
+  "response": {"status": 200, "content": {"mimeType": "text/plain"}}},
+ {"request": {"method": "CONNECT", "url": "${URL}/", "headers": []},
+  "response": {"status": 200, "content": {"mimeType": "text/plain"}}}
+]}}`
+
+func TestImportHAR(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := r.Cookie("sid")
+		mu.Lock()
+		seen = append(seen, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/search":
+			if r.FormValue("q") != "red shoes" || c == nil || c.Value != "abc" ||
+				r.Header.Get("Accept") != "text/html" || r.Header.Get("If-None-Match") != "" {
+				http.Error(w, "bad search", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html></html>"))
+		case "/login":
+			if r.Method != "POST" || r.PostFormValue("pw") != "s&cret" {
+				http.Error(w, "bad login", http.StatusForbidden)
+				return
+			}
+			http.Redirect(w, r, "/account", http.StatusFound)
+		case "/account":
+			w.Write([]byte("account"))
+		case "/cart/7":
+			body, _ := ioutil.ReadAll(r.Body)
+			if r.Method != "PUT" || r.Header.Get("Content-Type") != "application/json" ||
+				string(body) != "{\n  \"qty\": 2\n}" || r.URL.RawQuery != "notify=1" {
+				http.Error(w, "bad cart update", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	s, err := ImportHAR(strings.NewReader(strings.Replace(harCapture, "${URL}", ts.URL, -1)), false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if s.Global.Const["HOST"] != ts.URL || s.Global.Const["HOST2"] != "http://other.example.com" {
+		t.Errorf("Bad host variables %v", s.Global.Const)
+	}
+	var titles []string
+	for _, test := range s.Test {
+		titles = append(titles, test.Title)
+	}
+	if got := strings.Join(titles, "|"); got != "GET /search|POST /login|PUT /cart/7|DELETE /cart/7" {
+		t.Fatalf("Bad tests imported: %s", got)
+	}
+
+	// The imported suite must be readable and run against the server.
+	text := s.String()
+	s, err = NewParser(strings.NewReader(text), "har.wt").ReadSuite()
+	if err != nil {
+		t.Fatalf("Cannot read imported suite: %s\n%s", err.Error(), text)
+	}
+	for i := 0; i < 3; i++ {
+		s.RunTest(i)
+		if _, f, e := s.Test[i].Stat(); f+e > 0 {
+			t.Errorf("Test %s failed:\n%v\n%s", s.Test[i].Title, s.Test[i].Result, text)
+		}
+	}
+	mu.Lock()
+	if got := strings.Join(seen, "|"); got != "GET /search|POST /login|GET /account|PUT /cart/7" {
+		t.Errorf("Bad requests %s", got)
+	}
+	mu.Unlock()
+
+	if _, err = ImportHAR(strings.NewReader("{"), false); err == nil {
+		t.Errorf("Missing error for malformed HAR")
+	}
+}
+
+func TestSendBody(t *testing.T) {
+	st := "----------\nT\n----------\nPATCH http://x.org/a\nSEND-BODY\n\t{\n\t\t\"a\": 1\n\n\t}\n\nHEADER\n\tX  :=  1\n"
+	s, err := NewParser(strings.NewReader(st), "body.wt").ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	test := s.Test[0]
+	if test.Method != "PATCH" || test.SendBody != "{\n\t\"a\": 1\n\n}" || test.Header["X"] != "1" {
+		t.Errorf("Bad test read: %q %q %v", test.Method, test.SendBody, test.Header)
+	}
+	if !strings.Contains(test.String(), "SEND-BODY\n\t{\n\t\t\"a\": 1\n\t\n\t}\n") {
+		t.Errorf("Bad string representation:\n%s", test.String())
+	}
+}
+
+func TestHARRecorder(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.Redirect(w, r, "/home", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("home"))
+	}))
+	defer ts.Close()
+
+	st := "----------\nLogin\n----------\nPOST " + ts.URL + "/login\nPARAM\n\tuser  :=  alice\n"
+	s, err := NewParser(strings.NewReader(st), "rec.wt").ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	Recorder = NewHARRecorder()
+	defer func() { Recorder = nil }()
+	s.RunTest(0)
+
+	var buf bytes.Buffer
+	if err = Recorder.Write(&buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	har := buf.String()
+	for _, want := range []string{`"method": "POST"`, `"text": "user=alice"`, `"status": 302`,
+		`"redirectURL": "/home"`, `"method": "GET"`, `"text": "home"`} {
+		if !strings.Contains(har, want) {
+			t.Errorf("Missing %s in\n%s", want, har)
+		}
+	}
+
+	// The recorded HAR can be imported again.
+	s, err = ImportHAR(strings.NewReader(har), false)
+	if err != nil {
+		t.Fatalf("Cannot import recorded HAR: %s", err.Error())
+	}
+	if len(s.Test) != 1 || s.Test[0].Method != "POST" || s.Test[0].Param["user"][0] != "alice" {
+		t.Errorf("Bad import of recorded HAR:\n%s", s.String())
+	}
+}
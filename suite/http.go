@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/http"
@@ -154,6 +155,28 @@ var nonfollowingClient http.Client = http.Client{
 	},
 }
 
+// Send req with the nonfollowingClient. Request and response are recorded
+// if a HAR is recorded (see Recorder).
+func send(req *http.Request) (*http.Response, error) {
+	if Recorder == nil {
+		return nonfollowingClient.Do(req)
+	}
+	var body []byte
+	if req.GetBody != nil {
+		if rc, err := req.GetBody(); err == nil {
+			body = readBody(rc)
+		}
+	}
+	start := time.Now()
+	r, err := nonfollowingClient.Do(req)
+	if r != nil {
+		respBody := readBody(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+		Recorder.record(req, body, r, respBody, start, time.Since(start))
+	}
+	return r, err
+}
+
 func redirectChecker(req *http.Request, via []*http.Request) error {
 	if len(via) >= 10 {
 		return errors.New("stopped after 10 redirects")
@@ -178,6 +201,9 @@ func DoAndFollow(ireq *http.Request, t *Test) (r *http.Response, finalUrl string
 		if redirect != 0 {
 			req = new(http.Request)
 			req.Method = ireq.Method
+			if r.StatusCode != http.StatusTemporaryRedirect && req.Method != "HEAD" {
+				req.Method = "GET" // like browsers do (the body is not resent anyway)
+			}
 			req.Header = make(http.Header)
 			req.URL, err = base.Parse(urlStr)
 			if err != nil {
@@ -198,9 +224,8 @@ func DoAndFollow(ireq *http.Request, t *Test) (r *http.Response, finalUrl string
 			}
 
 		}
-		dumpReq(req, t.Dump)
 		urlStr = req.URL.String()
-		if r, err = nonfollowingClient.Do(req); err != nil {
+		if r, err = doAuthorized(req, t, redirectAuth(ireq, req, t.Auth)); err != nil {
 			if strings.HasSuffix(err.Error(), "WE DONT FOLLOW") {
 				err = nil
 			} else {
@@ -236,7 +261,7 @@ func DoAndFollow(ireq *http.Request, t *Test) (r *http.Response, finalUrl string
 
 	method := ireq.Method
 	err = &url.Error{
-		OP:  method[0:1] + strings.ToLower(method[1:]),
+		Op:  method[0:1] + strings.ToLower(method[1:]),
 		URL: urlStr,
 		Err: err,
 	}
@@ -244,10 +269,32 @@ func DoAndFollow(ireq *http.Request, t *Test) (r *http.Response, finalUrl string
 
 }
 
-// Perform a GET request for the test t.
-func Get(t *Test) (r *http.Response, finalUrl string, cookies []*http.Cookie, err error) {
-	var testurl = t.Url // <-- Patched
+// Perform the request of test t: Parameters of GET, HEAD, DELETE and OPTIONS
+// requests are sent in the URL, those of other methods in the body unless
+// the test has a SEND-BODY.
+func Do(t *Test) (r *http.Response, finalUrl string, cookies []*http.Cookie, err error) {
+	req, err := newRequest(t)
+	if err != nil {
+		return
+	}
+	return DoAndFollow(req, t)
+}
+
+// The request for test t (see Do) without header fields and cookies which
+// are added by DoAndFollow.
+func newRequest(t *Test) (*http.Request, error) {
+	switch t.Method {
+	case "GET", "HEAD", "DELETE", "OPTIONS":
+		if t.SendBody == "" {
+			return getRequest(t)
+		}
+	}
+	return postRequest(t)
+}
 
+// URL of test t with the parameters added as query.
+func urlWithParams(t *Test) string {
+	testurl := t.Url
 	if len(t.Param) > 0 {
 		values := make(url.Values)
 		for k, vs := range t.Param {
@@ -263,17 +310,32 @@ func Get(t *Test) (r *http.Response, finalUrl string, cookies []*http.Cookie, er
 			testurl = testurl + "?" + ep
 		}
 	}
+	return testurl
+}
 
-	req, err := http.NewRequest("GET", testurl, nil)
+// Perform a GET (or HEAD, DELETE or OPTIONS) request for the test t.
+func Get(t *Test) (r *http.Response, finalUrl string, cookies []*http.Cookie, err error) {
+	req, err := getRequest(t)
 	if err != nil {
 		return
 	}
-
-	debugf("Will get from %s", req.URL.String())
 	r, finalUrl, cookies, err = DoAndFollow(req, t)
 	return
 }
 
+// The GET (or HEAD, DELETE or OPTIONS) request for test t.
+func getRequest(t *Test) (*http.Request, error) {
+	method := t.Method
+	if method == "" {
+		method = "GET"
+	}
+	req, err := http.NewRequest(method, urlWithParams(t), nil)
+	if err == nil {
+		debugf("Will get from %s", req.URL.String())
+	}
+	return req, err
+}
+
 // Return true if the parameters contain a file
 func hasFile(param *map[string][]string) bool {
 	for _, v := range *param {
@@ -358,9 +420,34 @@ func multipartBody(param *map[string][]string) (*bytes.Buffer, string) {
 //
 // Caller should close r.Body when done reading from it.
 func Post(t *Test) (r *http.Response, finalUrl string, cookies []*http.Cookie, err error) {
+	req, err := postRequest(t)
+	if err != nil {
+		return
+	}
+	r, finalUrl, cookies, err = DoAndFollow(req, t)
+	return
+}
+
+// The POST (or PUT, PATCH or other request with a body) for test t.
+func postRequest(t *Test) (req *http.Request, err error) {
 	var body *bytes.Buffer
 	var contentType string
-	if hasFile(&t.Param) || t.Method == "POST:mp" {
+	method, testurl := strings.TrimSuffix(t.Method, ":mp"), t.Url
+	if t.SendBody != "" {
+		// parameters go to the URL, the body is sent as is
+		testurl = urlWithParams(t)
+		contentType = "application/octet-stream"
+		if ct, ok := t.Header["Content-Type"]; ok {
+			contentType = ct
+		}
+		data := []byte(t.SendBody)
+		if hp(t.SendBody, "@file:") {
+			if data, err = ioutil.ReadFile(trim(t.SendBody[6:])); err != nil {
+				return
+			}
+		}
+		body = bytes.NewBuffer(data)
+	} else if hasFile(&t.Param) || t.Method == "POST:mp" {
 		var boundary string
 		body, boundary = multipartBody(&t.Param)
 		contentType = "multipart/form-data; boundary=" + boundary
@@ -376,17 +463,13 @@ func Post(t *Test) (r *http.Response, finalUrl string, cookies []*http.Cookie, e
 		body = bytes.NewBuffer([]byte(bodystr))
 	}
 
-	req, err := http.NewRequest("POST", t.Url, body)
+	req, err = http.NewRequest(method, testurl, body)
 	if err != nil {
 		return
 	}
 
 	req.Header.Set("Content-Type", contentType)
-	addHeadersAndCookies(req, t)
-
-	debugf("Will post to %s", req.URL.String())
-
-	r, finalUrl, cookies, err = DoAndFollow(req, t)
+	debugf("Will %s to %s", strings.ToLower(method), req.URL.String())
 	return
 }
 
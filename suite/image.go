@@ -0,0 +1,264 @@
+package suite
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Check if key is a valid key in the IMAGE section. The keys PHash and
+// Diff must be followed by ":<reference image>".
+func validImageKey(key string) bool {
+	if i := strings.Index(key, ":"); i != -1 {
+		return (key[:i] == "PHash" || key[:i] == "Diff") && i < len(key)-1
+	}
+	switch key {
+	case "Format", "Width", "Height", "Color-Model", "Size":
+		return true
+	}
+	return false
+}
+
+// Names of the standard color models.
+var colorModelNames = []struct {
+	model color.Model
+	name  string
+}{
+	{color.RGBAModel, "RGBA"},
+	{color.RGBA64Model, "RGBA64"},
+	{color.NRGBAModel, "NRGBA"},
+	{color.NRGBA64Model, "NRGBA64"},
+	{color.AlphaModel, "Alpha"},
+	{color.Alpha16Model, "Alpha16"},
+	{color.GrayModel, "Gray"},
+	{color.Gray16Model, "Gray16"},
+	{color.YCbCrModel, "YCbCr"},
+	{color.CMYKModel, "CMYK"},
+}
+
+// Name of the color model of img.
+func colorModelName(img image.Image) string {
+	cm := img.ColorModel()
+	if _, ok := cm.(color.Palette); ok {
+		return "Paletted"
+	}
+	for _, c := range colorModelNames {
+		if c.model == cm {
+			return c.name
+		}
+	}
+	return fmt.Sprintf("%T", cm)
+}
+
+// Cache of decoded reference images.
+var referenceImages = map[string]image.Image{}
+var referenceImagesLock sync.Mutex
+
+// Load (and cache) the reference image stored in file.
+func referenceImage(file string) (img image.Image, err error) {
+	referenceImagesLock.Lock()
+	defer referenceImagesLock.Unlock()
+	if img, ok := referenceImages[file]; ok {
+		return img, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err = image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	referenceImages[file] = img
+	return img, nil
+}
+
+// Gray value (0..65535) of pixel (x,y) in img.
+func grayAt(img image.Image, x, y int) uint32 {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return (299*r + 587*g + 114*b) / 1000
+}
+
+// Perceptual difference hash of img: The image is scaled down to 9x8
+// gray pixels and each bit represents whether brightness increases
+// from left to right.
+func DHash(img image.Image) (hash uint64) {
+	const w, h = 9, 8
+	var gray [h][w]uint64
+	b := img.Bounds()
+	for j := 0; j < h; j++ {
+		y0 := b.Min.Y + j*b.Dy()/h
+		y1 := b.Min.Y + (j+1)*b.Dy()/h
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for i := 0; i < w; i++ {
+			x0 := b.Min.X + i*b.Dx()/w
+			x1 := b.Min.X + (i+1)*b.Dx()/w
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			var sum, n uint64
+			for y := y0; y < y1 && y < b.Max.Y; y++ {
+				for x := x0; x < x1 && x < b.Max.X; x++ {
+					sum += uint64(grayAt(img, x, y))
+					n++
+				}
+			}
+			if n > 0 {
+				gray[j][i] = sum / n
+			}
+		}
+	}
+
+	for j := 0; j < h; j++ {
+		for i := 0; i < w-1; i++ {
+			hash <<= 1
+			if gray[j][i] < gray[j][i+1] {
+				hash |= 1
+			}
+		}
+	}
+	return
+}
+
+// Number of different bits in a and b.
+func hammingDistance(a, b uint64) (d int) {
+	for x := a ^ b; x != 0; x &= x - 1 {
+		d++
+	}
+	return
+}
+
+// Mean difference of all color channels of all pixels of a and b in
+// percent. Both images must have the same size.
+func PixelDiff(a, b image.Image) (float64, error) {
+	ba, bb := a.Bounds(), b.Bounds()
+	if ba.Dx() != bb.Dx() || ba.Dy() != bb.Dy() {
+		return 0, fmt.Errorf("Size %dx%d differs from reference %dx%d",
+			ba.Dx(), ba.Dy(), bb.Dx(), bb.Dy())
+	}
+	if ba.Dx() == 0 || ba.Dy() == 0 {
+		return 0, nil
+	}
+	abs := func(x, y uint32) float64 {
+		if x > y {
+			return float64(x - y)
+		}
+		return float64(y - x)
+	}
+	var sum float64
+	for y := 0; y < ba.Dy(); y++ {
+		for x := 0; x < ba.Dx(); x++ {
+			r1, g1, b1, a1 := a.At(ba.Min.X+x, ba.Min.Y+y).RGBA()
+			r2, g2, b2, a2 := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			sum += abs(r1, r2) + abs(g1, g2) + abs(b1, b2) + abs(a1, a2)
+		}
+	}
+	return 100 * sum / (4 * 65535 * float64(ba.Dx()*ba.Dy())), nil
+}
+
+// Compare two floats a and b according to op.
+func compareFloat(a float64, op string, b float64) bool {
+	switch op {
+	case "==":
+		return a == b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	}
+	return false
+}
+
+// Perform the image checks on body.
+func testImage(body []byte, t, orig *Test) {
+	if len(t.ImageCond) > 0 {
+		debugf("Testing Image")
+	} else {
+		return
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		orig.Error("Image", "Undecodable image", err.Error())
+		return
+	}
+	b := img.Bounds()
+
+	for _, c := range t.ImageCond {
+		cs := c.Info("image")
+		var v string
+		key, ref := c.Key, ""
+		if i := strings.Index(key, ":"); i != -1 {
+			key, ref = key[:i], key[i+1:]
+		}
+		switch key {
+		case "Format":
+			v = format
+		case "Width":
+			v = strconv.Itoa(b.Dx())
+		case "Height":
+			v = strconv.Itoa(b.Dy())
+		case "Color-Model":
+			v = colorModelName(img)
+		case "Size":
+			v = strconv.Itoa(len(body))
+		case "PHash", "Diff":
+			if !path.IsAbs(ref) && c.dir != "" {
+				ref = path.Join(c.dir, ref)
+			}
+			refImg, err := referenceImage(ref)
+			if err != nil {
+				orig.Error(c.Id, "Bad reference image", err.Error())
+				continue
+			}
+			if key == "PHash" {
+				v = strconv.Itoa(hammingDistance(DHash(img), DHash(refImg)))
+				break
+			}
+			diff, err := PixelDiff(img, refImg)
+			if err != nil {
+				orig.Failed(c.Id, "Image Failed",
+					fmt.Sprintf("%s\nTesting for %s\nBut: %s", c.Id, c.String(), err.Error()))
+				continue
+			}
+			lim, err := strconv.ParseFloat(c.Val, 64)
+			if err != nil {
+				orig.Error(c.Id, "Bad test", "Cannot parse limit: "+err.Error())
+				continue
+			}
+			if compareFloat(diff, c.Op, lim) != c.Neg {
+				orig.Passed(cs)
+			} else {
+				orig.Failed(c.Id, "Image Failed",
+					fmt.Sprintf("%s\nTesting for %s\nBut got: %.3f%%", c.Id, c.String(), diff))
+			}
+			continue
+		default:
+			errorf("Unkown image condition '%s' (%s). Ignored.", c.Key, c.Id)
+			continue
+		}
+
+		if ok, _ := c.Fullfilled(v); ok {
+			orig.Passed(cs)
+		} else {
+			orig.Failed(c.Id, "Image Failed",
+				fmt.Sprintf("%s\nTesting for %s\nBut got: %s", c.Id, c.String(), v))
+		}
+	}
+}
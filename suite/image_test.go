@@ -0,0 +1,130 @@
+package suite
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// A w x h gradient image, brightness increasing from left to right.
+func gradient(w, h int, shift uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			g := uint8(x*200/w) + shift
+			img.Set(x, y, color.RGBA{g, g, g, 255})
+		}
+	}
+	return img
+}
+
+func encodePng(img image.Image, t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		t.Fatalf("Cannot encode png: %s", err.Error())
+	}
+	return buf.Bytes()
+}
+
+func TestDHash(t *testing.T) {
+	a, b := gradient(90, 80, 0), gradient(180, 160, 10)
+	if d := hammingDistance(DHash(a), DHash(b)); d != 0 {
+		t.Errorf("Scaled and brightened gradient: expected distance 0, got %d", d)
+	}
+	c := gradient(90, 80, 0)
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 90; x++ {
+			g := uint8(200 - x*200/90)
+			c.Set(x, y, color.RGBA{g, g, g, 255})
+		}
+	}
+	if d := hammingDistance(DHash(a), DHash(c)); d < 32 {
+		t.Errorf("Inverted gradient: expected large distance, got %d", d)
+	}
+}
+
+func TestPixelDiff(t *testing.T) {
+	a, b := gradient(10, 10, 0), gradient(10, 10, 0)
+	if d, err := PixelDiff(a, b); err != nil || d != 0 {
+		t.Errorf("Expected 0, got %f (%v)", d, err)
+	}
+	b.Set(0, 0, color.RGBA{255, 255, 255, 255})
+	if d, err := PixelDiff(a, b); err != nil || d < 0.7 || d > 0.8 {
+		t.Errorf("Expected 0.75%%, got %f (%v)", d, err)
+	}
+	if _, err := PixelDiff(a, gradient(10, 11, 0)); err == nil {
+		t.Errorf("Missing error for different sizes")
+	}
+}
+
+func TestImageConditions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webtest-image")
+	if err != nil {
+		t.Fatalf("Cannot create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	ref := encodePng(gradient(32, 16, 0), t)
+	if err := ioutil.WriteFile(path.Join(dir, "ref.png"), ref, 0644); err != nil {
+		t.Fatalf("Cannot write reference image: %s", err.Error())
+	}
+
+	st := `
+----------------
+Image
+----------------
+GET http://localhost/thumb.png
+IMAGE
+	Format          ==  png
+	Width           ==  32
+	Height          <   20
+	Color-Model     ==  RGBA
+	Size            <   10000
+	PHash:ref.png   <=  2
+	Diff:ref.png    <   0.5
+	!Width          >   100
+`
+	p := NewParser(strings.NewReader(st), "image.wt")
+	p.Dir = dir
+	s, err := p.ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	test := &s.Test[0]
+	if len(test.ImageCond) != 8 {
+		t.Fatalf("Expected 8 conditions, got %d", len(test.ImageCond))
+	}
+	if key := test.ImageCond[5].Key; key != "PHash:ref.png" {
+		t.Errorf("Expected key PHash:ref.png as written, got %s", key)
+	}
+
+	testImage(ref, test, test)
+	for _, r := range test.Result {
+		if r.Status != TestPassed {
+			t.Errorf("Unexpected %s: %s %s", r.Status, r.Cause, r.Message)
+		}
+	}
+
+	// A slightly larger image
+	test.Result = nil
+	testImage(encodePng(gradient(33, 16, 0), t), test, test)
+	failed := 0
+	for _, r := range test.Result {
+		if r.Status != TestPassed {
+			failed++
+		}
+	}
+	if failed != 2 { // Width and Diff
+		t.Errorf("Expected 2 failures, got %d: %v", failed, test.Result)
+	}
+
+	p = NewParser(strings.NewReader(st+"\tDepth == 3\n"), "image.wt")
+	if _, err = p.ReadSuite(); err == nil {
+		t.Errorf("Missing error for unknown key")
+	}
+}
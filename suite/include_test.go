@@ -0,0 +1,149 @@
+package suite
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webtest-include")
+	if err != nil {
+		t.Fatalf("Cannot create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) {
+		os.MkdirAll(path.Dir(path.Join(dir, name)), 0755)
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Cannot write %s: %s", name, err.Error())
+		}
+	}
+	write("shared/common.wt", `# shared global and login
+----------
+Global
+----------
+GET http://localhost/
+HEADER
+	User-Agent  :=  webtest
+	Accept      :=  text/html
+CONST
+	HOST  :=  localhost
+	USER  :=  alice
+
+INCLUDE login.wt
+`)
+	write("shared/login.wt", `----------
+Login
+----------
+POST http://localhost/login
+PARAM
+	user  :=  ${USER}
+`)
+	write("shared/broken.wt", `----------
+Broken
+----------
+GET http://localhost/
+RESPONSE
+	Status-Code  ??  200
+`)
+	write("shared/loop.wt", "INCLUDE ../loop.wt\n")
+	write("loop.wt", "INCLUDE shared/loop.wt\n")
+
+	st := `INCLUDE shared/common.wt
+
+----------
+Global
+----------
+GET http://localhost/
+HEADER
+	Accept  :=  application/json
+CONST
+	USER  :=  bob
+
+----------
+Search
+----------
+GET http://localhost/search
+`
+	p := NewParser(strings.NewReader(st), "main.wt")
+	p.Dir = dir
+	s, err := p.ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(s.Test) != 2 || s.Test[0].Title != "Login" || s.Test[1].Title != "Search" {
+		t.Fatalf("Bad tests %v", s.Test)
+	}
+	g := s.Global
+	if g.Header["User-Agent"] != "webtest" || g.Header["Accept"] != "application/json" ||
+		g.Const["HOST"] != "localhost" || g.Const["USER"] != "bob" {
+		t.Errorf("Bad merged global: %v %v", g.Header, g.Const)
+	}
+
+	for _, tc := range []struct{ include, want string }{
+		{"shared/broken.wt", path.Join(dir, "shared/broken.wt") + ":6: "},
+		{"shared/loop.wt", path.Join(dir, "loop.wt") + ":1: Cyclic include of 'shared/loop.wt'"},
+		{"missing.wt", "main.wt:1: Cannot include 'missing.wt'"},
+	} {
+		p = NewParser(strings.NewReader("INCLUDE "+tc.include+"\n"), "main.wt")
+		p.Dir = dir
+		_, err = p.ReadSuite()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Include %s: Got error %v, want %q", tc.include, err, tc.want)
+		}
+	}
+}
+
+func TestIncludedGlobalsOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webtest-include")
+	if err != nil {
+		t.Fatalf("Cannot create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+	common := "----------\nGlobal\n----------\nGET http://localhost/\nCONST\n\tHOST  :=  localhost\n\tUSER  :=  alice\n"
+	if err := ioutil.WriteFile(path.Join(dir, "common.wt"), []byte(common), 0644); err != nil {
+		t.Fatalf("Cannot write common.wt: %s", err.Error())
+	}
+
+	// Only the first test of the suite itself is its Global, a later test
+	// named Global is a normal test.
+	for _, include := range []string{"", "INCLUDE common.wt\n"} {
+		st := include + `
+----------
+Global
+----------
+GET http://localhost/
+CONST
+	USER  :=  bob
+
+----------
+Search
+----------
+GET http://localhost/search
+
+----------
+Global
+----------
+GET http://localhost/global
+CONST
+	USER  :=  carol
+`
+		p := NewParser(strings.NewReader(st), "main.wt")
+		p.Dir = dir
+		s, err := p.ReadSuite()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		if len(s.Test) != 2 || s.Test[0].Title != "Search" || s.Test[1].Title != "Global" {
+			t.Errorf("%q: Bad tests %v", include, s.Test)
+		}
+		if s.Global.Const["USER"] != "bob" {
+			t.Errorf("%q: Bad global %v", include, s.Global.Const)
+		}
+		if _, ok := s.Global.Const["HOST"]; ok != (include != "") {
+			t.Errorf("%q: Bad merge of included global %v", include, s.Global.Const)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package suite
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vdobler/webtest/stat"
+)
+
+// LiveMetrics collects live numbers of running stresstests and benchmarks
+// if non nil (see Metrics).
+var LiveMetrics *Metrics
+
+// Length in seconds of the sliding window used to compute request rates.
+const rateWindow = 10
+
+// Metrics of one test.
+type testMetrics struct {
+	requests, failures, errors int64
+	rt                         *stat.Histogram // response times in µs
+	window                     [rateWindow]int64
+	last                       int64 // second of last request
+}
+
+// Number of requests in the last rateWindow seconds before now.
+func (tm *testMetrics) recent(now int64) (n int64) {
+	for s := now - rateWindow + 1; s <= now; s++ {
+		if s > tm.last-rateWindow && s <= tm.last {
+			n += tm.window[s%rateWindow]
+		}
+	}
+	return
+}
+
+// Metrics collects live numbers (load, requests, errors, failures and
+// response times per test) of a running stresstest or benchmark, e.g. to
+// expose them for monitoring. Metrics is safe for concurrent use.
+type Metrics struct {
+	mutex sync.Mutex
+	start time.Time
+	load  int
+	tests map[string]*testMetrics // keyed by kind + "\x00" + title
+}
+
+// NewMetrics sets up empty metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{start: time.Now(), tests: make(map[string]*testMetrics)}
+}
+
+// SetLoad sets the current background load. Nil metrics are ignored.
+func (m *Metrics) SetLoad(load int) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	m.load = load
+	m.mutex.Unlock()
+}
+
+// Record one request of the test with the given title. kind is one of
+// "test", "background" or "bench". Nil metrics are ignored.
+func (m *Metrics) Record(kind, title string, rt time.Duration, failed, errored bool) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := kind + "\x00" + title
+	tm, ok := m.tests[key]
+	if !ok {
+		tm = &testMetrics{rt: stat.NewHistogram()}
+		m.tests[key] = tm
+	}
+	tm.requests++
+	if failed {
+		tm.failures++
+	}
+	if errored {
+		tm.errors++
+	}
+	tm.rt.Record(int64(rt / time.Microsecond))
+
+	now := time.Now().Unix()
+	if now-tm.last >= rateWindow {
+		tm.window = [rateWindow]int64{}
+	} else {
+		for s := tm.last + 1; s <= now; s++ {
+			tm.window[s%rateWindow] = 0
+		}
+	}
+	tm.window[now%rateWindow]++
+	tm.last = now
+}
+
+// LiveStat are the current numbers of one test (see Metrics).
+type LiveStat struct {
+	Kind     string  // "test", "background" or "bench"
+	Title    string  // title of the test
+	Requests int64   // total number of requests
+	Failures int64   // number of requests with failed conditions
+	Errors   int64   // number of errored requests
+	RPS      float64 // requests per second during the last 10 seconds
+	P50      float64 // median response time in ms
+	P90      float64 // 90% percentile of response time in ms
+	P99      float64 // 99% percentile of response time in ms
+	Max      float64 // maximum response time in ms
+	SumRT    float64 // sum of all response times in s
+}
+
+// Snapshot returns the current load, the uptime and the numbers of all
+// tests sorted by kind and title.
+func (m *Metrics) Snapshot() (load int, uptime time.Duration, tests []LiveStat) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := time.Now()
+	uptime = now.Sub(m.start)
+	window := float64(rateWindow)
+	if s := uptime.Seconds(); s < window {
+		window = s
+	}
+	if window < 1 {
+		window = 1
+	}
+	for key, tm := range m.tests {
+		i := strings.Index(key, "\x00")
+		tests = append(tests, LiveStat{
+			Kind:     key[:i],
+			Title:    key[i+1:],
+			Requests: tm.requests,
+			Failures: tm.failures,
+			Errors:   tm.errors,
+			RPS:      float64(tm.recent(now.Unix())) / window,
+			P50:      float64(tm.rt.Percentile(50)) / 1000,
+			P90:      float64(tm.rt.Percentile(90)) / 1000,
+			P99:      float64(tm.rt.Percentile(99)) / 1000,
+			Max:      float64(tm.rt.Max()) / 1000,
+			SumRT:    float64(tm.rt.Sum) / 1e6,
+		})
+	}
+	sort.Sort(byKindAndTitle(tests))
+	return m.load, uptime, tests
+}
+
+type byKindAndTitle []LiveStat
+
+func (b byKindAndTitle) Len() int      { return len(b) }
+func (b byKindAndTitle) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byKindAndTitle) Less(i, j int) bool {
+	if b[i].Kind != b[j].Kind {
+		return b[i].Kind < b[j].Kind
+	}
+	return b[i].Title < b[j].Title
+}
+
+// Escape s for use as a label value in the Prometheus text format.
+func promLabel(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return strings.Replace(s, "\n", `\n`, -1)
+}
+
+// WritePrometheus writes the current metrics to w in the Prometheus text
+// exposition format.
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	load, uptime, tests := m.Snapshot()
+	fmt.Fprintf(w, "# HELP webtest_load Current background load (parallel requests or requests per second).\n")
+	fmt.Fprintf(w, "# TYPE webtest_load gauge\nwebtest_load %d\n", load)
+	fmt.Fprintf(w, "# HELP webtest_uptime_seconds Time since start of webtest.\n")
+	fmt.Fprintf(w, "# TYPE webtest_uptime_seconds gauge\nwebtest_uptime_seconds %.3f\n", uptime.Seconds())
+
+	metric := func(name, typ, help string, value func(t LiveStat) string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, t := range tests {
+			fmt.Fprintf(w, "%s{kind=\"%s\",test=\"%s\"} %s\n", name, t.Kind, promLabel(t.Title), value(t))
+		}
+	}
+	metric("webtest_requests_total", "counter", "Number of requests performed.",
+		func(t LiveStat) string { return fmt.Sprintf("%d", t.Requests) })
+	metric("webtest_failures_total", "counter", "Number of requests with failed conditions.",
+		func(t LiveStat) string { return fmt.Sprintf("%d", t.Failures) })
+	metric("webtest_errors_total", "counter", "Number of errored requests.",
+		func(t LiveStat) string { return fmt.Sprintf("%d", t.Errors) })
+	metric("webtest_requests_per_second", "gauge", "Request rate during the last 10 seconds.",
+		func(t LiveStat) string { return fmt.Sprintf("%.3f", t.RPS) })
+
+	name := "webtest_response_time_seconds"
+	fmt.Fprintf(w, "# HELP %s Response times.\n# TYPE %s summary\n", name, name)
+	for _, t := range tests {
+		labels := fmt.Sprintf("kind=\"%s\",test=\"%s\"", t.Kind, promLabel(t.Title))
+		for _, q := range []struct {
+			q string
+			v float64
+		}{{"0.5", t.P50}, {"0.9", t.P90}, {"0.99", t.P99}, {"1", t.Max}} {
+			fmt.Fprintf(w, "%s{%s,quantile=\"%s\"} %.6f\n", name, labels, q.q, q.v/1000)
+		}
+		fmt.Fprintf(w, "%s_sum{%s} %.6f\n", name, labels, t.SumRT)
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, t.Requests)
+	}
+}
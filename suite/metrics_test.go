@@ -0,0 +1,51 @@
+package suite
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	var none *Metrics
+	none.Record("test", "Ignored", time.Second, false, false) // must not panic
+	none.SetLoad(3)
+
+	m := NewMetrics()
+	m.SetLoad(20)
+	for i := 1; i <= 100; i++ {
+		m.Record("test", "Search", time.Duration(i)*time.Millisecond, i%10 == 0, i == 100)
+	}
+	m.Record("background", `Say "Hi"`, 5*time.Millisecond, false, false)
+
+	load, _, tests := m.Snapshot()
+	if load != 20 || len(tests) != 2 {
+		t.Fatalf("Got load %d and %d tests", load, len(tests))
+	}
+	s := tests[1]
+	if s.Title != "Search" || s.Requests != 100 || s.Failures != 10 || s.Errors != 1 {
+		t.Errorf("Bad counts %+v", s)
+	}
+	if s.P50 < 49 || s.P50 > 51 || s.P99 < 98 || s.P99 > 100 || s.Max != 100 {
+		t.Errorf("Bad percentiles %+v", s)
+	}
+	if s.RPS < 10 {
+		t.Errorf("Bad rate %.1f", s.RPS)
+	}
+
+	var buf bytes.Buffer
+	m.WritePrometheus(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE webtest_load gauge\nwebtest_load 20\n",
+		"webtest_requests_total{kind=\"test\",test=\"Search\"} 100\n",
+		"webtest_errors_total{kind=\"test\",test=\"Search\"} 1\n",
+		"webtest_response_time_seconds{kind=\"test\",test=\"Search\",quantile=\"1\"} 0.100000\n",
+		"webtest_response_time_seconds_count{kind=\"background\",test=\"Say \\\"Hi\\\"\"} 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Missing %q in\n%s", want, out)
+		}
+	}
+}
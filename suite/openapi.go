@@ -0,0 +1,553 @@
+package suite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Methods of OpenAPI operations in the order tests are generated.
+var openAPIMethods = []string{"get", "post", "put", "patch", "delete", "head", "options"}
+
+// Convert the maps with interface{} keys produced by the yaml package to
+// maps with string keys like encoding/json produces.
+func normaliseYaml(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[fmt.Sprint(k)] = normaliseYaml(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range x {
+			x[i] = normaliseYaml(e)
+		}
+		return x
+	case int:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case uint64:
+		return float64(x)
+	}
+	return v
+}
+
+// Helpers to navigate the generic spec.
+func specObj(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func specList(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+func specStr(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// Sorted keys of m.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// An OpenAPI (3.x) or Swagger (2.0) specification.
+type openAPI struct {
+	root    map[string]interface{}
+	swagger bool // version 2.0
+}
+
+// Follow $refs of v (a parameter, request body, response or schema).
+func (api openAPI) deref(v interface{}) map[string]interface{} {
+	m := specObj(v)
+	for i := 0; i < 16 && m != nil; i++ {
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			break
+		}
+		target, err := resolveRef(api.root, ref)
+		if err != nil {
+			warnf("%s", err.Error())
+			return nil
+		}
+		m = specObj(target)
+	}
+	return m
+}
+
+// Base URL of the API.
+func (api openAPI) server() string {
+	if api.swagger {
+		host := specStr(api.root["host"])
+		if host == "" {
+			host = "localhost"
+		}
+		scheme := "http"
+		if schemes := specList(api.root["schemes"]); len(schemes) > 0 {
+			scheme = specStr(schemes[0])
+		}
+		return scheme + "://" + host + strings.TrimSuffix(specStr(api.root["basePath"]), "/")
+	}
+	servers := specList(api.root["servers"])
+	if len(servers) == 0 {
+		return "http://localhost"
+	}
+	server := specObj(servers[0])
+	u := specStr(server["url"])
+	for name, v := range specObj(server["variables"]) {
+		u = strings.Replace(u, "{"+name+"}", fmt.Sprint(specObj(v)["default"]), -1)
+	}
+	if hp(u, "/") || u == "" {
+		u = "http://localhost" + u
+	}
+	return strings.TrimSuffix(u, "/")
+}
+
+// Example value of the schema: Its example, default, first enum value or a
+// value made up from its type and format. Schemas referenced recursively
+// (the $refs in visiting) yield nil.
+func (api openAPI) example(schema interface{}, visiting map[string]bool) interface{} {
+	if ref := specStr(specObj(schema)["$ref"]); ref != "" {
+		if visiting[ref] {
+			return nil
+		}
+		visiting[ref] = true
+		defer delete(visiting, ref)
+	}
+	s := api.deref(schema)
+	if s == nil {
+		return nil
+	}
+	if v, ok := s["example"]; ok {
+		return v
+	}
+	if examples := specList(s["examples"]); len(examples) > 0 {
+		return examples[0]
+	}
+	if v, ok := s["default"]; ok {
+		return v
+	}
+	if enum := specList(s["enum"]); len(enum) > 0 {
+		return enum[0]
+	}
+	if v, ok := s["const"]; ok {
+		return v
+	}
+	if all := specList(s["allOf"]); len(all) > 0 {
+		merged := make(map[string]interface{})
+		for _, sub := range all {
+			for k, v := range specObj(api.example(sub, visiting)) {
+				merged[k] = v
+			}
+		}
+		return merged
+	}
+	for _, kw := range []string{"oneOf", "anyOf"} {
+		if alts := specList(s[kw]); len(alts) > 0 {
+			return api.example(alts[0], visiting)
+		}
+	}
+
+	typ := specStr(s["type"])
+	if types := specList(s["type"]); len(types) > 0 {
+		typ = specStr(types[0])
+	}
+	if typ == "" && s["properties"] != nil {
+		typ = "object"
+	}
+	switch typ {
+	case "object":
+		required := make(map[string]bool)
+		for _, r := range specList(s["required"]) {
+			required[specStr(r)] = true
+		}
+		o := make(map[string]interface{})
+		for name, ps := range specObj(s["properties"]) {
+			if api.deref(ps)["readOnly"] == true {
+				continue
+			}
+			if v := api.example(ps, visiting); v != nil || required[name] {
+				o[name] = v
+			}
+		}
+		return o
+	case "array":
+		if v := api.example(s["items"], visiting); v != nil {
+			return []interface{}{v}
+		}
+		return []interface{}{}
+	case "integer":
+		if min, ok := s["minimum"].(float64); ok {
+			return min
+		}
+		return float64(1)
+	case "number":
+		if min, ok := s["minimum"].(float64); ok {
+			return min
+		}
+		return 1.5
+	case "boolean":
+		return true
+	case "string":
+		switch specStr(s["format"]) {
+		case "date":
+			return "2006-01-02"
+		case "date-time":
+			return "2006-01-02T15:04:05Z"
+		case "email":
+			return "user@example.com"
+		case "uuid":
+			return "00000000-0000-0000-0000-000000000000"
+		case "uri", "url":
+			return "http://www.example.com/"
+		case "byte":
+			return "ZXhhbXBsZQ=="
+		}
+		return "string"
+	}
+	return nil
+}
+
+// Example of a parameter or media type object: example, the first of
+// examples or the example of its schema.
+func (api openAPI) exampleOf(m map[string]interface{}) interface{} {
+	if v, ok := m["example"]; ok {
+		return v
+	}
+	if examples := specObj(m["examples"]); len(examples) > 0 {
+		first := api.deref(examples[sortedKeys(examples)[0]])
+		if v, ok := first["value"]; ok {
+			return v
+		}
+	}
+	if schema, ok := m["schema"]; ok {
+		return api.example(schema, make(map[string]bool))
+	}
+	if _, ok := m["type"]; ok {
+		// Swagger 2.0: non-body parameters are their own schema
+		return api.example(m, make(map[string]bool))
+	}
+	return nil
+}
+
+// String values of the example v of a parameter. There is at least one
+// value, an empty array yields the empty string.
+func paramValues(v interface{}) []string {
+	switch x := v.(type) {
+	case nil:
+		return []string{""}
+	case string:
+		return []string{x}
+	case float64:
+		return []string{strconv.FormatFloat(x, 'f', -1, 64)}
+	case []interface{}:
+		if len(x) == 0 {
+			return []string{""}
+		}
+		var values []string
+		for _, e := range x {
+			values = append(values, paramValues(e)...)
+		}
+		return values
+	case map[string]interface{}:
+		return []string{compactJson(x)}
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+// The schema of the JSON response of op with status code (its content
+// type in OpenAPI 3) or nil.
+func (api openAPI) responseSchema(resp map[string]interface{}) (interface{}, string) {
+	if api.swagger {
+		return resp["schema"], ""
+	}
+	content := specObj(resp["content"])
+	for _, mt := range sortedKeys(content) {
+		if mt == "application/json" || hs(mt, "+json") || hp(mt, "application/json;") {
+			return specObj(content[mt])["schema"], mt
+		}
+	}
+	return nil, ""
+}
+
+// Stand alone JSON Schema of schema: The components of the spec referenced
+// (directly or indirectly) are copied along.
+func (api openAPI) standaloneSchema(schema interface{}) (string, error) {
+	refs := make(map[string]interface{})
+	var collect func(v interface{})
+	collect = func(v interface{}) {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := x["$ref"].(string); ok {
+				if _, seen := refs[ref]; !seen {
+					target, err := resolveRef(api.root, ref)
+					if err != nil {
+						refs[ref] = nil
+						return
+					}
+					refs[ref] = target
+					collect(target)
+				}
+			}
+			for _, e := range x {
+				collect(e)
+			}
+		case []interface{}:
+			for _, e := range x {
+				collect(e)
+			}
+		}
+	}
+	collect(schema)
+
+	root := make(map[string]interface{})
+	for k, v := range specObj(schema) {
+		root[k] = v
+	}
+	for ref, target := range refs {
+		if target == nil {
+			continue
+		}
+		// place target at the same location as in the spec
+		keys := strings.Split(ref[1:], "/")[1:]
+		m := root
+		for _, key := range keys[:len(keys)-1] {
+			key = strings.Replace(strings.Replace(key, "~1", "/", -1), "~0", "~", -1)
+			if specObj(m[key]) == nil {
+				m[key] = make(map[string]interface{})
+			}
+			m = specObj(m[key])
+		}
+		m[keys[len(keys)-1]] = target
+	}
+	buf, err := json.MarshalIndent(root, "", "  ")
+	return string(buf), err
+}
+
+// ImportOpenAPI generates a suite from an OpenAPI 3.x or Swagger 2.0
+// specification in JSON or YAML: One test per operation which sends example
+// values (taken from the spec or made up from the schema) for the path,
+// query, header and cookie parameters and the body, expects the first
+// successful status code declared and validates the JSON response against
+// the declared schema (see SCHEMA). The server is kept as HOST in Global.
+func ImportOpenAPI(r io.Reader) (s *Suite, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var spec interface{}
+	if err = yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("Cannot read OpenAPI spec: %s", err.Error())
+	}
+	api := openAPI{root: specObj(normaliseYaml(spec))}
+	switch {
+	case api.root == nil:
+		return nil, fmt.Errorf("Cannot read OpenAPI spec: Not an object")
+	case hp(specStr(api.root["openapi"]), "3."):
+	case specStr(api.root["swagger"]) == "2.0":
+		api.swagger = true
+	default:
+		return nil, fmt.Errorf("Unsupported spec: Neither OpenAPI 3.x nor Swagger 2.0")
+	}
+
+	s = NewSuite()
+	s.Global = NewTest("Global")
+	s.Global.Const["HOST"] = api.server()
+	titles := make(map[string]int)
+	paths := specObj(api.root["paths"])
+	for _, p := range sortedKeys(paths) {
+		item := api.deref(paths[p])
+		for _, method := range openAPIMethods {
+			op := specObj(item[method])
+			if op == nil {
+				continue
+			}
+			title := specStr(op["operationId"])
+			if title == "" {
+				title = strings.ToUpper(method) + " " + p
+			}
+			if titles[title]++; titles[title] > 1 {
+				title = fmt.Sprintf("%s (%d)", title, titles[title])
+			}
+			s.Test = append(s.Test, *api.operation(title, strings.ToUpper(method), p, item, op))
+		}
+		if item["trace"] != nil {
+			warnf("Cannot import TRACE %s.", p)
+		}
+	}
+	return s, nil
+}
+
+// The test of operation op of path p (with the path item item).
+func (api openAPI) operation(title, method, p string, item, op map[string]interface{}) *Test {
+	t := NewTest(title)
+	t.Method = method
+
+	// Parameters of the operation override those of the path.
+	params := make(map[string]map[string]interface{})
+	var order []string
+	for _, l := range []interface{}{item["parameters"], op["parameters"]} {
+		for _, pv := range specList(l) {
+			param := api.deref(pv)
+			key := specStr(param["in"]) + " " + specStr(param["name"])
+			if _, ok := params[key]; !ok {
+				order = append(order, key)
+			}
+			params[key] = param
+		}
+	}
+
+	path := p
+	query := make(url.Values)
+	var form url.Values
+	for _, key := range order {
+		param := params[key]
+		name := specStr(param["name"])
+		values := paramValues(api.exampleOf(param))
+		switch specStr(param["in"]) {
+		case "path":
+			path = strings.Replace(path, "{"+name+"}", url.PathEscape(strings.Join(values, ",")), -1)
+		case "query":
+			query[name] = values
+		case "header":
+			t.Header[http.CanonicalHeaderKey(name)] = strings.Join(values, ",")
+		case "cookie":
+			t.Jar.Update(http.Cookie{Name: name, Value: values[0], Domain: "{CURRENT}", Path: "/"}, "")
+		case "body":
+			api.body(t, "application/json", api.exampleOf(param))
+		case "formData":
+			if form == nil {
+				form = make(url.Values)
+			}
+			if specStr(param["type"]) == "file" {
+				values = []string{"@file:" + name}
+				if method == "POST" {
+					t.Method = "POST:mp"
+				}
+				warnf("Operation '%s' needs a file for parameter %s.", title, name)
+			}
+			form[name] = values
+		}
+	}
+
+	if body := api.deref(op["requestBody"]); body != nil {
+		content := specObj(body["content"])
+		mts := sortedKeys(content)
+		for _, mt := range mts {
+			// prefer JSON
+			if mt == "application/json" || hs(mt, "+json") {
+				mts = []string{mt}
+				break
+			}
+		}
+		if len(mts) > 0 {
+			mt := mts[0]
+			media := specObj(content[mt])
+			switch mt {
+			case "application/x-www-form-urlencoded", "multipart/form-data":
+				form = make(url.Values)
+				for k, v := range specObj(api.exampleOf(media)) {
+					form[k] = paramValues(v)
+				}
+				if mt == "multipart/form-data" && method == "POST" {
+					t.Method = "POST:mp"
+				}
+			default:
+				api.body(t, mt, api.exampleOf(media))
+			}
+		}
+	}
+
+	t.Url = "${HOST}" + path
+	switch {
+	case form != nil:
+		// parameters form the body, the query must go into the URL
+		t.Param = map[string][]string(form)
+		if len(query) > 0 {
+			t.Url += "?" + query.Encode()
+		}
+	case len(query) > 0:
+		switch method {
+		case "GET", "HEAD", "DELETE", "OPTIONS":
+			t.Param = map[string][]string(query)
+		default:
+			if t.SendBody != "" {
+				t.Param = map[string][]string(query)
+			} else {
+				t.Url += "?" + query.Encode()
+			}
+		}
+	}
+
+	// Expected status code and schema of the response
+	responses := specObj(op["responses"])
+	code := ""
+	for _, c := range sortedKeys(responses) {
+		if n, err := strconv.Atoi(c); err == nil && n < 400 {
+			code = c
+			break
+		}
+	}
+	if code == "" && responses["2XX"] != nil {
+		code = "2XX"
+	}
+	switch code {
+	case "":
+		warnf("Operation '%s' declares no successful response.", title)
+	case "2XX":
+		t.RespCond = append(t.RespCond,
+			Condition{Key: "Status-Code", Op: ">=", Val: "200"},
+			Condition{Key: "Status-Code", Op: "<", Val: "300"})
+	default:
+		t.RespCond = append(t.RespCond, Condition{Key: "Status-Code", Op: "==", Val: code})
+	}
+	if code != "" {
+		schema, mt := api.responseSchema(api.deref(responses[code]))
+		if mt != "" {
+			t.RespCond = append(t.RespCond, Condition{Key: "Content-Type", Op: "_=", Val: mimeType(mt)})
+		}
+		if schema != nil {
+			text, err := api.standaloneSchema(schema)
+			if err == nil {
+				t.Schema, err = ParseSchema(text)
+			}
+			if err != nil {
+				warnf("Cannot use response schema of '%s': %s", title, err.Error())
+			}
+		}
+	}
+	return t
+}
+
+// Send the example v as body with content type mt: Strings as they are
+// unless mt is JSON, everything else as JSON.
+func (api openAPI) body(t *Test, mt string, v interface{}) {
+	t.Header["Content-Type"] = mt
+	if text, ok := v.(string); ok && mt != "application/json" && !hs(mt, "+json") {
+		t.SendBody = text
+		return
+	}
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		warnf("Cannot make body of '%s': %s", t.Title, err.Error())
+		return
+	}
+	t.SendBody = string(buf)
+}
@@ -0,0 +1,236 @@
+package suite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const petstore = `
+openapi: 3.0.3
+info: {title: Petstore, version: "1"}
+servers:
+  - url: "{base}/v1"
+    variables:
+      base: {default: "${URL}"}
+paths:
+  /pets:
+    parameters:
+      - {name: X-Request-Id, in: header, schema: {type: string, format: uuid}}
+    get:
+      operationId: listPets
+      parameters:
+        - {name: limit, in: query, schema: {type: integer, maximum: 100}, example: 10}
+        - {name: tags, in: query, schema: {type: array, items: {type: string, enum: [dog, cat]}}}
+      responses:
+        200:
+          description: pets
+          content:
+            application/json:
+              schema: {type: array, items: {$ref: "#/components/schemas/Pet"}}
+        default: {$ref: "#/components/responses/Error"}
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema: {$ref: "#/components/schemas/Pet"}
+      responses:
+        "201":
+          description: created
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/Pet"}
+  /pets/{petId}:
+    get:
+      operationId: showPet
+      parameters:
+        - {$ref: "#/components/parameters/PetId"}
+        - {name: session, in: cookie, schema: {type: string}, example: s1}
+      responses:
+        "404": {$ref: "#/components/responses/Error"}
+        "200":
+          description: pet
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/Pet"}
+    delete:
+      parameters:
+        - {$ref: "#/components/parameters/PetId"}
+      responses:
+        "204": {description: deleted}
+  /login:
+    post:
+      parameters:
+        - {name: next, in: query, schema: {type: string, default: /home}}
+      requestBody:
+        content:
+          application/x-www-form-urlencoded:
+            schema:
+              type: object
+              properties:
+                user: {type: string, example: alice}
+                remember: {type: boolean}
+      responses:
+        2XX: {description: ok}
+    trace:
+      responses:
+        "200": {description: ok}
+components:
+  parameters:
+    PetId: {name: petId, in: path, required: true, schema: {type: integer}, example: 7}
+  responses:
+    Error:
+      description: error
+      content:
+        application/json:
+          schema: {$ref: "#/components/schemas/Error"}
+  schemas:
+    Pet:
+      type: object
+      required: [id, name]
+      properties:
+        id: {type: integer, readOnly: true}
+        name: {type: string, example: Rex}
+        kind: {type: string, enum: [dog, cat]}
+        parent: {$ref: "#/components/schemas/Pet"}
+    Error:
+      type: object
+      properties:
+        message: {type: string}
+`
+
+func TestImportOpenAPI(t *testing.T) {
+	var failures []string
+	fail := func(format string, args ...interface{}) {
+		failures = append(failures, fmt.Sprintf(format, args...))
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/pets":
+			if r.URL.RawQuery != "limit=10&tags=dog" || len(r.Header.Get("X-Request-Id")) != 36 {
+				fail("bad list request %s %v", r.URL.RawQuery, r.Header)
+			}
+			fmt.Fprint(w, `[{"id": 1, "name": "Rex"}, {"id": 2}]`) // second pet lacks name
+		case "POST /v1/pets":
+			var pet map[string]interface{}
+			body, _ := ioutil.ReadAll(r.Body)
+			if err := json.Unmarshal(body, &pet); err != nil || pet["name"] != "Rex" ||
+				pet["kind"] != "dog" || pet["id"] != nil || r.Header.Get("Content-Type") != "application/json" {
+				fail("bad create request %s", body)
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id": 3, "name": "Rex", "kind": "dog"}`)
+		case "GET /v1/pets/7":
+			if c, err := r.Cookie("session"); err != nil || c.Value != "s1" {
+				fail("missing cookie")
+			}
+			fmt.Fprint(w, `{"id": 7, "name": "Rex", "parent": {"id": 1, "name": 5}}`)
+		case "DELETE /v1/pets/7":
+			w.WriteHeader(http.StatusNoContent)
+		case "POST /v1/login":
+			if r.URL.Query().Get("next") != "/home" || r.PostFormValue("user") != "alice" ||
+				r.PostFormValue("remember") != "true" {
+				fail("bad login %s", r.URL.String())
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			fail("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	s, err := ImportOpenAPI(strings.NewReader(strings.Replace(petstore, "${URL}", ts.URL, -1)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if s.Global.Const["HOST"] != ts.URL+"/v1" {
+		t.Errorf("Bad host %s", s.Global.Const["HOST"])
+	}
+	var titles []string
+	for _, test := range s.Test {
+		titles = append(titles, test.Title)
+	}
+	if got := strings.Join(titles, "|"); got != "POST /login|listPets|POST /pets|showPet|DELETE /pets/{petId}" {
+		t.Fatalf("Bad tests generated: %s", got)
+	}
+
+	// The generated suite must be readable and run against the server.
+	text := s.String()
+	s, err = NewParser(strings.NewReader(text), "petstore.wt").ReadSuite()
+	if err != nil {
+		t.Fatalf("Cannot read generated suite: %s\n%s", err.Error(), text)
+	}
+	for i, want := range []int{0, 1, 0, 1, 0} {
+		s.RunTest(i)
+		if _, f, e := s.Test[i].Stat(); f != want || e != 0 {
+			t.Errorf("%s: Want %d failures, got %d:\n%v", s.Test[i].Title, want, f+e, s.Test[i].Result)
+		}
+	}
+	for _, test := range []int{1, 3} {
+		r := s.Test[test].Result
+		if last := r[len(r)-1]; last.Cause != "Schema violated" {
+			t.Errorf("%s: Want schema violation, got %s", s.Test[test].Title, last.String())
+		}
+	}
+	for _, f := range failures {
+		t.Errorf("Server: %s\n%s", f, text)
+	}
+}
+
+func TestImportSwagger(t *testing.T) {
+	spec := `{"swagger": "2.0", "host": "api.example.com", "basePath": "/v2/", "schemes": ["https"],
+	 "paths": {"/pets": {"post": {"consumes": ["application/json"],
+	   "parameters": [{"in": "body", "name": "pet", "schema": {"$ref": "#/definitions/Pet"}},
+	                  {"in": "query", "name": "dry", "type": "boolean"}],
+	   "responses": {"200": {"schema": {"$ref": "#/definitions/Pet"}}}}},
+	   "/upload": {"post": {"parameters": [{"in": "formData", "name": "file", "type": "file"},
+	                  {"in": "formData", "name": "note", "type": "string"}],
+	   "responses": {"204": {"description": "ok"}}}}},
+	 "definitions": {"Pet": {"properties": {"name": {"type": "string"}}}}}`
+	s, err := ImportOpenAPI(strings.NewReader(spec))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if s.Global.Const["HOST"] != "https://api.example.com/v2" || len(s.Test) != 2 {
+		t.Fatalf("Bad suite:\n%s", s.String())
+	}
+	pets, upload := s.Test[0], s.Test[1]
+	if pets.SendBody != "{\n  \"name\": \"string\"\n}" || pets.Param["dry"][0] != "true" ||
+		pets.Schema == nil || !strings.Contains(pets.Schema.Text, `"definitions"`) {
+		t.Errorf("Bad body test:\n%s", pets.String())
+	}
+	if upload.Method != "POST:mp" || upload.Param["file"][0] != "@file:file" ||
+		upload.RespCond[0].String() != "Status-Code == 204" {
+		t.Errorf("Bad upload test:\n%s", upload.String())
+	}
+
+	for _, bad := range []string{`{"swagger": "1.2"}`, `[1]`, "a: [b"} {
+		if _, err := ImportOpenAPI(strings.NewReader(bad)); err == nil {
+			t.Errorf("Missing error for %s", bad)
+		}
+	}
+}
+
+func TestImportOpenAPIEmptyExamples(t *testing.T) {
+	spec := `{"openapi": "3.0.0", "paths": {"/pets": {"get": {
+	   "parameters": [{"in": "cookie", "name": "prefs", "schema": {"type": "array"}, "example": []},
+	                  {"in": "query", "name": "tags", "schema": {"type": "array"}, "example": []}],
+	   "responses": {"200": {"description": "ok"}}}}}}`
+	s, err := ImportOpenAPI(strings.NewReader(spec))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	pets := s.Test[0]
+	if cookies := pets.Jar.All(); len(cookies) != 1 || cookies[0].Name != "prefs" || cookies[0].Value != "" {
+		t.Errorf("Bad cookies %v", cookies)
+	}
+	if tags := pets.Param["tags"]; len(tags) != 1 || tags[0] != "" {
+		t.Errorf("Bad parameter %v", tags)
+	}
+}
@@ -0,0 +1,155 @@
+package suite
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/vdobler/webtest/stat"
+)
+
+// OpenLoad describes open-loop background load: Requests are started at
+// a given arrival rate regardless how long earlier requests take (unlike
+// bgnoise which keeps a fixed number of requests in flight).
+type OpenLoad struct {
+	Rate        int           // target arrival rate in requests per second
+	From        int           // rate at start of a ramp (only if Ramp > 0)
+	Ramp        time.Duration // duration of linear increase of rate from From to Rate
+	Concurrency int           // maximum number of requests in flight, 0 means unlimited
+}
+
+// Offset of the k-th arrival (k = 0, 1, ...) from the start of the load.
+func (ol OpenLoad) arrival(k int) time.Duration {
+	r1 := float64(ol.Rate)
+	if ol.Ramp <= 0 || ol.From == ol.Rate {
+		return time.Duration(float64(k) / r1 * float64(time.Second))
+	}
+	// During the ramp the number of arrivals until t is
+	//     N(t) = r0*t + (r1-r0)*t^2/(2T)
+	r0, T := float64(ol.From), ol.Ramp.Seconds()
+	nT := (r0 + r1) * T / 2 // arrivals during the whole ramp
+	kf := float64(k)
+	var t float64
+	if kf >= nT {
+		t = T + (kf-nT)/r1
+	} else {
+		a := (r1 - r0) / (2 * T)
+		t = (-r0 + math.Sqrt(r0*r0+4*a*kf)) / (2 * a)
+	}
+	return time.Duration(t * float64(time.Second))
+}
+
+// Statistics of the background requests of an open-loop load.
+type openLoadStats struct {
+	sync.Mutex
+	err   int
+	rt    *stat.Histogram // response times in µs measured from intended start
+	delay *stat.Histogram // delay of actual start after intended start in µs
+}
+
+func (st *openLoadStats) add(intended, actual, end time.Time, errored bool) {
+	st.Lock()
+	defer st.Unlock()
+	if errored {
+		st.err++
+	}
+	st.rt.Record(int64(end.Sub(intended) / time.Microsecond))
+	st.delay.Record(int64(actual.Sub(intended) / time.Microsecond))
+}
+
+// Run scenario sc as background load and record intended and actual start
+// time. For journeys the response time of the first step is recorded.
+func openRun(sc *scenario, vu *virtualUser, p *scenarioPicker, intended time.Time, stats *openLoadStats) {
+	actual := time.Now()
+	tracef("Started open-loop background scenario (delay %s)", actual.Sub(intended))
+	first, errored := sc.run(vu, p, false)
+	stats.add(intended, actual, first, errored)
+}
+
+// Start requests from the bg suite according to load until shut down via
+// kill. The requests (or journeys) are choosen randomly according to their
+// Weight, think times are waited between the steps of a journey only.
+// If the maximum concurrency is reached requests are delayed (but not
+// dropped): The response times are measured from the intended start time
+// and thus include this queueing delay. finished is signaled once all
+// started requests are done.
+// Each request is performed by an idle virtual user; new virtual users are
+// set up if all are busy.
+func openLoop(load OpenLoad, bg *Suite, kill, finished chan bool, stats *openLoadStats) {
+	p := newScenarioPicker(bg, randomSeed())
+	m := len(p.scenarios)
+	var sem chan bool
+	idle := make(chan *virtualUser, 1024)
+	if load.Concurrency > 0 {
+		sem = make(chan bool, load.Concurrency)
+		idle = make(chan *virtualUser, load.Concurrency)
+	}
+	users := 0
+	var running sync.WaitGroup
+	start := time.Now()
+	debugf("Initializing open-loop load of %d rps", load.Rate)
+
+loop:
+	for k := 0; m > 0 && load.Rate > 0; k++ {
+		intended := start.Add(load.arrival(k))
+		if wait := intended.Sub(time.Now()); wait > 0 {
+			select {
+			case <-kill:
+				break loop
+			case <-time.After(wait):
+			}
+		}
+		if sem != nil {
+			select {
+			case <-kill:
+				break loop
+			case sem <- true:
+			}
+		}
+		var vu *virtualUser
+		select {
+		case vu = <-idle:
+		default:
+			vu = newVirtualUser(users, bg)
+			users++
+		}
+		sc := p.next()
+		running.Add(1)
+		go func() {
+			openRun(sc, vu, p, intended, stats)
+			select {
+			case idle <- vu:
+			default: // drop surplus virtual user
+			}
+			if sem != nil {
+				<-sem
+			}
+			running.Done()
+		}()
+	}
+	if m == 0 || load.Rate <= 0 {
+		<-kill
+	}
+	debugf("Killed open-loop load (%d virtual users)", users)
+	running.Wait()
+	debugf("Finished open-loop load")
+	finished <- true
+}
+
+// RateStep implements Stepper for open-loop load: The "load" is the
+// arrival rate in requests per second which increases linearely.
+// A Step of 0 yields a constant rate. Ramp is the duration over which
+// the rate is increased from one step to the next (0 for a sudden jump).
+type RateStep struct {
+	Start int
+	Step  int
+	Ramp  time.Duration
+}
+
+// Next yields current + step.
+func (rs RateStep) Next(current int) int {
+	if current == 0 {
+		return rs.Start
+	}
+	return current + rs.Step
+}
@@ -0,0 +1,51 @@
+package suite
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOpenLoadArrival(t *testing.T) {
+	constant := OpenLoad{Rate: 20}
+	for k, want := range []time.Duration{0, 50 * time.Millisecond, 100 * time.Millisecond} {
+		if got := constant.arrival(k); got != want {
+			t.Errorf("Constant rate: arrival %d at %s, want %s", k, got, want)
+		}
+	}
+
+	// Ramp from 10 to 30 rps within 2 seconds: 40 arrivals during ramp.
+	ramp := OpenLoad{Rate: 30, From: 10, Ramp: 2 * time.Second}
+	last := time.Duration(-1)
+	for k := 0; k < 100; k++ {
+		got := ramp.arrival(k)
+		if got <= last {
+			t.Fatalf("Arrival %d at %s not after previous at %s", k, got, last)
+		}
+		last = got
+	}
+	if got := ramp.arrival(40); got < 1999*time.Millisecond || got > 2001*time.Millisecond {
+		t.Errorf("End of ramp at %s, want 2s", got)
+	}
+	if got := ramp.arrival(70); got < 2999*time.Millisecond || got > 3001*time.Millisecond {
+		t.Errorf("Arrival after ramp at %s, want 3s", got)
+	}
+	// first interval is at the lower rate, last one at the higher
+	if d0, d1 := ramp.arrival(1)-ramp.arrival(0), ramp.arrival(39)-ramp.arrival(38); d0 <= d1 {
+		t.Errorf("Rate not increasing: first interval %s, last interval %s", d0, d1)
+	}
+}
+
+func TestRateStep(t *testing.T) {
+	rs := RateStep{Start: 10, Step: 5}
+	rate, got := 0, []int{}
+	for i := 0; i < 3; i++ {
+		rate = rs.Next(rate)
+		got = append(got, rate)
+	}
+	if got[0] != 10 || got[1] != 15 || got[2] != 20 {
+		t.Errorf("Got rates %v", got)
+	}
+	if c := (RateStep{Start: 7}); c.Next(c.Next(0)) != 7 {
+		t.Errorf("Constant rate changed")
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"path"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -20,6 +23,9 @@ var DefaultSettings = map[string]int{"Repeat": 1,
 	"Keep-Cookies": 0,
 	"Abort":        0,
 	"Dump":         0,
+	"Weight":       1,
+	"Think":        0,
+	"Journey":      0,
 }
 
 type ParserError struct {
@@ -31,13 +37,24 @@ func (pe ParserError) Error() string {
 }
 
 type Parser struct {
-	reader *bufio.Reader
-	line   []string
-	test   *Test
-	suite  []Test
-	i      int
-	name   string
-	errors []string
+	reader  *bufio.Reader
+	line    []string
+	test    *Test
+	suite   []Test
+	i       int
+	name    string
+	errors  []string
+	Dir     string       // directory of the suite file, relative paths are resolved against Dir
+	NoFiles bool         // refuse to read INCLUDE and DATA files (e.g. for suites sent by a coordinator)
+	origin  []lineOrigin // where line[i] comes from (see INCLUDE)
+}
+
+// Origin of a line of the suite: Line index in file which is located in dir.
+type lineOrigin struct {
+	file     string
+	index    int
+	dir      string
+	included bool // file was INCLUDEd
 }
 
 // Set up a new Parser which reads a suite from r (named name).
@@ -53,10 +70,39 @@ func NewParser(r io.Reader, name string) *Parser {
 
 // Log an error in the input file
 func (p *Parser) error(f string, m ...interface{}) {
-	e := fmt.Sprintf("%s:%d: %s", p.name, p.i+1, fmt.Sprintf(f, m...))
+	e := fmt.Sprintf("%s: %s", p.pos(1), fmt.Sprintf(f, m...))
+	p.errors = append(p.errors, e)
+}
+
+// Log an error in line o of an (included) file.
+func (p *Parser) errorAt(o lineOrigin, f string, m ...interface{}) {
+	e := fmt.Sprintf("%s:%d: %s", o.file, o.index+1, fmt.Sprintf(f, m...))
 	p.errors = append(p.errors, e)
 }
 
+// Position "file:line" of the current line in the (included) file: The
+// line is the index of the line plus offset.
+func (p *Parser) pos(offset int) string {
+	if p.i >= 0 && p.i < len(p.origin) {
+		o := p.origin[p.i]
+		return fmt.Sprintf("%s:%d", o.file, o.index+offset)
+	}
+	return fmt.Sprintf("%s:%d", p.name, p.i+offset)
+}
+
+// Check if the current line comes from an INCLUDEd file.
+func (p *Parser) included() bool {
+	return p.i >= 0 && p.i < len(p.origin) && p.origin[p.i].included
+}
+
+// Directory of the (included) file the current line comes from.
+func (p *Parser) dir() string {
+	if p.i >= 0 && p.i < len(p.origin) {
+		return p.origin[p.i].dir
+	}
+	return p.Dir
+}
+
 // check if all okay
 func (p *Parser) okay() bool {
 	return len(p.errors) == 0
@@ -88,16 +134,177 @@ func isComment(line string) bool {
 	return hp(line, "#")
 }
 
-// Fill list of lines.
+// Fill list of lines. INCLUDE lines are replaced by the lines of the
+// included file.
 func (p *Parser) readLines() {
 	p.i = 0
+	var lines []string
 	for {
 		line, err := p.nextLine()
 		if err != nil {
-			return
+			break
+		}
+		lines = append(lines, line)
+	}
+	p.addLines(lines, p.name, p.Dir, []string{path.Join(p.Dir, p.name)})
+	p.i = 0
+}
+
+// Add lines of file located in dir. Included files are resolved relative
+// to dir, stack is the list of files currently being read (including file).
+func (p *Parser) addLines(lines []string, file, dir string, stack []string) {
+	for i, line := range lines {
+		if hp(line, "INCLUDE ") || hp(line, "INCLUDE\t") {
+			p.include(trim(line[len("INCLUDE"):]), lineOrigin{file, i, dir, len(stack) > 1}, stack)
+			continue
 		}
 		p.line = append(p.line, line)
+		p.origin = append(p.origin, lineOrigin{file, i, dir, len(stack) > 1})
+	}
+}
+
+// Include the lines of file name (relative to the directory of the
+// INCLUDE line at).
+func (p *Parser) include(name string, at lineOrigin, stack []string) {
+	if name == "" {
+		p.errorAt(at, "Missing file to include.")
+		return
+	}
+	if p.NoFiles {
+		p.errorAt(at, "Including '%s' not allowed.", name)
+		return
+	}
+	filename := name
+	if !path.IsAbs(filename) && at.dir != "" {
+		filename = path.Join(at.dir, filename)
+	}
+	filename = path.Clean(filename)
+	for _, f := range stack {
+		if f == filename {
+			p.errorAt(at, "Cyclic include of '%s'.", name)
+			return
+		}
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		p.errorAt(at, "Cannot include '%s': %s", name, err.Error())
+		return
+	}
+	lines := strings.Split(strings.Replace(string(content), "\r\n", "\n", -1), "\n")
+	if n := len(lines); n > 0 && lines[n-1] == "" {
+		lines = lines[:n-1]
+	}
+	tracef("Including %d lines from %s", len(lines), filename)
+	p.addLines(lines, filename, path.Dir(filename), append(stack, filename))
+}
+
+// Expand FOREACH loops: The lines between
+//   FOREACH ${VAR} IN value1 value2 ...
+// and the matching END are repeated for each value with ${VAR} replaced by
+// the value.  Test titles get the value appended to keep them unique,
+// e.g. "Start Page [LANG=de]".  Loops may be nested.
+func (p *Parser) expandLoops() {
+	lines, origin := p.line, p.origin
+	p.line, p.origin = nil, nil
+	p.expandLines(lines, origin)
+}
+
+func isEnd(line string) bool {
+	return hp(line, "END") && trim(line) == "END"
+}
+
+func (p *Parser) expandLines(lines []string, origin []lineOrigin) {
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if isEnd(line) {
+			p.errorAt(origin[i], "END without FOREACH.")
+			continue
+		}
+		if !hp(line, "FOREACH ") && !hp(line, "FOREACH\t") {
+			p.line = append(p.line, line)
+			p.origin = append(p.origin, origin[i])
+			continue
+		}
+
+		// find matching END
+		end, depth := -1, 1
+		for j := i + 1; j < len(lines) && end == -1; j++ {
+			if hp(lines[j], "FOREACH ") || hp(lines[j], "FOREACH\t") {
+				depth++
+			} else if isEnd(lines[j]) {
+				if depth--; depth == 0 {
+					end = j
+				}
+			}
+		}
+		if end == -1 {
+			p.errorAt(origin[i], "FOREACH without END.")
+			return
+		}
+
+		name, values, err := parseForeach(trim(line[len("FOREACH"):]))
+		if err != nil {
+			p.errorAt(origin[i], "Bad FOREACH: %s", err.Error())
+			i = end
+			continue
+		}
+		tracef("Expanding lines %d to %d for %s in %v", i+1, end-1, name, values)
+		for _, v := range values {
+			block := make([]string, end-i-1)
+			for k := range block {
+				block[k] = strings.Replace(lines[i+1+k], "${"+name+"}", v, -1)
+				if k > 0 && k+1 < len(block) && hp(lines[i+k], "---------") && hp(lines[i+2+k], "---------") {
+					block[k] = fmt.Sprintf("%s [%s=%s]", trim(block[k]), name, v)
+				}
+			}
+			p.expandLines(block, origin[i+1:end])
+		}
+		i = end
+	}
+}
+
+// Parse "${VAR} IN value1 value2 ..." of a FOREACH.
+func parseForeach(s string) (name string, values []string, err error) {
+	i := strings.Index(s, " IN ")
+	if !hp(s, "${") || i == -1 || s[i-1] != '}' {
+		err = fmt.Errorf("Expected 'FOREACH ${VAR} IN value1 value2 ...' but got '%s'.", s)
+		return
+	}
+	name = s[2 : i-1]
+	if !isName(name) {
+		err = fmt.Errorf("Bad variable name '%s'.", name)
+		return
+	}
+	values, err = StringList(trim(s[i+4:]))
+	if err == nil && len(values) == 0 {
+		err = fmt.Errorf("No values given.")
+	}
+	return
+}
+
+// Parse the condition of an IF: "lhs == rhs", "lhs != rhs" or just "lhs".
+// lhs and rhs may be quoted.
+func parseIf(cond string) (lhs, op, rhs string, err error) {
+	lhs = cond
+	for _, o := range []string{"==", "!="} {
+		if i := strings.Index(cond, o); i != -1 {
+			lhs, op, rhs = trim(cond[:i]), o, trim(cond[i+2:])
+			break
+		}
+	}
+	if lhs == "" {
+		err = fmt.Errorf("Missing left hand side.")
+		return
 	}
+	if hp(lhs, "\"") {
+		if lhs, err = dequote(lhs); err != nil {
+			return
+		}
+	}
+	if hp(rhs, "\"") {
+		rhs, err = dequote(rhs)
+	}
+	return
 }
 
 // Abrevations for strings.HasPrefix
@@ -223,7 +430,7 @@ func (p *Parser) readCookieCond(host string) (cc []Condition) {
 			value = dval
 		}
 		cond.Val = value
-		cond.Id = fmt.Sprintf("%s:%d", p.name, p.i)
+		cond.Id = p.pos(0)
 		cc = append(cc, cond)
 	}
 	return
@@ -312,6 +519,10 @@ func (p *Parser) readSettingMap(m *map[string]int) {
 			if n < 0 || n > 3 {
 				warnf("Dump accepts only 0, 1 and 2 as value (was %s=%d) on line %d.", val, n, p.i)
 			}
+		case "Weight", "Think", "Journey":
+			if n < 0 {
+				warnf("Negative %s is unsensical on line %d.", key, p.i)
+			}
 		}
 		(*m)[key] = n
 		tracef("Added to settings-map (line %d): %s: %s", p.i, key, val)
@@ -612,7 +823,7 @@ func (p *Parser) readCond(mode int) []Condition {
 		//fmt.Printf("\nvvvvvvvvvvvvvvvvvvvvvvvvvvv\nOrig=%s\nValu=%s\nDeqt=%s\n^^^^^^^^^^^^^^^^^^^^^^\n",
 		//	p.line[p.i], val, dval)
 
-		id := fmt.Sprintf("%s:%d", p.name, p.i)
+		id := p.pos(0)
 		cond := Condition{Key: key, Op: op, Val: dval, Neg: neg, Id: id, Range: rng}
 		list = append(list, cond)
 		tracef("Added to condition (line %d): %s", p.i, cond.String())
@@ -620,6 +831,74 @@ func (p *Parser) readCond(mode int) []Condition {
 	return list
 }
 
+// Read the conditions of the IMAGE section.
+func (p *Parser) readImageCond() []Condition {
+	var list []Condition = make([]Condition, 0, 3)
+
+	for p.i < len(p.line)-1 {
+		done, neg, key, op, val := p.nextStuff(
+			[]string{"==", "~=", "_=", "=_", "/=", ">", ">=", "<", "<="})
+		if done {
+			return list
+		}
+		if !validImageKey(key) {
+			p.error("No such condition type '%s' for image.", key)
+			continue
+		}
+		if i := strings.Index(key, ":"); i != -1 {
+			switch op {
+			case "==", ">", ">=", "<", "<=":
+			default:
+				p.error("Illegal operator '%s' for %s.", op, key[:i])
+				continue
+			}
+			if _, err := strconv.ParseFloat(val, 64); err != nil {
+				p.error("Limit '%s' is not a number.", val)
+				continue
+			}
+		}
+
+		id := p.pos(0)
+		// reference images are relative to the suite
+		cond := Condition{Key: key, Op: op, Val: val, Neg: neg, Id: id, dir: p.dir()}
+		list = append(list, cond)
+		tracef("Added to image condition (line %d): %s", p.i, cond.String())
+	}
+	return list
+}
+
+// Read the conditions of a section like ARCHIVE or PDF: Keys are checked
+// with valid. A key without operator and value is an existence check.
+func (p *Parser) readKeyCond(section string, valid func(string) bool) []Condition {
+	var list []Condition = make([]Condition, 0, 3)
+
+	for p.i < len(p.line)-1 {
+		done, neg, key, op, val := p.nextStuff(
+			[]string{"==", "~=", "_=", "=_", "/=", ">", ">=", "<", "<="})
+		if done {
+			return list
+		}
+		if !valid(key) {
+			p.error("No such condition type '%s' for %s.", key, section)
+			continue
+		}
+		if op == "" {
+			op = "."
+		}
+		dval, err := dequote(val)
+		if err != nil {
+			p.error("Cannot parse string '%s': %s", val, err)
+			continue
+		}
+
+		id := p.pos(0)
+		cond := Condition{Key: key, Op: op, Val: dval, Neg: neg, Id: id}
+		list = append(list, cond)
+		tracef("Added to %s condition (line %d): %s", section, p.i, cond.String())
+	}
+	return list
+}
+
 // List of valid tag-name --> attrib-name combinations on html where the
 // attrib points to some external URL.
 var knownLinkAttr = map[string]string{
@@ -649,7 +928,7 @@ func (p *Parser) readValidation() []string {
 		line = trim(line)
 		// TODO: lowercase
 
-		// id := fmt.Sprintf("%s:%d", p.name, p.i)
+		// id := p.pos(0)
 		list = append(list, line)
 		tracef("Added to validation (line %d): %s", p.i, line)
 	}
@@ -672,7 +951,7 @@ func (p *Parser) readLogCond() []LogCondition {
 			errorf("Malformed string '%s': %s", val, err.Error())
 			continue
 		}
-		id := fmt.Sprintf("%s:%d", p.name, p.i)
+		id := p.pos(0)
 		cond := LogCondition{Path: key, Op: op, Val: val, Neg: neg, Id: id}
 		list = append(list, cond)
 		tracef("Added to condition (line %d): %s", p.i, cond.String())
@@ -680,6 +959,140 @@ func (p *Parser) readLogCond() []LogCondition {
 	return list
 }
 
+// Read the SNAPSHOT section of test.
+func (p *Parser) readSnapshot(test *Test) *Snapshot {
+	snap := &Snapshot{Id: p.pos(0)}
+	for p.i < len(p.line)-1 {
+		done, _, key, _, val := p.nextStuff([]string{":="})
+		if done {
+			break
+		}
+		switch key {
+		case "File":
+			snap.File = val
+		case "Mask":
+			if isRegexpMask(val) {
+				if _, err := regexp.Compile(val[1 : len(val)-1]); err != nil {
+					p.error("Malformed regexp in Mask '%s': %s", val, err.Error())
+					continue
+				}
+			} else if _, err := tag.ParseTagSpec(val); err != nil {
+				p.error("Malformed tagspec in Mask '%s': %s", val, err.Error())
+				continue
+			}
+			snap.Mask = append(snap.Mask, val)
+		case "Ignore":
+			if _, err := tag.ParseTagSpec(val); err != nil {
+				p.error("Malformed tagspec in Ignore '%s': %s", val, err.Error())
+				continue
+			}
+			snap.Ignore = append(snap.Ignore, val)
+		default:
+			p.error("Unknown snapshot key '%s'.", key)
+		}
+	}
+
+	// Golden files default to <suite>.snapshots/<title>.snap next to the suite.
+	// Explicit files in included suites are relative to the included file.
+	dir := p.dir()
+	snap.path = snap.File
+	if snap.path == "" {
+		base := strings.TrimSuffix(path.Base(p.name), path.Ext(p.name))
+		snap.path = path.Join(base+".snapshots", sanitizeFilename(test.Title)+".snap")
+		dir = p.Dir
+	}
+	if !path.IsAbs(snap.path) && dir != "" {
+		snap.path = path.Join(dir, snap.path)
+	}
+	return snap
+}
+
+// Read the AUTH section and check its keys (see checkAuth).
+func (p *Parser) readAuth() map[string]string {
+	auth := make(map[string]string)
+	p.readMap(&auth)
+	if err := checkAuth(auth); err != nil {
+		p.error("%s.", err.Error())
+	}
+	return auth
+}
+
+// Read the SEND-BODY or SCHEMA section: The indented lines are taken
+// verbatim (without the leading tab) up to the next unindented line.
+func (p *Parser) readVerbatim() string {
+	var lines []string
+	for p.i < len(p.line)-1 {
+		line := p.line[p.i+1]
+		if !hp(line, "\t") && trim(line) != "" {
+			break
+		}
+		p.i++
+		lines = append(lines, strings.TrimPrefix(line, "\t"))
+	}
+	for len(lines) > 0 && trim(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Read the SCHEMA section: A JSON Schema for the body.
+func (p *Parser) readSchema() *Schema {
+	id := p.pos(0)
+	schema, err := ParseSchema(p.readVerbatim())
+	if err != nil {
+		p.error("Malformed schema: %s.", err.Error())
+		return nil
+	}
+	schema.Id = id
+	return schema
+}
+
+// Read the EXTRACT section: Variables to set from the response.
+func (p *Parser) readExtract() (list []Extraction) {
+	for p.i < len(p.line)-1 {
+		done, _, key, _, val := p.nextStuff([]string{":="})
+		if done {
+			return
+		}
+		e, err := parseExtraction(key, val)
+		if err != nil {
+			p.error("Bad EXTRACT of '%s': %s.", key, err.Error())
+			continue
+		}
+		e.Id = p.pos(0)
+		list = append(list, e)
+		tracef("Added extraction (line %d): %s := %s", p.i, key, e.String())
+	}
+	return
+}
+
+// Read the DATA section: The rows of the data file.
+func (p *Parser) readData() (data *DataTable) {
+	for p.i < len(p.line)-1 {
+		done, _, key, _, val := p.nextStuff([]string{":="})
+		if done {
+			break
+		}
+		if key != "File" {
+			p.error("Unknown data key '%s'.", key)
+			continue
+		}
+		if p.NoFiles {
+			p.error("Reading data file '%s' not allowed.", val)
+			continue
+		}
+		file := val
+		if !path.IsAbs(file) && p.dir() != "" {
+			file = path.Join(p.dir(), file)
+		}
+		var err error
+		if data, err = ReadDataFile(file); err != nil {
+			p.error("Cannot read data file '%s': %s", val, err.Error())
+		}
+	}
+	return
+}
+
 // Helper to extract count an spec from strings like ">= 5  a href=/index.html"
 // off is the number of charactes to strip before trying to read an int.
 func numStr(line string, off int) (n int, spec string, err error) {
@@ -724,7 +1137,7 @@ func (p *Parser) readTagCond() []TagCondition {
 		}
 
 		cond := TagCondition{}
-		cond.Id = fmt.Sprintf("%s:%d", p.name, p.i)
+		cond.Id = p.pos(0)
 		var spec string
 		var err error
 
@@ -817,6 +1230,22 @@ const (
 	mode_body
 )
 
+// Methods besides GET and POST usable in the request line of a test.
+var otherMethods = []string{"PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+
+// Check if line is the request line of a test.
+func isRequestLine(line string) bool {
+	if hp(line, "GET") || hp(line, "POST") {
+		return true
+	}
+	for _, m := range otherMethods {
+		if hp(line, m+" ") || hp(line, m+"\t") {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Parser) readGetPost(line string) (method, u string) {
 	if hp(line, "GET") {
 		method, u = "GET", trim(line[3:])
@@ -824,6 +1253,12 @@ func (p *Parser) readGetPost(line string) (method, u string) {
 		method, u = "POST:mp", trim(line[7:])
 	} else if hp(line, "POST ") {
 		method, u = "POST", trim(line[4:])
+	} else {
+		for _, m := range otherMethods {
+			if hp(line, m+" ") || hp(line, m+"\t") {
+				method, u = m, trim(line[len(m):])
+			}
+		}
 	}
 
 	if i := strings.Index(u, "#"); i != -1 {
@@ -853,13 +1288,237 @@ func noGetWithFile(test *Test, p *Parser) {
 	}
 }
 
+// Merge the Global test src into dst (e.g. a Global of a suite into the
+// Global of an included suite): Variables, header, parameters, cookies and
+// non-default settings of src override those of dst, conditions and
+// commands are added.
+func mergeGlobal(dst, src *Test) {
+	if src.Url != "" {
+		dst.Method, dst.Url = src.Method, src.Url
+	}
+	for k, v := range src.Header {
+		dst.Header[k] = v
+	}
+	if len(src.Auth) > 0 {
+		dst.Auth = src.Auth
+	}
+	for k, v := range src.Const {
+		dst.Const[k] = v
+	}
+	for k, v := range src.Param {
+		dst.Param[k] = v
+	}
+	for k, v := range src.Rand {
+		dst.Rand[k] = v
+	}
+	for k, v := range src.Seq {
+		dst.Seq[k] = v
+	}
+	for k, v := range src.Setting {
+		if v != DefaultSettings[k] {
+			dst.Setting[k] = v
+		}
+	}
+	for _, c := range src.Jar.All() {
+		dst.Jar.Update(*c, c.Domain)
+	}
+	dst.RespCond = addMissingCond(src.RespCond, dst.RespCond)
+	dst.CookieCond = append(dst.CookieCond, src.CookieCond...)
+	dst.BodyCond = append(dst.BodyCond, src.BodyCond...)
+	dst.ImageCond = append(dst.ImageCond, src.ImageCond...)
+	dst.ArchiveCond = append(dst.ArchiveCond, src.ArchiveCond...)
+	dst.PdfCond = append(dst.PdfCond, src.PdfCond...)
+	dst.Tag = append(dst.Tag, src.Tag...)
+	dst.Log = append(dst.Log, src.Log...)
+	dst.Validation = append(dst.Validation, src.Validation...)
+	dst.Before = append(dst.Before, src.Before...)
+	dst.After = append(dst.After, src.After...)
+	if src.Snapshot != nil {
+		dst.Snapshot = src.Snapshot
+	}
+	if src.Schema != nil {
+		dst.Schema = src.Schema
+	}
+}
+
+// Let test inherit from base (see EXTENDS): Like tests inherit from Global
+// missing header fields, response and cookie conditions, variables,
+// parameters and cookies are taken from base, body, tag and other conditions
+// as well as BEFORE and AFTER commands of base are added. Settings of base
+// (except Repeat) are used if test uses the default.
+func inherit(test, base *Test) {
+	b := base.Copy()
+	if test.Url == "" && test.Form == "" {
+		test.Method, test.Url, test.Form = b.Method, b.Url, b.Form
+	}
+	if test.SendBody == "" {
+		test.SendBody = b.SendBody
+	}
+	if test.If == "" {
+		test.If = b.If
+	}
+	addMissingHeader(&test.Header, &b.Header)
+	if len(test.Auth) == 0 {
+		test.Auth = b.Auth
+	}
+	addMissingHeader(&test.Const, &b.Const)
+	for _, m := range []struct{ test, base map[string][]string }{
+		{test.Param, b.Param}, {test.Rand, b.Rand}, {test.Seq, b.Seq}} {
+		for k, v := range m.base {
+			if _, ok := m.test[k]; !ok {
+				m.test[k] = v
+			}
+		}
+	}
+	for _, c := range b.Jar.All() {
+		if test.Jar.Contains(c.Domain, c.Path, c.Name) == nil {
+			test.Jar.Update(*c, c.Domain)
+		}
+	}
+	test.RespCond = addMissingCond(test.RespCond, b.RespCond)
+	test.CookieCond = addMissingCond(test.CookieCond, b.CookieCond)
+	test.BodyCond = addAllCond(test.BodyCond, b.BodyCond)
+	test.ImageCond = addAllCond(test.ImageCond, b.ImageCond)
+	test.ArchiveCond = addAllCond(test.ArchiveCond, b.ArchiveCond)
+	test.PdfCond = addAllCond(test.PdfCond, b.PdfCond)
+	test.Tag = append(test.Tag, b.Tag...)
+	test.Log = append(test.Log, b.Log...)
+	test.Validation = append(test.Validation, b.Validation...)
+	test.Extract = append(test.Extract, b.Extract...)
+	if len(test.Steps) == 0 {
+		test.Steps = b.Steps
+	}
+	test.Before = append(b.Before, test.Before...)
+	test.After = append(b.After, test.After...)
+	if test.Schema == nil {
+		test.Schema = b.Schema
+	}
+	if test.Snapshot == nil && b.Snapshot != nil {
+		test.Snapshot = b.Snapshot
+		if test.Snapshot.File == "" {
+			// own golden file for each test
+			test.Snapshot.path = path.Join(path.Dir(b.Snapshot.path), sanitizeFilename(test.Title)+".snap")
+		}
+	}
+	for k, v := range b.Setting {
+		if k != "Repeat" && test.Setting[k] == DefaultSettings[k] {
+			test.Setting[k] = v
+		}
+	}
+}
+
+// Resolve the EXTENDS of all tests of suite. A test may extend a test
+// which extends another test.
+func (p *Parser) resolveExtends(suite *Suite) {
+	index := make(map[string]int)
+	for i := range suite.Test {
+		if _, ok := index[suite.Test[i].Title]; !ok {
+			index[suite.Test[i].Title] = i
+		}
+	}
+	const (
+		unresolved = iota
+		resolving
+		resolved
+	)
+	state := make([]int, len(suite.Test))
+	var resolve func(i int) bool
+	resolve = func(i int) bool {
+		t := &suite.Test[i]
+		switch state[i] {
+		case resolved:
+			return true
+		case resolving:
+			p.errors = append(p.errors, fmt.Sprintf("%s: Cyclic EXTENDS of test '%s'.", t.extendsPos, t.Title))
+			return false
+		}
+		ok := true
+		if t.Extends != "" {
+			if j, found := index[t.Extends]; !found {
+				p.errors = append(p.errors, fmt.Sprintf("%s: Test '%s' extends unknown test '%s'.",
+					t.extendsPos, t.Title, t.Extends))
+				ok = false
+			} else {
+				state[i] = resolving
+				if ok = resolve(j); ok {
+					inherit(t, &suite.Test[j])
+					tracef("Test '%s' inherits from '%s'", t.Title, t.Extends)
+				}
+			}
+		}
+		t.Extends = ""
+		state[i] = resolved
+		return ok
+	}
+	for i := range suite.Test {
+		resolve(i)
+	}
+}
+
+// Check if test or one of its steps uses FORM or EXTRACT.
+func needsGlobal(test *Test) bool {
+	if test.Form != "" || len(test.Extract) > 0 {
+		return true
+	}
+	for i := range test.Steps {
+		if needsGlobal(&test.Steps[i]) {
+			return true
+		}
+	}
+	return false
+}
+
 // Parse the suite.
 func (p *Parser) ReadSuite() (suite *Suite, err error) {
 	p.readLines()
+	p.expandLoops()
 
 	var test *Test
+	var flow *Test         // test with STEPs, test is its current step
+	var data *DataTable    // rows of the DATA section of test
+	var global bool        // test is a Global
+	var mainTest bool      // a test of the suite itself (not an included one) was read
+	var datas []*DataTable // DATA of suite.Test, expanded after EXTENDS are resolved
 	suite = NewSuite()
-	var first bool = true
+
+	// store last test read: A test named Global is the global test if it is
+	// the first test of the suite itself. Globals of included files are
+	// merged into the global test.
+	store := func() {
+		if flow != nil {
+			noGetWithFile(test, p)
+			flow.Steps = append(flow.Steps, *test)
+			test, flow = flow, nil
+			if len(test.Extract) > 0 {
+				p.error("EXTRACT of test '%s' belongs into its STEPs.", test.Title)
+			}
+		}
+		if global {
+			if data != nil {
+				p.error("No DATA section allowed in Global.")
+			}
+			if test.Extends != "" {
+				p.error("No EXTENDS allowed in Global.")
+			}
+			if test.If != "" {
+				p.error("No IF allowed in Global.")
+			}
+			if test.Form != "" {
+				p.error("No FORM allowed in Global.")
+			}
+			if suite.Global == nil {
+				suite.Global = test
+			} else {
+				mergeGlobal(suite.Global, test)
+			}
+		} else {
+			noGetWithFile(test, p)
+			suite.Test = append(suite.Test, *test)
+			datas = append(datas, data)
+			tracef("Append test to suite: \n%s", test.String())
+		}
+		test, data = nil, nil
+	}
 
 	for p.i = 0; p.i < len(p.line); p.i++ {
 		line := p.line[p.i]
@@ -870,16 +1529,7 @@ func (p *Parser) ReadSuite() (suite *Suite, err error) {
 		// start of test
 		if hp(line, "---------") {
 			if test != nil {
-				// store last test read
-				if first && test.Title == "Global" {
-					suite.Global = test
-				} else {
-					noGetWithFile(test, p)
-					suite.Test = append(suite.Test, *test)
-					tracef("Append test to suite: \n%s", test.String())
-					test = nil
-				}
-				first = false
+				store()
 			}
 			if p.i+3 >= len(p.line) {
 				p.error("Not enough lines left for valid test.")
@@ -892,6 +1542,8 @@ func (p *Parser) ReadSuite() (suite *Suite, err error) {
 				continue
 			}
 			test = NewTest(line)
+			global = line == "Global" && (p.included() || !mainTest)
+			mainTest = mainTest || !p.included()
 			p.i++
 			line = p.line[p.i]
 			if !hp(line, "---------") {
@@ -908,14 +1560,69 @@ func (p *Parser) ReadSuite() (suite *Suite, err error) {
 
 		line = trim(line)
 
-		if hp(line, "GET") || hp(line, "POST") {
+		if isRequestLine(line) {
 			test.Method, test.Url = p.readGetPost(line)
 			continue
 		}
 
+		if hp(line, "EXTENDS ") || hp(line, "EXTENDS\t") {
+			if test == nil {
+				p.error("No test declared jet on '%s'", line)
+			} else if flow != nil {
+				p.error("No EXTENDS allowed in STEP.")
+			} else {
+				test.Extends, test.extendsPos = trim(line[len("EXTENDS"):]), p.pos(1)
+			}
+			continue
+		}
+
+		if hp(line, "FORM ") || hp(line, "FORM\t") {
+			sel := trim(line[len("FORM"):])
+			if test == nil {
+				p.error("No test declared jet on '%s'", line)
+			} else if _, err := formSpec(sel); err != nil {
+				p.error("Bad FORM '%s': %s", sel, err.Error())
+			} else {
+				test.Form = sel
+			}
+			continue
+		}
+
+		if hp(line, "STEP ") || hp(line, "STEP\t") {
+			name := trim(line[len("STEP"):])
+			if test == nil {
+				p.error("No test declared jet on '%s'", line)
+			} else if flow == nil && global {
+				p.error("No STEP allowed in Global.")
+			} else {
+				if flow == nil {
+					flow = test
+				} else {
+					noGetWithFile(test, p)
+					flow.Steps = append(flow.Steps, *test)
+				}
+				test = NewTest(name)
+			}
+			continue
+		}
+
+		if hp(line, "IF ") || hp(line, "IF\t") {
+			cond := trim(line[len("IF"):])
+			if test == nil {
+				p.error("No test declared jet on '%s'", line)
+			} else if _, _, _, err := parseIf(cond); err != nil {
+				p.error("Bad IF '%s': %s", cond, err.Error())
+			} else {
+				test.If = cond
+			}
+			continue
+		}
+
 		switch line {
 		case "HEADER":
 			p.readMap(&test.Header)
+		case "AUTH":
+			test.Auth = p.readAuth()
 		case "SEND-COOKIE", "SEND-COOKIES", "COOKIE", "COOKIES":
 			p.readSendCookies(test.Jar, "{CURRENT}")
 		case "RESPONSE":
@@ -944,6 +1651,22 @@ func (p *Parser) ReadSuite() (suite *Suite, err error) {
 			test.After = p.readShellCond()
 		case "VALIDATION", "VALIDATE":
 			test.Validation = p.readValidation()
+		case "IMAGE":
+			test.ImageCond = p.readImageCond()
+		case "ARCHIVE":
+			test.ArchiveCond = p.readKeyCond("archive", validArchiveKey)
+		case "PDF":
+			test.PdfCond = p.readKeyCond("pdf", validPdfKey)
+		case "SNAPSHOT":
+			test.Snapshot = p.readSnapshot(test)
+		case "EXTRACT":
+			test.Extract = p.readExtract()
+		case "SEND-BODY":
+			test.SendBody = p.readVerbatim()
+		case "SCHEMA":
+			test.Schema = p.readSchema()
+		case "DATA":
+			data = p.readData()
 		default:
 			if hp(line, "-") {
 				p.error("Unknown stuff '%s'. Maybe to short test-title border?", line)
@@ -960,10 +1683,22 @@ func (p *Parser) ReadSuite() (suite *Suite, err error) {
 	}
 
 	if test != nil {
-		noGetWithFile(test, p)
-		suite.Test = append(suite.Test, *test)
-		tracef("Append test to suite: \n%s", test.String())
-
+		store()
+	}
+	// Tests extend the test as written, not its rows.
+	p.resolveExtends(suite)
+	tests := suite.Test
+	suite.Test = nil
+	for i := range tests {
+		suite.Test = append(suite.Test, expandData(&tests[i], datas[i])...)
+	}
+	for i := range suite.Test {
+		applyStepTemplate(&suite.Test[i])
+		if needsGlobal(&suite.Test[i]) && suite.Global == nil {
+			// FORM and EXTRACT need a global test to keep the last page
+			// and the extracted variables
+			suite.Global = NewTest("Global")
+		}
 	}
 
 	if !p.okay() {
@@ -0,0 +1,286 @@
+package suite
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+)
+
+// Very simple PDF inspection: The streams of the PDF are inflated (if
+// FlateDecode'd) and searched for the page tree and text showing operators.
+// This works for most machine generated PDFs with simple fonts but is no
+// replacement for a real PDF parser.
+
+var (
+	pdfStreamStart = regexp.MustCompile(`stream\r?\n`)
+	pdfPagesType   = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfPageType    = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfCount       = regexp.MustCompile(`/Count\s+(\d+)`)
+)
+
+// The content of all streams in pdf: FlateDecode'd streams are inflated,
+// streams with other filters (e.g. images) are dropped.
+func pdfStreams(pdf []byte) (streams [][]byte) {
+	for _, m := range pdfStreamStart.FindAllIndex(pdf, -1) {
+		if m[0] >= 3 && string(pdf[m[0]-3:m[0]]) == "end" {
+			continue
+		}
+		start := m[1]
+		end := bytes.Index(pdf[start:], []byte("endstream"))
+		if end == -1 {
+			break
+		}
+		stream := pdf[start : start+end]
+
+		// dictionary of the stream object
+		dict := pdf[:m[0]]
+		if i := bytes.LastIndex(dict, []byte("obj")); i != -1 {
+			dict = dict[i:]
+		}
+		if !bytes.Contains(dict, []byte("/Filter")) {
+			streams = append(streams, stream)
+			continue
+		}
+		if !bytes.Contains(dict, []byte("/FlateDecode")) {
+			continue
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(stream))
+		if err != nil {
+			continue
+		}
+		data, _ := ioutil.ReadAll(zr) // use what can be decompressed
+		streams = append(streams, data)
+	}
+	return
+}
+
+// Return the dictionary (<< ... >>) enclosing position pos in data.
+func pdfDictAround(data []byte, pos int) []byte {
+	start, depth := pos, 0
+	for ; start > 0; start-- {
+		if data[start] == '>' && data[start-1] == '>' {
+			depth++
+			start--
+		} else if data[start] == '<' && data[start-1] == '<' {
+			if depth == 0 {
+				start--
+				break
+			}
+			depth--
+			start--
+		}
+	}
+	end, depth := pos, 0
+	for ; end < len(data)-1; end++ {
+		if data[end] == '<' && data[end+1] == '<' {
+			depth++
+			end++
+		} else if data[end] == '>' && data[end+1] == '>' {
+			if depth == 0 {
+				end += 2
+				break
+			}
+			depth--
+			end++
+		}
+	}
+	return data[start:end]
+}
+
+// Number of pages in the pdf, parts are the raw pdf and the inflated
+// streams: The largest /Count of all page tree nodes (which is the count
+// of the root node) or the number of page objects if no page tree was found.
+func pdfPages(parts [][]byte) (n int) {
+	pages := 0
+	for _, data := range parts {
+		for _, m := range pdfPagesType.FindAllIndex(data, -1) {
+			dict := pdfDictAround(data, m[0])
+			if c := pdfCount.FindSubmatch(dict); c != nil {
+				if cnt, err := strconv.Atoi(string(c[1])); err == nil && cnt > n {
+					n = cnt
+				}
+			}
+		}
+		pages += len(pdfPageType.FindAllIndex(data, -1))
+	}
+	if n == 0 {
+		n = pages
+	}
+	return
+}
+
+// Decode the PDF literal string starting after the opening ( at s[i].
+// Returns the string and the index after the closing ).
+func pdfLiteral(s []byte, i int) (str []byte, next int) {
+	depth := 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\':
+			i++
+			if i >= len(s) {
+				return
+			}
+			switch e := s[i]; e {
+			case 'n':
+				str = append(str, '\n')
+			case 'r':
+				str = append(str, '\r')
+			case 't':
+				str = append(str, '\t')
+			case 'b', 'f':
+			case '\r', '\n': // line continuation
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				v, k := 0, 0
+				for ; k < 3 && i+k < len(s) && s[i+k] >= '0' && s[i+k] <= '7'; k++ {
+					v = 8*v + int(s[i+k]-'0')
+				}
+				i += k - 1
+				str = append(str, byte(v))
+			default:
+				str = append(str, e)
+			}
+		case '(':
+			depth++
+			str = append(str, c)
+		case ')':
+			if depth == 0 {
+				return str, i + 1
+			}
+			depth--
+			str = append(str, c)
+		default:
+			str = append(str, c)
+		}
+	}
+	return str, i
+}
+
+// Decode the PDF hex string starting after the opening < at s[i].
+func pdfHexString(s []byte, i int) (str []byte, next int) {
+	var hex []byte
+	for ; i < len(s) && s[i] != '>'; i++ {
+		c := s[i]
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			hex = append(hex, c)
+		}
+	}
+	if len(hex)%2 == 1 {
+		hex = append(hex, '0')
+	}
+	return hexToBytes(string(hex)), i + 1
+}
+
+// Extract the text shown by the Tj, TJ, ' and " operators inside text
+// objects (BT ... ET) of the content streams in data. Each text object
+// ends with a newline.
+func pdfText(data []byte) string {
+	text := &bytes.Buffer{}
+	inText := false
+	var operands [][]byte // strings seen since last operator
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '(':
+			str, next := pdfLiteral(data, i+1)
+			operands = append(operands, str)
+			i = next
+			continue
+		case c == '<' && i+1 < len(data) && data[i+1] != '<':
+			str, next := pdfHexString(data, i+1)
+			operands = append(operands, str)
+			i = next
+			continue
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+			continue
+		case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || c == '\'' || c == '"' || c == '*':
+			j := i
+			for j < len(data) && ((data[j] >= 'A' && data[j] <= 'Z') ||
+				(data[j] >= 'a' && data[j] <= 'z') || data[j] == '\'' || data[j] == '"' || data[j] == '*') {
+				j++
+			}
+			if i > 0 && data[i-1] == '/' {
+				i = j // a name, not an operator
+				continue
+			}
+			switch op := string(data[i:j]); op {
+			case "BT":
+				inText = true
+			case "ET":
+				if inText {
+					text.WriteString("\n")
+				}
+				inText = false
+			case "Tj", "TJ", "'", "\"":
+				if inText {
+					if op == "'" || op == "\"" {
+						text.WriteString("\n")
+					}
+					for _, o := range operands {
+						text.Write(o)
+					}
+				}
+			case "T*", "Td", "TD":
+				if inText && text.Len() > 0 {
+					text.WriteString(" ")
+				}
+			}
+			operands = operands[:0]
+			i = j
+			continue
+		}
+		i++
+	}
+	return text.String()
+}
+
+// Check if key is a valid key in the PDF section.
+func validPdfKey(key string) bool {
+	return key == "Pages" || key == "Txt"
+}
+
+// Perform the PDF checks on body.
+func testPdf(body []byte, t, orig *Test) {
+	if len(t.PdfCond) > 0 {
+		debugf("Testing PDF")
+	} else {
+		return
+	}
+
+	if !bytes.HasPrefix(body, []byte("%PDF-")) {
+		orig.Error("PDF", "Not a PDF", "Body does not start with %PDF-")
+		return
+	}
+	streams := pdfStreams(body)
+	var text string
+
+	for _, c := range t.PdfCond {
+		cs := c.Info("pdf")
+		var v string
+		switch c.Key {
+		case "Pages":
+			v = strconv.Itoa(pdfPages(append([][]byte{body}, streams...)))
+		case "Txt":
+			if text == "" {
+				text = pdfText(bytes.Join(streams, []byte("\n")))
+			}
+			v = text
+		default:
+			errorf("Unkown pdf condition '%s' (%s). Ignored.", c.Key, c.Id)
+			continue
+		}
+
+		if ok, was := c.Fullfilled(v); ok {
+			orig.Passed(cs)
+		} else {
+			orig.Failed(c.Id, "PDF Failed",
+				fmt.Sprintf("%s\nTesting for %s\nBut got: %s%s", c.Id, c.String(), was, c.Diff(v)))
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package suite
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestPdfText(t *testing.T) {
+	content := []byte(`BT /F1 12 Tf 70 700 Td (Hello \(World\)) Tj ET
+BT [(Qua)-20(rterly)( )(re)5(port)] TJ T* <41 42> Tj ET`)
+	text := pdfText(content)
+	if text != "Hello (World)\nQuarterly report AB\n" {
+		t.Errorf("Got %q", text)
+	}
+}
+
+func TestPdfConditions(t *testing.T) {
+	pdf, err := ioutil.ReadFile("testdata/file.pdf")
+	if err != nil {
+		t.Fatalf("Cannot read pdf: %s", err.Error())
+	}
+
+	st := `
+----------------
+PDF
+----------------
+GET http://localhost/file.pdf
+PDF
+	Pages  ==  1
+	Txt    ~=  "A very small PDF File."
+	!Txt   ~=  Volker
+	Pages  >   1
+`
+	p := NewParser(strings.NewReader(st), "pdf.wt")
+	s, err := p.ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	test := &s.Test[0]
+	testPdf(pdf, test, test)
+	if len(test.Result) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(test.Result))
+	}
+	for i, r := range test.Result {
+		exp := TestPassed
+		if i == 3 {
+			exp = TestFailed
+		}
+		if r.Status != exp {
+			t.Errorf("Condition %d: expected %s, got %s: %s", i, exp, r.Status, r.Message)
+		}
+	}
+}
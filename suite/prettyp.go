@@ -2,6 +2,7 @@ package suite
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -44,8 +45,13 @@ func formatMap(title string, m *map[string]string) (f string) {
 			longest = len(k)
 		}
 	}
-	for k, v := range *m {
-		f += fmt.Sprintf("\t%-*s  :=  %s\n", longest, k, quote(v, false))
+	keys := make([]string, 0, len(*m))
+	for k := range *m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f += fmt.Sprintf("\t%-*s  :=  %s\n", longest, k, quote((*m)[k], false))
 	}
 	return
 }
@@ -62,7 +68,13 @@ func formatSettings(m *map[string]int) (f string) {
 			longest = len(k)
 		}
 	}
-	for k, v := range *m {
+	keys := make([]string, 0, len(*m))
+	for k := range *m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := (*m)[k]
 		f += fmt.Sprintf("\t%-*s  :=  ", longest, k)
 		switch k {
 		case "Dump":
@@ -111,9 +123,14 @@ func formatMultiMap(title string, m *map[string][]string) (f string) {
 				longest = len(k)
 			}
 		}
-		for k, l := range *m {
+		keys := make([]string, 0, len(*m))
+		for k := range *m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
 			f += fmt.Sprintf("\t%-*s  :=  ", longest, k)
-			for _, v := range l {
+			for _, v := range (*m)[k] {
 				f += " " + quote(v, true)
 			}
 			f += "\n"
@@ -222,6 +239,24 @@ func formatLogCond(lc []LogCondition) (f string) {
 	return
 }
 
+// Pretty print the snapshot condition.
+func formatSnapshot(snap *Snapshot) (f string) {
+	if snap == nil {
+		return
+	}
+	f = "SNAPSHOT\n"
+	if snap.File != "" {
+		f += "\tFile    :=  " + snap.File + "\n"
+	}
+	for _, m := range snap.Mask {
+		f += "\tMask    :=  " + m + "\n"
+	}
+	for _, m := range snap.Ignore {
+		f += "\tIgnore  :=  " + m + "\n"
+	}
+	return
+}
+
 // Pretty print the cookies in our jar.
 func formatSendCookies(jar *CookieJar) (s string) {
 	if len(jar.All()) == 0 {
@@ -239,20 +274,68 @@ func formatSendCookies(jar *CookieJar) (s string) {
 	return
 }
 
+// Pretty print the extractions of variables.
+func formatExtract(list []Extraction) (f string) {
+	if len(list) == 0 {
+		return
+	}
+	f = "EXTRACT\n"
+	longest := 0
+	for _, e := range list {
+		if len(e.Name) > longest {
+			longest = len(e.Name)
+		}
+	}
+	for _, e := range list {
+		f += fmt.Sprintf("\t%-*s  :=  %s\n", longest, e.Name, e.String())
+	}
+	return
+}
+
 // String representation as as used by the parser.
 func (t *Test) String() (s string) {
 	s = "-------------------------------\n" + t.Title + "\n-------------------------------\n"
-	s += t.Method + " " + t.Url + "\n"
+	s += t.sections()
+	for i := range t.Steps {
+		s += "STEP " + t.Steps[i].Title + "\n" + t.Steps[i].sections()
+	}
+	return
+}
+
+// The sections of t (everything after the title) as used by the parser.
+func (t *Test) sections() (s string) {
+	if t.Form != "" {
+		s += "FORM " + t.Form + "\n"
+	}
+	if t.Url != "" || (t.Method != "" && t.Form == "") {
+		s += t.Method + " " + t.Url + "\n"
+	}
+	if t.If != "" {
+		s += "IF " + t.If + "\n"
+	}
 	s += formatMap("CONST", &t.Const)
 	s += formatMultiMap("SEQ", &t.Seq)
 	s += formatMultiMap("RAND", &t.Rand)
 	s += formatCommand("BEFORE", t.Before)
 	s += formatMultiMap("PARAM", &t.Param)
+	if t.SendBody != "" {
+		s += "SEND-BODY\n\t" + strings.Replace(t.SendBody, "\n", "\n\t", -1) + "\n"
+	}
 	s += formatMap("HEADER", &t.Header)
+	s += formatMap("AUTH", &t.Auth)
 	s += formatSendCookies(t.Jar)
 	s += formatCond("RESPONSE", &t.RespCond)
 	s += formatSetCookies(&t.CookieCond)
 	s += formatCond("BODY", &t.BodyCond)
+	s += formatCond("IMAGE", &t.ImageCond)
+	s += formatCond("ARCHIVE", &t.ArchiveCond)
+	s += formatCond("PDF", &t.PdfCond)
+	if len(t.Validation) > 0 {
+		s += "VALIDATION\n"
+		for _, v := range t.Validation {
+			s += "\t" + v + "\n"
+		}
+	}
 	if len(t.Tag) > 0 {
 		s += "TAG\n"
 		for i, tagCond := range t.Tag {
@@ -263,6 +346,11 @@ func (t *Test) String() (s string) {
 			s += "\t" + fts + "\n"
 		}
 	}
+	s += formatSnapshot(t.Snapshot)
+	if t.Schema != nil {
+		s += "SCHEMA\n\t" + strings.Replace(t.Schema.Text, "\n", "\n\t", -1) + "\n"
+	}
+	s += formatExtract(t.Extract)
 	specSet := make(map[string]int) // map with non-standard settings
 	for k, v := range t.Setting {
 		if dflt, ok := DefaultSettings[k]; ok && v != dflt {
@@ -275,3 +363,15 @@ func (t *Test) String() (s string) {
 
 	return
 }
+
+// String representation of the whole suite (global test and all tests)
+// as used by the parser.
+func (s *Suite) String() (str string) {
+	if s.Global != nil {
+		str = s.Global.String() + "\n"
+	}
+	for i := range s.Test {
+		str += s.Test[i].String() + "\n"
+	}
+	return
+}
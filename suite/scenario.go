@@ -0,0 +1,136 @@
+package suite
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// A scenario is one unit of background load: Either a single test or a
+// journey of several tests (e.g. login, browse, logout) performed by one
+// virtual user with its own cookie jar.
+type scenario struct {
+	tests  []int // indices into Suite.Test in order of execution
+	weight int   // relative frequency of this scenario
+}
+
+// Determine the background scenarios of s: Tests with the same Journey
+// setting > 0 form one journey (in suite order) whose weight is the
+// weight of its first test. All other tests are scenarios of their own.
+// Disabled tests (Repeat 0 or IF not holding) and scenarios with weight <= 0
+// are dropped.
+func scenarios(s *Suite) (scs []scenario) {
+	journey := make(map[int]int) // journey number -> index in scs
+	for i := range s.Test {
+		t := &s.Test[i]
+		if t.Repeat() == 0 || t.skip(s.Global) {
+			continue
+		}
+		if j := t.Journey(); j > 0 {
+			if k, ok := journey[j]; ok {
+				scs[k].tests = append(scs[k].tests, i)
+				continue
+			}
+			journey[j] = len(scs)
+		}
+		scs = append(scs, scenario{tests: []int{i}, weight: t.Weight()})
+	}
+
+	n := 0
+	for _, sc := range scs {
+		if sc.weight > 0 {
+			scs[n] = sc
+			n++
+		}
+	}
+	return scs[:n]
+}
+
+// Weighted random choice of scenarios. Safe for concurrent use.
+type scenarioPicker struct {
+	sync.Mutex
+	scenarios []scenario
+	cum       []int // cumulated weights
+	rnd       *rand.Rand
+}
+
+// Set up a picker for the scenarios of s.
+func newScenarioPicker(s *Suite, seed int64) *scenarioPicker {
+	p := &scenarioPicker{scenarios: scenarios(s), rnd: rand.New(rand.NewSource(seed))}
+	total := 0
+	for _, sc := range p.scenarios {
+		total += sc.weight
+		p.cum = append(p.cum, total)
+	}
+	return p
+}
+
+// Choose the next scenario randomly according to the weights.
+// Returns nil if there are no scenarios.
+func (p *scenarioPicker) next() *scenario {
+	n := len(p.cum)
+	if n == 0 {
+		return nil
+	}
+	p.Lock()
+	r := p.rnd.Intn(p.cum[n-1])
+	p.Unlock()
+	i := 0
+	for p.cum[i] <= r {
+		i++
+	}
+	return &p.scenarios[i]
+}
+
+// A random think time of test: Uniformly distributed between 1/2 and 3/2
+// of the Think setting.
+func thinkTime(test *Test, rnd *scenarioPicker) time.Duration {
+	think := test.Think()
+	if think <= 0 {
+		return 0
+	}
+	rnd.Lock()
+	ms := think/2 + rnd.rnd.Intn(think+1)
+	rnd.Unlock()
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Run the tests of scenario sc as virtual user vu without checking
+// conditions. The steps of a journey share a private copy of the global
+// cookie jar of vu so that cookies set during the journey are kept for this
+// journey only. Think times are waited between the steps and, if thinkAfter
+// is set, after the last step. Returns the time the first step was finished
+// and whether any step errored.
+func (sc *scenario) run(vu *virtualUser, p *scenarioPicker, thinkAfter bool) (first time.Time, errored bool) {
+	global := vu.global
+	journey := len(sc.tests) > 1
+	if journey {
+		jar := global.Jar
+		global.Jar = jar.Copy()
+		defer func() { global.Jar = jar }()
+	}
+	for k, i := range sc.tests {
+		test := vu.tests[i]
+		test.Result = nil
+		keep := test.Setting["Keep-Cookies"]
+		if journey {
+			test.Setting["Keep-Cookies"] = 1
+		}
+		tracef("Started background test %s as virtual user %d", test.Title, vu.id)
+		start := time.Now()
+		test.RunWithoutTest(global)
+		test.Setting["Keep-Cookies"] = keep
+		if k == 0 {
+			first = time.Now()
+		}
+		_, _, e := test.Stat()
+		if e > 0 {
+			errored = true
+		}
+		LiveMetrics.Record("background", test.Title, time.Since(start), false, e > 0)
+		if k < len(sc.tests)-1 || thinkAfter {
+			time.Sleep(thinkTime(test, p))
+		}
+	}
+	return
+}
@@ -0,0 +1,146 @@
+package suite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var scenarioSuite = `
+----------------
+Search
+----------------
+GET ${URL}/search
+SETTING
+	Weight  :=  7
+
+----------------
+Login
+----------------
+GET ${URL}/login
+SETTING
+	Journey :=  1
+	Weight  :=  1
+	Think   :=  2
+
+----------------
+Product
+----------------
+GET ${URL}/product
+SETTING
+	Weight  :=  2
+
+----------------
+Checkout
+----------------
+GET ${URL}/checkout
+SETTING
+	Journey :=  1
+
+----------------
+Disabled
+----------------
+GET ${URL}/disabled
+SETTING
+	Weight  :=  0
+`
+
+func readScenarioSuite(t *testing.T, url string) *Suite {
+	p := NewParser(strings.NewReader(strings.Replace(scenarioSuite, "${URL}", url, -1)), "scenario.wt")
+	s, err := p.ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	return s
+}
+
+func TestScenarios(t *testing.T) {
+	s := readScenarioSuite(t, "http://localhost")
+	scs := scenarios(s)
+	if len(scs) != 3 {
+		t.Fatalf("Expected 3 scenarios, got %v", scs)
+	}
+	if len(scs[1].tests) != 2 || scs[1].tests[0] != 1 || scs[1].tests[1] != 3 || scs[1].weight != 1 {
+		t.Errorf("Bad journey %v", scs[1])
+	}
+
+	p := newScenarioPicker(s, 1)
+	count := make(map[int]int)
+	for i := 0; i < 10000; i++ {
+		count[p.next().tests[0]]++
+	}
+	for i, want := range map[int]int{0: 7000, 1: 1000, 2: 2000} {
+		if count[i] < want*9/10 || count[i] > want*11/10 {
+			t.Errorf("Scenario starting with test %d choosen %d times, expected about %d", i, count[i], want)
+		}
+	}
+	if count[4] != 0 {
+		t.Errorf("Weight 0 test was choosen")
+	}
+}
+
+func TestJourneyCookies(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+		}
+		mu.Lock()
+		if c, err := r.Cookie("session"); err == nil {
+			seen = append(seen, r.URL.Path+"="+c.Value)
+		} else {
+			seen = append(seen, r.URL.Path)
+		}
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	s := readScenarioSuite(t, ts.URL)
+	p := newScenarioPicker(s, 1)
+	vu := newVirtualUser(0, s)
+	journey := &p.scenarios[1]
+	if _, errored := journey.run(vu, p, false); errored {
+		t.Fatalf("Journey errored")
+	}
+	if _, errored := p.scenarios[2].run(vu, p, false); errored {
+		t.Fatalf("Product errored")
+	}
+
+	want := "/login /checkout=abc /product"
+	if got := strings.Join(seen, " "); got != want {
+		t.Errorf("Got requests %q, want %q", got, want)
+	}
+}
+
+func TestConcurrentScenarios(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "visit", Value: r.URL.Path, Path: "/"})
+	}))
+	defer ts.Close()
+
+	s := readScenarioSuite(t, ts.URL)
+	s.Global = NewTest("Global")
+	s.Global.Seq["n"] = []string{"1", "2", "3"}
+	for i := range s.Test {
+		s.Test[i].Setting["Keep-Cookies"] = 1
+		s.Test[i].Url += "?n=${n}"
+	}
+	p := newScenarioPicker(s, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(vu *virtualUser, sc *scenario) {
+			defer wg.Done()
+			for k := 0; k < 5; k++ {
+				sc.run(vu, p, false)
+			}
+		}(newVirtualUser(i, s), &p.scenarios[i%len(p.scenarios)])
+	}
+	wg.Wait()
+	if n := len(s.Global.Jar.All()); n != 0 {
+		t.Errorf("Cookies of scenarios leaked into the global jar: %d", n)
+	}
+}
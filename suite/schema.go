@@ -0,0 +1,324 @@
+package suite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a JSON Schema the JSON body of the response must be valid
+// against (see SCHEMA). The keywords type (incl. OpenAPI's nullable), enum,
+// const, properties, required, additionalProperties, items, minItems,
+// maxItems, minLength, maxLength, pattern, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, allOf, anyOf, oneOf, not and local
+// $refs ("#/components/schemas/Pet") are checked, format is not.
+type Schema struct {
+	Text   string      // the schema as given in the suite
+	Id     string      // reference to source
+	schema interface{} // parsed Text
+}
+
+// ParseSchema parses the JSON Schema text.
+func ParseSchema(text string) (*Schema, error) {
+	s := &Schema{Text: text}
+	if err := json.Unmarshal([]byte(text), &s.schema); err != nil {
+		return nil, err
+	}
+	if _, ok := s.schema.(map[string]interface{}); !ok {
+		if _, ok := s.schema.(bool); !ok {
+			return nil, fmt.Errorf("Schema must be an object")
+		}
+	}
+	return s, nil
+}
+
+// Validate the JSON document body. The list of violations is returned,
+// each prefixed by the path of the offending element like "$.items[2].id".
+func (s *Schema) Validate(body []byte) (violations []string) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if err := dec.Decode(&v); err != nil {
+		return []string{"Body is not JSON: " + err.Error()}
+	}
+	validateJson(v, s.schema, s.schema, "$", 0, &violations)
+	return
+}
+
+// Name of the JSON type of v.
+func jsonType(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if x == math.Trunc(x) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// Resolve the local reference ref like "#/components/schemas/Pet" in root.
+func resolveRef(root interface{}, ref string) (interface{}, error) {
+	if !hp(ref, "#") {
+		return nil, fmt.Errorf("Cannot resolve non-local $ref '%s'", ref)
+	}
+	ptr, err := url.PathUnescape(ref[1:])
+	if err != nil {
+		return nil, fmt.Errorf("Malformed $ref '%s'", ref)
+	}
+	v := root
+	for _, key := range strings.Split(ptr, "/")[1:] {
+		key = strings.Replace(strings.Replace(key, "~1", "/", -1), "~0", "~", -1)
+		switch x := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = x[key]; !ok {
+				return nil, fmt.Errorf("Unresolvable $ref '%s'", ref)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(x) {
+				return nil, fmt.Errorf("Unresolvable $ref '%s'", ref)
+			}
+			v = x[i]
+		default:
+			return nil, fmt.Errorf("Unresolvable $ref '%s'", ref)
+		}
+	}
+	return v, nil
+}
+
+// Numeric value of schema keyword key.
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	f, ok := schema[key].(float64)
+	return f, ok
+}
+
+// Check v against schema (part of root) and append the violations found at
+// path where.
+func validateJson(v, schema, root interface{}, where string, depth int, violations *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*violations = append(*violations, where+": "+fmt.Sprintf(format, args...))
+	}
+	if depth > 64 {
+		fail("Schema nested too deep (recursive $ref?)")
+		return
+	}
+	if b, ok := schema.(bool); ok {
+		if !b {
+			fail("Not allowed")
+		}
+		return
+	}
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		target, err := resolveRef(root, ref)
+		if err != nil {
+			fail("%s", err.Error())
+			return
+		}
+		validateJson(v, target, root, where, depth+1, violations)
+		return
+	}
+
+	// Type
+	if v == nil && s["nullable"] == true {
+		return
+	}
+	if t, ok := s["type"]; ok {
+		var types []string
+		switch x := t.(type) {
+		case string:
+			types = []string{x}
+		case []interface{}:
+			for _, e := range x {
+				types = append(types, fmt.Sprint(e))
+			}
+		}
+		actual, matches := jsonType(v), false
+		for _, t := range types {
+			if t == actual || (t == "number" && actual == "integer") {
+				matches = true
+			}
+		}
+		if !matches {
+			fail("Want %s, got %s", strings.Join(types, " or "), actual)
+			return
+		}
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("Value %s not in enum", compactJson(v))
+		}
+	}
+	if c, ok := s["const"]; ok && !jsonEqual(v, c) {
+		fail("Want %s, got %s", compactJson(c), compactJson(v))
+	}
+
+	// Combinations
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			validateJson(v, sub, root, where, depth+1, violations)
+		}
+	}
+	for _, kw := range []string{"anyOf", "oneOf"} {
+		list, ok := s[kw].([]interface{})
+		if !ok {
+			continue
+		}
+		valid := 0
+		for _, sub := range list {
+			var vs []string
+			validateJson(v, sub, root, where, depth+1, &vs)
+			if len(vs) == 0 {
+				valid++
+			}
+		}
+		if valid == 0 {
+			fail("Matches none of %s", kw)
+		} else if kw == "oneOf" && valid > 1 {
+			fail("Matches %d schemas of oneOf", valid)
+		}
+	}
+	if not, ok := s["not"]; ok {
+		var vs []string
+		validateJson(v, not, root, where, depth+1, &vs)
+		if len(vs) == 0 {
+			fail("Matches schema of not")
+		}
+	}
+
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if required, ok := s["required"].([]interface{}); ok {
+			for _, r := range required {
+				if _, ok := x[fmt.Sprint(r)]; !ok {
+					fail("Missing required property %s", r)
+				}
+			}
+		}
+		props, _ := s["properties"].(map[string]interface{})
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ps, ok := props[k]; ok {
+				validateJson(x[k], ps, root, where+"."+k, depth+1, violations)
+			} else if ap, ok := s["additionalProperties"]; ok {
+				if ap == false {
+					fail("Unexpected property %s", k)
+				} else {
+					validateJson(x[k], ap, root, where+"."+k, depth+1, violations)
+				}
+			}
+		}
+	case []interface{}:
+		if min, ok := schemaNumber(s, "minItems"); ok && float64(len(x)) < min {
+			fail("Want at least %g items, got %d", min, len(x))
+		}
+		if max, ok := schemaNumber(s, "maxItems"); ok && float64(len(x)) > max {
+			fail("Want at most %g items, got %d", max, len(x))
+		}
+		if items, ok := s["items"]; ok {
+			for i, e := range x {
+				validateJson(e, items, root, fmt.Sprintf("%s[%d]", where, i), depth+1, violations)
+			}
+		}
+	case string:
+		n := float64(utf8.RuneCountInString(x))
+		if min, ok := schemaNumber(s, "minLength"); ok && n < min {
+			fail("Want at least %g characters, got %g", min, n)
+		}
+		if max, ok := schemaNumber(s, "maxLength"); ok && n > max {
+			fail("Want at most %g characters, got %g", max, n)
+		}
+		if pattern, ok := s["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				fail("Bad pattern %s: %s", pattern, err.Error())
+			} else if !re.MatchString(x) {
+				fail("%q does not match %s", x, pattern)
+			}
+		}
+	case float64:
+		// exclusiveMinimum/-Maximum are numbers in JSON Schema but
+		// booleans modifying minimum/maximum in OpenAPI 3.0.
+		if min, ok := schemaNumber(s, "minimum"); ok {
+			if s["exclusiveMinimum"] == true && x <= min {
+				fail("Want more than %g, got %g", min, x)
+			} else if x < min {
+				fail("Want at least %g, got %g", min, x)
+			}
+		}
+		if max, ok := schemaNumber(s, "maximum"); ok {
+			if s["exclusiveMaximum"] == true && x >= max {
+				fail("Want less than %g, got %g", max, x)
+			} else if x > max {
+				fail("Want at most %g, got %g", max, x)
+			}
+		}
+		if min, ok := schemaNumber(s, "exclusiveMinimum"); ok && x <= min {
+			fail("Want more than %g, got %g", min, x)
+		}
+		if max, ok := schemaNumber(s, "exclusiveMaximum"); ok && x >= max {
+			fail("Want less than %g, got %g", max, x)
+		}
+	}
+}
+
+// Compact JSON representation of v.
+func compactJson(v interface{}) string {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(buf)
+}
+
+// Check if the JSON values a and b are equal.
+func jsonEqual(a, b interface{}) bool {
+	return compactJson(a) == compactJson(b)
+}
+
+// Check the body against the SCHEMA of t and report in orig.
+func testSchema(body []byte, t, orig *Test) {
+	s := t.Schema
+	if s == nil {
+		return
+	}
+	debugf("Testing Schema")
+	violations := s.Validate(body)
+	if len(violations) == 0 {
+		orig.Passed(fmt.Sprintf("schema (%s)", s.Id))
+		return
+	}
+	orig.Failed(s.Id, "Schema violated", strings.Join(violations, "\n"))
+}
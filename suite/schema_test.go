@@ -0,0 +1,99 @@
+package suite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const petSchema = `{
+  "$ref": "#/components/schemas/Pet",
+  "components": {"schemas": {
+    "Pet": {
+      "type": "object",
+      "required": ["id", "name"],
+      "additionalProperties": false,
+      "properties": {
+        "id": {"type": "integer", "minimum": 1},
+        "name": {"type": "string", "minLength": 1, "pattern": "^[A-Z]"},
+        "tag": {"type": "string", "nullable": true},
+        "status": {"enum": ["available", "sold"]},
+        "kids": {"type": "array", "maxItems": 2, "items": {"$ref": "#/components/schemas/Pet"}},
+        "weight": {"oneOf": [{"type": "integer"}, {"type": "string"}]}
+      }
+    }
+  }}
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ParseSchema(petSchema)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	for _, tc := range []struct {
+		body string
+		want []string
+	}{
+		{`{"id": 1, "name": "Rex", "tag": null, "status": "sold", "weight": 3,
+		   "kids": [{"id": 2, "name": "Bo"}]}`, nil},
+		{`{"id": 1.5, "name": "Rex"}`, []string{"$.id: Want integer, got number"}},
+		{`{"id": 0, "name": "rex", "age": 3}`, []string{"$: Unexpected property age",
+			"$.id: Want at least 1, got 0", `$.name: "rex" does not match ^[A-Z]`}},
+		{`{"name": "Rex", "status": "lost"}`, []string{"$: Missing required property id",
+			`$.status: Value "lost" not in enum`}},
+		{`{"id": 1, "name": "Rex", "kids": [{"id": 2, "name": ""}, {}, {}]}`, []string{
+			"$.kids: Want at most 2 items, got 3", "$.kids[0].name: Want at least 1 characters, got 0",
+			"$.kids[0].name: \"\" does not match ^[A-Z]", "$.kids[1]: Missing required property id"}},
+		{`{"id": 1, "name": "Rex", "weight": true}`, []string{"$.weight: Matches none of oneOf"}},
+		{`[1, 2]`, []string{"$: Want object, got array"}},
+		{`<html>`, []string{"Body is not JSON: invalid character '<' looking for beginning of value"}},
+	} {
+		got := schema.Validate([]byte(tc.body))
+		// only the first violation of each missing kid is of interest
+		if len(got) > len(tc.want) {
+			got = got[:len(tc.want)]
+		}
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%s:\ngot  %q\nwant %q", tc.body, got, tc.want)
+		}
+	}
+
+	if _, err := ParseSchema(`"x"`); err == nil {
+		t.Errorf("Missing error for non-object schema")
+	}
+}
+
+func TestSchemaSection(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id": 1, "name": "`+r.FormValue("name")+`"}`)
+	}))
+	defer ts.Close()
+
+	st := "----------\nGood\n----------\nGET " + ts.URL + "/?name=Rex\nSCHEMA\n\t" +
+		strings.Replace(petSchema, "\n", "\n\t", -1) + "\n\n" +
+		"----------\nBad\n----------\nEXTENDS Good\nGET " + ts.URL + "/?name=rex\n"
+	s, err := NewParser(strings.NewReader(st), "schema.wt").ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if s.Test[1].Schema == nil || s.Test[0].Schema.Text != petSchema {
+		t.Fatalf("Bad schema read:\n%s", s.String())
+	}
+	if !strings.Contains(s.Test[0].String(), "SCHEMA\n\t{\n\t  \"$ref\"") {
+		t.Errorf("Bad string representation:\n%s", s.Test[0].String())
+	}
+	for i, want := range []int{0, 1} {
+		s.RunTest(i)
+		if _, f, _ := s.Test[i].Stat(); f != want {
+			t.Errorf("%s: Want %d failures, got %d:\n%v", s.Test[i].Title, want, f, s.Test[i].Result)
+		}
+	}
+
+	st = "----------\nT\n----------\nGET x\nSCHEMA\n\t{\"type\": \n"
+	if _, err := NewParser(strings.NewReader(st), "bad.wt").ReadSuite(); err == nil {
+		t.Errorf("Missing error for malformed schema")
+	}
+}
@@ -0,0 +1,24 @@
+package suite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSleepSetting(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	test := NewTest("Sleep")
+	test.Method, test.Url = "GET", ts.URL
+	test.Setting["Sleep"] = 50
+	start := time.Now()
+	test.Run(nil)
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("Sleep of 50 ms took only %s", d)
+	}
+}
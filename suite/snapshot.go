@@ -0,0 +1,151 @@
+package suite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/vdobler/webtest/tag"
+)
+
+// If set the golden files of SNAPSHOT conditions are (re)written with the
+// current body instead of being compared to it.
+var UpdateSnapshots = false
+
+// Replacement text for masked content in snapshots.
+const SnapshotMask = "***"
+
+// Snapshot describes a golden file test of the response body: The body is
+// normalised by dropping (Ignore) and masking (Mask) parts of it and
+// compared to the content of the golden file.
+type Snapshot struct {
+	File   string   // the golden file as given in the suite (may be empty)
+	Mask   []string // regexps (/.../) or tag specs of content to mask
+	Ignore []string // tag specs of elements to drop
+	Id     string   // reference to source
+	path   string   // resolved path of the golden file
+}
+
+// Make a deep copy of s.
+func (s *Snapshot) Copy() *Snapshot {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.Mask = make([]string, len(s.Mask))
+	copy(c.Mask, s.Mask)
+	c.Ignore = make([]string, len(s.Ignore))
+	copy(c.Ignore, s.Ignore)
+	return &c
+}
+
+// Check if str is a /regexp/.
+func isRegexpMask(str string) bool {
+	return len(str) > 2 && hp(str, "/") && hs(str, "/")
+}
+
+// Normalise body according to the Mask and Ignore rules of s. Tag based
+// rules are applied to html bodies only (isHtml); the result is then the
+// re-serialized html document.
+func (s *Snapshot) Normalise(body []byte, isHtml bool) (norm string, err error) {
+	norm = string(body)
+
+	var tagMasks, regexpMasks []string
+	for _, m := range s.Mask {
+		if isRegexpMask(m) {
+			regexpMasks = append(regexpMasks, m[1:len(m)-1])
+		} else {
+			tagMasks = append(tagMasks, m)
+		}
+	}
+
+	if isHtml && len(tagMasks)+len(s.Ignore) > 0 {
+		var doc *tag.Node
+		doc, err = tag.ParseHtml(norm)
+		if err != nil {
+			return
+		}
+		for _, spec := range s.Ignore {
+			ts, e := tag.ParseTagSpec(spec)
+			if e != nil {
+				return "", e
+			}
+			for _, n := range tag.FindAllTags(ts, doc) {
+				n.Remove()
+			}
+		}
+		for _, spec := range tagMasks {
+			ts, e := tag.ParseTagSpec(spec)
+			if e != nil {
+				return "", e
+			}
+			keep := []string{"id"}
+			for k := range ts.Attr {
+				keep = append(keep, k)
+			}
+			for _, n := range tag.FindAllTags(ts, doc) {
+				n.Mask(SnapshotMask, keep)
+			}
+		}
+		norm = doc.Html() + "\n"
+	}
+
+	for _, re := range regexpMasks {
+		rexp, e := regexp.Compile(re)
+		if e != nil {
+			return "", e
+		}
+		norm = rexp.ReplaceAllLiteralString(norm, SnapshotMask)
+	}
+	return
+}
+
+// Compare the normalised body with the golden file (or update it).
+func testSnapshot(body []byte, isHtml bool, t, orig *Test) {
+	s := t.Snapshot
+	if s == nil {
+		return
+	}
+	debugf("Testing Snapshot")
+	cs := fmt.Sprintf("snapshot (%s) '%s'", s.Id, s.path)
+
+	norm, err := s.Normalise(body, isHtml)
+	if err != nil {
+		orig.Error(s.Id, "Bad snapshot", fmt.Sprintf("Cannot normalise body: %s", err.Error()))
+		return
+	}
+
+	if UpdateSnapshots {
+		err = os.MkdirAll(path.Dir(s.path), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(s.path, []byte(norm), 0644)
+		}
+		if err != nil {
+			orig.Error(s.Id, "Cannot write snapshot", err.Error())
+			return
+		}
+		infof("Updated snapshot %s", s.path)
+		orig.Passed(cs)
+		return
+	}
+
+	golden, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		orig.Error(s.Id, "Missing snapshot",
+			fmt.Sprintf("%s\nCannot read golden file: %s\nRun with -update-snapshots to create it.",
+				s.Id, err.Error()))
+		return
+	}
+	if string(golden) == norm {
+		orig.Passed(cs)
+		return
+	}
+
+	msg := fmt.Sprintf("%s\nBody differs from snapshot %s", s.Id, s.path)
+	if MaxDiffSize > 0 {
+		msg += "\n" + truncateDiff(textDiff(string(golden), norm))
+	}
+	orig.Failed(s.Id, "Snapshot mismatch", msg)
+}
@@ -0,0 +1,129 @@
+package suite
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+var snapshotHtml = `<html>
+<body>
+	<p>Generated 2012-03-17</p>
+	<form><input name="csrf" type="hidden" value="a1b2c3" /></form>
+	<div class="ad">Buy now!</div>
+	<span id="counter">17</span>
+</body>
+</html>`
+
+func TestSnapshotNormalise(t *testing.T) {
+	snap := &Snapshot{
+		Mask:   []string{"/[0-9]{4}-[0-9]{2}-[0-9]{2}/", "input name=csrf", "span id=counter"},
+		Ignore: []string{"div class=ad"},
+	}
+	norm, err := snap.Normalise([]byte(snapshotHtml), true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	for _, want := range []string{"Generated ***", `name="csrf"`, `value="***"`, `<span id="counter">***</span>`} {
+		if !strings.Contains(norm, want) {
+			t.Errorf("Missing %q in normalised body:\n%s", want, norm)
+		}
+	}
+	for _, unwanted := range []string{"a1b2c3", "Buy now", "2012", ">17<"} {
+		if strings.Contains(norm, unwanted) {
+			t.Errorf("Unexpected %q in normalised body:\n%s", unwanted, norm)
+		}
+	}
+
+	// Tag rules are not applied to non-html bodies.
+	norm, err = snap.Normalise([]byte("Date: 2012-03-17\n"), false)
+	if err != nil || norm != "Date: ***\n" {
+		t.Errorf("Got %q (%v)", norm, err)
+	}
+}
+
+func TestSnapshotParsing(t *testing.T) {
+	st := `
+----------------
+Home Page
+----------------
+GET http://localhost/
+SNAPSHOT
+	Mask    :=  /[0-9]+/
+	Ignore  :=  div class=ad
+
+----------------
+Other
+----------------
+GET http://localhost/other
+SNAPSHOT
+	File    :=  golden/other.html
+`
+	p := NewParser(strings.NewReader(st), "shop.wt")
+	p.Dir = "/some/dir"
+	s, err := p.ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	snap := s.Test[0].Snapshot
+	if snap == nil || len(snap.Mask) != 1 || len(snap.Ignore) != 1 {
+		t.Fatalf("Bad snapshot %#v", snap)
+	}
+	if snap.path != "/some/dir/shop.snapshots/HomePage.snap" {
+		t.Errorf("Bad default path %s", snap.path)
+	}
+	if p := s.Test[1].Snapshot.path; p != "/some/dir/golden/other.html" {
+		t.Errorf("Bad path %s", p)
+	}
+
+	p = NewParser(strings.NewReader(st+"\tMask := /(/\n"), "bad.wt")
+	if _, err = p.ReadSuite(); err == nil {
+		t.Errorf("Missing error for malformed regexp")
+	}
+}
+
+func TestSnapshotUpdateAndCompare(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webtest-snapshot")
+	if err != nil {
+		t.Fatalf("Cannot create temp dir: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	test := NewTest("Snap")
+	test.Snapshot = &Snapshot{Mask: []string{"/[0-9]+/"}, Id: "snap:1",
+		path: path.Join(dir, "sub", "snap.snap")}
+
+	// Missing golden file
+	testSnapshot([]byte("a 1\nb 2\n"), false, test, test)
+	if len(test.Result) != 1 || test.Result[0].Status != TestErrored {
+		t.Errorf("Expected error for missing golden file, got %v", test.Result)
+	}
+
+	// Create golden file
+	UpdateSnapshots = true
+	test.Result = nil
+	testSnapshot([]byte("a 1\nb 2\n"), false, test, test)
+	UpdateSnapshots = false
+	if len(test.Result) != 1 || test.Result[0].Status != TestPassed {
+		t.Errorf("Expected pass on update, got %v", test.Result)
+	}
+
+	// Same body modulo masked numbers
+	test.Result = nil
+	testSnapshot([]byte("a 7\nb 8\n"), false, test, test)
+	if len(test.Result) != 1 || test.Result[0].Status != TestPassed {
+		t.Errorf("Expected pass, got %v", test.Result)
+	}
+
+	// Different body
+	test.Result = nil
+	testSnapshot([]byte("a 7\nc 8\n"), false, test, test)
+	if len(test.Result) != 1 || test.Result[0].Status != TestFailed {
+		t.Fatalf("Expected failure, got %v", test.Result)
+	}
+	if !strings.Contains(test.Result[0].Message, "-b ***\n+c ***\n") {
+		t.Errorf("Missing diff in message:\n%s", test.Result[0].Message)
+	}
+}
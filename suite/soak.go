@@ -0,0 +1,80 @@
+package suite
+
+import (
+	"time"
+
+	"github.com/vdobler/webtest/stat"
+)
+
+// SoakSample is the outcome of one run of the test suite during a soaktest.
+type SoakSample struct {
+	Elapsed time.Duration // time since start of the soaktest
+	StressResult
+}
+
+// Soak describes a soaktest: A constant background load held for a long
+// time while the test suite is run periodically.
+type Soak struct {
+	Load     int           // number of parallel background requests (if Rate.Rate == 0)
+	Rate     OpenLoad      // open-loop background load (if Rate.Rate > 0)
+	Duration time.Duration // total duration of the soaktest
+	Interval time.Duration // the test suite is started every Interval
+}
+
+// Soaktest runs s every soak.Interval for soak.Duration while holding the
+// constant background load taken from bg. Unlike Stresstest the background
+// load is not stopped between the runs of s. sample (if non nil) is called
+// after each run of s, e.g. for reporting progress. In open-loop mode the
+// samples contain the number and errors of the background requests
+// started since the previous sample.
+func (s *Suite) Soaktest(bg *Suite, soak Soak, sample func(SoakSample)) (samples []SoakSample) {
+	kill, finished := make(chan bool), make(chan bool)
+	var stats *openLoadStats
+	load := soak.Load
+	if soak.Rate.Rate > 0 {
+		load = soak.Rate.Rate
+		soak.Rate.From, soak.Rate.Ramp = soak.Rate.Rate, 0
+		stats = &openLoadStats{rt: stat.NewHistogram(), delay: stat.NewHistogram()}
+		go openLoop(soak.Rate, bg, kill, finished, stats)
+	} else if load > 0 {
+		go bgnoise(load, bg, kill)
+	}
+	LiveMetrics.SetLoad(load)
+	debugf("Soaktest with load %d for %s", load, soak.Duration)
+
+	start := time.Now()
+	var bgN, bgErr int
+	var last time.Duration
+	for k := 0; time.Since(start) < soak.Duration; k++ {
+		result := StressResult{Load: load}
+		s.stressReps(1, 0, &result)
+		smpl := SoakSample{Elapsed: time.Since(start), StressResult: result}
+		if stats != nil {
+			stats.Lock()
+			n, e := int(stats.rt.Count()), stats.err
+			stats.Unlock()
+			smpl.BgN, smpl.BgErr = n-bgN, e-bgErr
+			bgN, bgErr = n, e
+			smpl.Rate = float64(smpl.BgN) / (smpl.Elapsed - last).Seconds()
+		}
+		last = smpl.Elapsed
+		samples = append(samples, smpl)
+		if sample != nil {
+			sample(smpl)
+		}
+
+		next := start.Add(time.Duration(k+1) * soak.Interval)
+		if end := start.Add(soak.Duration); next.After(end) {
+			break
+		}
+		time.Sleep(next.Sub(time.Now()))
+	}
+
+	if stats != nil || load > 0 {
+		kill <- true
+	}
+	if stats != nil {
+		<-finished
+	}
+	return
+}
@@ -0,0 +1,55 @@
+package suite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSoaktest(t *testing.T) {
+	var bgRequests int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bg" {
+			atomic.AddInt64(&bgRequests, 1)
+		}
+	}))
+	defer ts.Close()
+
+	parse := func(st string) *Suite {
+		p := NewParser(strings.NewReader(strings.Replace(st, "${URL}", ts.URL, -1)), "soak.wt")
+		s, err := p.ReadSuite()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+		return s
+	}
+	bg := parse("----------\nBG\n----------\nGET ${URL}/bg\n")
+	s := parse("----------\nFG\n----------\nGET ${URL}/fg\nRESPONSE\n\tStatus-Code == 200\n")
+
+	for _, soak := range []Soak{
+		{Load: 2, Duration: 300 * time.Millisecond, Interval: 100 * time.Millisecond},
+		{Rate: OpenLoad{Rate: 50}, Duration: 300 * time.Millisecond, Interval: 100 * time.Millisecond},
+	} {
+		atomic.StoreInt64(&bgRequests, 0)
+		n := 0
+		samples := s.Soaktest(bg, soak, func(SoakSample) { n++ })
+		if len(samples) != 3 || n != 3 {
+			t.Errorf("%+v: Got %d samples and %d callbacks, want 3", soak, len(samples), n)
+			continue
+		}
+		for i, d := range samples {
+			if d.N != 1 || d.Pass != 1 || d.Err != 0 {
+				t.Errorf("%+v: Bad sample %d: %d tests, %d passed, %d errored", soak, i, d.N, d.Pass, d.Err)
+			}
+			if d.Elapsed < time.Duration(i)*soak.Interval {
+				t.Errorf("%+v: Sample %d too early at %s", soak, i, d.Elapsed)
+			}
+		}
+		if atomic.LoadInt64(&bgRequests) == 0 {
+			t.Errorf("%+v: No background requests", soak)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package suite
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vdobler/webtest/tag"
+)
+
+// Extraction of a variable from a response (see EXTRACT).
+type Extraction struct {
+	Name   string // name of the variable to set
+	Source string // Body, Header, Cookie, Tag or Json
+	Spec   string // regexp, header field, cookie name, tag spec or JSON path
+	Attr   string // attribute of the tag to take instead of its text (Tag only)
+	Id     string // reference to source
+
+	re *regexp.Regexp // compiled Spec for Body
+	ts *tag.TagSpec   // parsed Spec for Tag
+}
+
+// String representation as used by the parser.
+func (e Extraction) String() string {
+	s := e.Source + " " + e.Spec
+	if e.Attr != "" {
+		s += " @" + e.Attr
+	}
+	return s
+}
+
+// Parse the extraction of variable name from src like "Body /id=(\d+)/",
+// "Header Location", "Cookie SESSION", "Tag input name=csrf @value" or
+// "Json data.items.0.id".
+func parseExtraction(name, src string) (e Extraction, err error) {
+	if !isName(name) {
+		return e, fmt.Errorf("Bad variable name '%s'", name)
+	}
+	e.Name = name
+	i := firstSpace(src)
+	if i == -1 {
+		return e, fmt.Errorf("Missing spec in '%s'", src)
+	}
+	e.Source, e.Spec = src[:i], trim(src[i:])
+	switch e.Source {
+	case "Body":
+		if len(e.Spec) < 2 || !hp(e.Spec, "/") || !hs(e.Spec, "/") {
+			return e, fmt.Errorf("Body needs a /regexp/, not '%s'", e.Spec)
+		}
+		e.re, err = regexp.Compile(e.Spec[1 : len(e.Spec)-1])
+	case "Header", "Cookie", "Json":
+	case "Tag":
+		if j := strings.LastIndex(e.Spec, " @"); j != -1 {
+			e.Spec, e.Attr = trim(e.Spec[:j]), trim(e.Spec[j+2:])
+		}
+		e.ts, err = tag.ParseSimpleTagSpec(e.Spec)
+	default:
+		err = fmt.Errorf("Unknown source '%s'", e.Source)
+	}
+	return
+}
+
+// Extract the value of e from the response: The first submatch (or the
+// whole match) of a Body regexp, a header field, the value of a received
+// cookie, the text or an attribute of the first matching tag or the element
+// of a JSON body selected by a dot separated path.
+func (e Extraction) value(response *http.Response, cookies []*http.Cookie, body []byte, doc *tag.Node) (string, error) {
+	switch e.Source {
+	case "Body":
+		m := e.re.FindSubmatch(body)
+		if m == nil {
+			return "", errors.New("No match in body")
+		}
+		if len(m) > 1 {
+			return string(m[1]), nil
+		}
+		return string(m[0]), nil
+	case "Header":
+		if v, ok := response.Header[http.CanonicalHeaderKey(e.Spec)]; ok && len(v) > 0 {
+			return v[0], nil
+		}
+		return "", errors.New("No such header field")
+	case "Cookie":
+		for i := len(cookies) - 1; i >= 0; i-- {
+			if cookies[i].Name == e.Spec {
+				return cookies[i].Value, nil
+			}
+		}
+		return "", errors.New("No such cookie received")
+	case "Tag":
+		if doc == nil {
+			return "", errors.New("Body is not parsable")
+		}
+		n := tag.FindTag(e.ts, doc)
+		if n == nil {
+			return "", errors.New("No such tag")
+		}
+		if e.Attr == "" {
+			return n.Text, nil
+		}
+		if v, ok := nodeAttr(n, strings.ToLower(e.Attr)); ok {
+			return v, nil
+		}
+		return "", fmt.Errorf("Tag has no attribute %s", e.Attr)
+	case "Json":
+		return jsonPath(body, e.Spec)
+	}
+	return "", fmt.Errorf("Unknown source '%s'", e.Source)
+}
+
+// Element of the JSON document body selected by path: Object keys and array
+// indices separated by dots. Strings are returned as is, everything else
+// as JSON.
+func jsonPath(body []byte, path string) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", fmt.Errorf("Body is not JSON: %s", err.Error())
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = x[key]; !ok {
+				return "", fmt.Errorf("No element %s in %s", key, path)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(x) {
+				return "", fmt.Errorf("No element %s in %s", key, path)
+			}
+			v = x[i]
+		default:
+			return "", fmt.Errorf("No element %s in %s", key, path)
+		}
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	buf, err := json.Marshal(v)
+	return string(buf), err
+}
+
+// Set the variables of the EXTRACT section of ti as constants in global.
+// Values which cannot be extracted are reported as failures in test unless
+// skipTests is set.
+func extractVars(test, ti, global *Test, response *http.Response, cookies []*http.Cookie,
+	body []byte, skipTests bool) {
+	if len(ti.Extract) == 0 {
+		return
+	}
+	if global == nil {
+		warnf("No global test to keep the extracted variables of '%s'.", ti.Title)
+		return
+	}
+	var doc *tag.Node
+	for _, e := range ti.Extract {
+		if e.Source == "Tag" && doc == nil && parsableBody(response) {
+			doc, _ = tag.ParseHtml(string(body))
+		}
+		v, err := e.value(response, cookies, body, doc)
+		if err != nil {
+			if !skipTests {
+				test.Failed(e.Id, "Not extracted",
+					fmt.Sprintf("Cannot extract %s from %s: %s", e.Name, e.String(), err.Error()))
+			}
+			continue
+		}
+		tracef("Extracted %s = '%s'", e.Name, v)
+		global.Const[e.Name] = v
+	}
+}
+
+// Make the sections of test given before its first STEP the template of
+// its steps: The steps inherit from test like from EXTENDS. Cookies to send
+// are put into the private cookie jar of the flow instead.
+func applyStepTemplate(test *Test) {
+	if len(test.Steps) == 0 {
+		return
+	}
+	tmpl := test.Copy()
+	tmpl.Steps, tmpl.If, tmpl.Jar = nil, "", NewCookieJar()
+	for i := range test.Steps {
+		inherit(&test.Steps[i], tmpl)
+	}
+}
+
+// Run the STEPs of test once: The steps share a private copy of the global
+// test, i.e. a private cookie jar and the variables extracted by earlier
+// steps. The results of each step are reported in test with the step name
+// prepended to their id. The flow stops at the first step which does not
+// pass.
+func (test *Test) runFlow(global *Test, skipTests bool) (duration time.Duration, body []byte, err error) {
+	flow := NewTest("Global")
+	if global != nil {
+		flow = global.Copy()
+		flow.lastPage = global.lastPage
+	}
+	for _, c := range test.Jar.All() {
+		flow.Jar.Update(*c, c.Domain)
+	}
+
+	extracted := make(map[string]bool)
+	for i := range test.Steps {
+		step := test.Steps[i].Copy()
+		step.Result = nil
+		step.Dump = test.Dump
+		step.Setting["Keep-Cookies"] = 1
+		for name := range extracted {
+			delete(step.Const, name) // extracted value in flow wins
+		}
+		if step.Repeat() == 0 || step.skip(flow) {
+			infof("Test '%s': Step '%s' skipped.", test.Title, step.Title)
+			continue
+		}
+
+		var d time.Duration
+		d, body, err = step.runSingle(flow, skipTests)
+		duration += d
+		test.Steps[i].SeqCnt = step.SeqCnt
+		for _, r := range step.Result {
+			if r.Id == "" {
+				r.Id = step.Title
+			} else {
+				r.Id = step.Title + ": " + r.Id
+			}
+			test.Result = append(test.Result, r)
+		}
+		for _, e := range step.Extract {
+			extracted[e.Name] = true
+		}
+
+		_, failed, errored := step.Stat()
+		if err != nil || failed+errored > 0 {
+			infof("Test '%s': Step '%s' did not pass, %d steps left out.",
+				test.Title, step.Title, len(test.Steps)-i-1)
+			if err == nil {
+				err = fmt.Errorf("Step '%s' did not pass", step.Title)
+			}
+			break
+		}
+	}
+
+	if global != nil {
+		global.lastPage = flow.lastPage
+	}
+	return
+}
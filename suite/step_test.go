@@ -0,0 +1,202 @@
+package suite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSteps(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+		session, _ := r.Cookie("session")
+		switch r.URL.Path {
+		case "/login":
+			if r.Method == "GET" {
+				w.Header().Set("Content-Type", "text/html")
+				fmt.Fprint(w, `<html><body><form method="post">
+<input type="hidden" name="csrf" value="c5rf"><input name="user"></form></body></html>`)
+				return
+			}
+			if r.FormValue("csrf") != "c5rf" || r.Header.Get("X-App") != "shop" {
+				http.Error(w, "bad login", http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s-" + r.FormValue("user")})
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"token": "t0k", "items": [{"id": 7}, {"id": 9}]}`)
+		case "/cart":
+			if session == nil || r.Header.Get("Authorization") != "Bearer t0k" {
+				http.Error(w, "not logged in", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, "cart of %s: item %s", session.Value, r.FormValue("item"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	st := `
+----------
+Shopping
+----------
+HEADER
+	X-App  :=  shop
+RESPONSE
+	Status-Code == 200
+
+STEP Login Page
+GET ${URL}/login
+EXTRACT
+	csrf  :=  Tag input name=csrf @value
+
+STEP Login
+POST ${URL}/login
+PARAM
+	csrf  :=  ${csrf}
+	user  :=  alice
+EXTRACT
+	token  :=  Json token
+	item   :=  Json items.1.id
+
+STEP Cart
+GET ${URL}/cart?item=${item}
+HEADER
+	Authorization  :=  Bearer ${token}
+BODY
+	Txt ~= "cart of s-alice: item 9"
+
+----------
+Broken Shopping
+----------
+STEP Cart
+GET ${URL}/cart
+RESPONSE
+	Status-Code == 200
+
+STEP Login Page
+GET ${URL}/login
+`
+	s, err := NewParser(strings.NewReader(strings.Replace(st, "${URL}", ts.URL, -1)), "step.wt").ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if len(s.Test) != 2 || len(s.Test[0].Steps) != 3 || len(s.Test[1].Steps) != 2 {
+		t.Fatalf("Bad steps read:\n%s", s.String())
+	}
+	if s.Test[0].Steps[2].Header["X-App"] != "shop" || len(s.Test[0].Steps[1].RespCond) != 1 {
+		t.Errorf("Steps did not inherit from their test:\n%s", s.Test[0].String())
+	}
+	if !strings.Contains(s.String(), "STEP Login Page\nGET ") ||
+		!strings.Contains(s.String(), "token  :=  Json token") {
+		t.Errorf("Bad string representation:\n%s", s.String())
+	}
+
+	s.RunTest(0)
+	if p, f, e := s.Test[0].Stat(); f+e != 0 || p == 0 {
+		t.Errorf("Flow failed: %d passed, %d failed, %d errored:\n%v", p, f, e, s.Test[0].Result)
+	}
+	for _, r := range s.Test[0].Result {
+		if !hp(r.Id, "Login Page") && !hp(r.Id, "Login") && !hp(r.Id, "Cart") {
+			t.Errorf("Result not reported per step: %s", r.String())
+		}
+	}
+	if s.Global == nil || s.Global.Const["csrf"] != "" || s.Global.Jar.Contains(stripPort(ts.URL[7:]), "/", "session") != nil {
+		t.Errorf("Variables or cookies of flow leaked into global test")
+	}
+
+	mu.Lock()
+	requests = nil
+	mu.Unlock()
+	s.RunTest(1)
+	if _, f, _ := s.Test[1].Stat(); f == 0 {
+		t.Errorf("Missing failure of first step")
+	}
+	if !hp(s.Test[1].Result[0].Id, "Cart: ") {
+		t.Errorf("Bad id of failure: %s", s.Test[1].Result[0].Id)
+	}
+	mu.Lock()
+	if len(requests) != 1 {
+		t.Errorf("Flow not aborted after failed step: %v", requests)
+	}
+	mu.Unlock()
+}
+
+func TestExtract(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "id", Value: "42"})
+		w.Header().Set("Location", "/next")
+		fmt.Fprint(w, `order="A-17" total=3`)
+	}))
+	defer ts.Close()
+
+	st := `
+----------
+Order
+----------
+GET ${URL}/order
+EXTRACT
+	order  :=  Body /order="([^"]+)"/
+	all    :=  Body /total=\d/
+	next   :=  Header Location
+	id     :=  Cookie id
+	gone   :=  Header X-Missing
+
+----------
+Use
+----------
+GET ${URL}/${next}/${order}
+`
+	s, err := NewParser(strings.NewReader(strings.Replace(st, "${URL}", ts.URL, -1)), "extract.wt").ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	if s.Global == nil {
+		t.Fatalf("No global test to keep the extracted variables")
+	}
+	s.RunTest(0)
+	for k, v := range map[string]string{"order": "A-17", "all": "total=3", "next": "/next", "id": "42"} {
+		if got := s.Global.Const[k]; got != v {
+			t.Errorf("Extracted %s = '%s', want '%s'", k, got, v)
+		}
+	}
+	if _, f, _ := s.Test[0].Stat(); f != 1 {
+		t.Errorf("Want one failed extraction, got %d:\n%v", f, s.Test[0].Result)
+	}
+}
+
+func TestJsonPath(t *testing.T) {
+	body := []byte(`{"a": {"b": [1, "two", {"c": true}]}, "n": 1.50}`)
+	for _, tc := range []struct{ path, want string }{
+		{"a.b.0", "1"}, {"a.b.1", "two"}, {"a.b.2.c", "true"}, {"n", "1.50"},
+		{"a.b.2", `{"c":true}`}, {"a.x", ""}, {"a.b.3", ""}, {"n.x", ""},
+	} {
+		got, err := jsonPath(body, tc.path)
+		if got != tc.want || (err == nil) != (tc.want != "") {
+			t.Errorf("%s: got '%s' (%v), want '%s'", tc.path, got, err, tc.want)
+		}
+	}
+}
+
+func TestStepErrors(t *testing.T) {
+	for _, st := range []string{
+		"----------\nGlobal\n----------\nGET x\nSTEP A\nGET y\n",
+		"----------\nT\n----------\nEXTRACT\n\tx := Header X\nSTEP A\nGET y\n",
+		"----------\nT\n----------\nSTEP A\nEXTENDS U\n",
+		"----------\nT\n----------\nGET x\nEXTRACT\n\tx := Foo bar\n",
+		"----------\nT\n----------\nGET x\nEXTRACT\n\tx := Body /(/\n",
+		"----------\nT\n----------\nGET x\nEXTRACT\n\tx-y := Header X\n",
+	} {
+		if _, err := NewParser(strings.NewReader(st), "bad.wt").ReadSuite(); err == nil {
+			t.Errorf("Missing error for\n%s", st)
+		}
+	}
+}
@@ -13,7 +13,10 @@ import (
 	"math"
 	"os"
 	"runtime"
+	"sync"
 	"time"
+
+	"github.com/vdobler/webtest/stat"
 )
 
 // Log level of suite. 0: none, 1:err, 2:warn, 3:info, 4:debug, 5:trace, 6:supertrace
@@ -63,10 +66,11 @@ func supertracef(f string, m ...interface{}) {
 
 // Suite is a collection of test.
 type Suite struct {
-	Global *Test  // the gloabl test-template and cookie jar
-	Test   []Test // list of all tests
-	Name   string // the name of this suite
-	bgload int    // the background load
+	Global   *Test    // the gloabl test-template and cookie jar
+	Test     []Test   // list of all tests
+	Name     string   // the name of this suite
+	UserData UserData // variables of the virtual users if used as background suite
+	bgload   int      // the background load
 }
 
 // NewSuite sets up an empty Suite.
@@ -91,72 +95,114 @@ func (s *Suite) RunTest(n int) {
 
 // BenchTest will run test number n for count many times.
 // Returned are the list durations (in ms)
-func (s *Suite) BenchTest(n, count int) (dur []int, f int, err error) {
+func (s *Suite) BenchTest(n, count int) (dur *stat.Histogram, samples []int64, f int, err error) {
 	if n < 0 || n >= len(s.Test) {
 		errorf("No such test")
 		err = errors.New("No such test")
 		return
 	}
 
-	dur, f, err = s.Test[n].Bench(s.Global, count)
+	dur, samples, f, err = s.Test[n].Bench(s.Global, count)
 	return
 }
 
-// Run the request in test (do not perform checks) and reply on channel done when finished.
-func bgRun(test, global *Test, done chan bool) {
-	tracef("Started background test %s", test.Title)
-	test.RunWithoutTest(global)
-	done <- true
-	tracef("Finished background test %s.", test.Title)
+// Run scenarios as virtual user vu (do not perform checks) until stop is closed.
+func bgRun(vu *virtualUser, p *scenarioPicker, stop chan bool, done *sync.WaitGroup) {
+	defer done.Done()
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		p.next().run(vu, p, true)
+	}
 }
 
-// Make n request of bg suite in parallel until shut down via signal on channel kill.
+// Make n scenarios (requests or journeys) of bg suite in parallel until shut
+// down via signal on channel kill. Each of the n parallel workers is a
+// virtual user of its own. The scenarios are choosen randomly according
+// to their Weight.
 func bgnoise(n int, bg *Suite, kill chan bool) {
-	m := len(bg.Test)
-	var done chan bool
-	done = make(chan bool)
-	var i int = 0
+	p := newScenarioPicker(bg, randomSeed())
+	if p.next() == nil {
+		warnf("No background tests to run.")
+		<-kill
+		return
+	}
 	debugf("Initializing bgnoise")
-	for ; i < n; i++ {
-		go bgRun(&(bg.Test[i%m]), bg.Global, done)
+	stop := make(chan bool)
+	var done sync.WaitGroup
+	for i := 0; i < n; i++ {
+		done.Add(1)
+		go bgRun(newVirtualUser(i, bg), p, stop, &done)
 	}
 
-	var killed bool
-	for {
-		select {
-		case killed = <-kill:
-			debugf("Killed bgnoise")
-		case _ = <-done:
-			// trace("bg process done")
-			if !killed {
-				i++
-				// trace("Next bg test %s.", bg.Test[i % m].Title)
-				go bgRun(&(bg.Test[i%m]), bg.Global, done)
-			} else {
-				n--
-				// trace("Left running %d:", n)
-				if n == 0 {
-					debugf("Finished begnois")
-					return
-				}
-			}
-		}
-	}
+	<-kill
+	debugf("Killed bgnoise")
+	close(stop)
+	done.Wait()
+	debugf("Finished begnois")
 }
 
 // Structure to collect results from a stresstest run.
 type StressResult struct {
-	Load   int   // number of parallel background requests
-	N      int   // total number of tests and repetitions
-	Pass   int   // number of passed tests
-	Fail   int   // number of failed tests
-	Err    int   // number errors (e.g. unable to connect)
-	AvgRT  int64 // average response time in ms
-	MaxRT  int64 // maximum response time in ms
-	MinRT  int64 // minimum response time in ms
-	Total  int   // total number of tests performed
-	RT     []int
-	Detail map[string][]int // maps Test.Title to response times in ms.
+	Load   int                        // number of parallel background requests (or rate in open-loop mode)
+	N      int                        // total number of tests and repetitions
+	Pass   int                        // number of passed tests
+	Fail   int                        // number of failed tests
+	Err    int                        // number errors (e.g. unable to connect)
+	AvgRT  int64                      // average response time in ms
+	MaxRT  int64                      // maximum response time in ms
+	MinRT  int64                      // minimum response time in ms
+	Total  int                        // total number of tests performed
+	RT     *stat.Histogram            // response times in µs
+	Detail map[string]*stat.Histogram // maps Test.Title to response times in µs.
+
+	// Background requests in open-loop mode (see RateStresstest).
+	Rate    float64         // actual rate of background requests per second
+	BgN     int             // number of background requests performed
+	BgErr   int             // number of errored background requests
+	BgRT    *stat.Histogram // response times in µs measured from the intended start
+	BgDelay *stat.Histogram // delay in µs of the actual start after the intended start
+}
+
+// Merge adds the tests, background requests and response times of o to r.
+// The load of r is kept.
+func (r *StressResult) Merge(o StressResult) {
+	if r.N+o.N > 0 {
+		r.AvgRT = (r.AvgRT*int64(r.N) + o.AvgRT*int64(o.N)) / int64(r.N+o.N)
+	}
+	if o.N > 0 && (r.N == 0 || o.MaxRT > r.MaxRT) {
+		r.MaxRT = o.MaxRT
+	}
+	if o.N > 0 && (r.N == 0 || o.MinRT < r.MinRT) {
+		r.MinRT = o.MinRT
+	}
+	r.N += o.N
+	r.Pass += o.Pass
+	r.Fail += o.Fail
+	r.Err += o.Err
+	r.Total += o.Total
+	mergeHist := func(h **stat.Histogram, o *stat.Histogram) {
+		if *h == nil {
+			*h = stat.NewHistogram()
+		}
+		(*h).Merge(o)
+	}
+	mergeHist(&r.RT, o.RT)
+	if r.Detail == nil {
+		r.Detail = make(map[string]*stat.Histogram)
+	}
+	for title, h := range o.Detail {
+		d := r.Detail[title]
+		mergeHist(&d, h)
+		r.Detail[title] = d
+	}
+	r.BgN += o.BgN
+	r.BgErr += o.BgErr
+	mergeHist(&r.BgRT, o.BgRT)
+	mergeHist(&r.BgDelay, o.BgDelay)
 }
 
 // Perform reps runs of s while running load of load parallel background request taken from bg.
@@ -168,10 +214,53 @@ func (s *Suite) Stresstest(bg *Suite, load, reps int, rampSleep int64) (result S
 		// start bg load
 	}
 
+	result.Load = load
+	LiveMetrics.SetLoad(load)
+	s.stressReps(reps, rampSleep, &result)
+
+	if load > 0 {
+		kill <- true
+	}
+
+	time.Sleep(time.Duration(rampSleep) * time.Millisecond)
+	return
+}
+
+// Perform reps runs of s while background requests taken from bg are
+// started at the (open-loop) arrival rate given by load. Unlike Stresstest
+// the load on the server does not drop if the server slows down.
+func (s *Suite) RateStresstest(bg *Suite, load OpenLoad, reps int, rampSleep int64) (result StressResult) {
+	kill, finished := make(chan bool), make(chan bool)
+	stats := &openLoadStats{rt: stat.NewHistogram(), delay: stat.NewHistogram()}
+	start := time.Now()
+	go openLoop(load, bg, kill, finished, stats)
+
+	result.Load = load.Rate
+	LiveMetrics.SetLoad(load.Rate)
+	s.stressReps(reps, rampSleep, &result)
+
+	kill <- true
+	elapsed := time.Since(start)
+	<-finished
+
+	result.BgN, result.BgErr = int(stats.rt.Count()), stats.err
+	result.BgRT, result.BgDelay = stats.rt, stats.delay
+	if elapsed > 0 {
+		result.Rate = float64(result.BgN) / elapsed.Seconds()
+	}
+	debugf("Rate %d: Performed %d background requests (%.1f rps), %d errors.",
+		load.Rate, result.BgN, result.Rate, result.BgErr)
+
+	time.Sleep(time.Duration(rampSleep) * time.Millisecond)
+	return
+}
+
+// Perform reps runs of s and collect response times and results in result.
+func (s *Suite) stressReps(reps int, rampSleep int64, result *StressResult) {
 	result.MaxRT = math.MinInt64
 	result.MinRT = math.MaxInt64
-	result.Load = load
-	result.Detail = make(map[string][]int)
+	result.RT = stat.NewHistogram()
+	result.Detail = make(map[string]*stat.Histogram)
 
 	for rep := 1; rep <= reps; rep++ {
 		infof("Repetition %d of %d of test suite:", rep, reps)
@@ -180,16 +269,24 @@ func (s *Suite) Stresstest(bg *Suite, load, reps int, rampSleep int64) (result S
 				infof("Test no '%s' is disabled.", t.Title)
 				continue
 			}
+			if t.skip(s.Global) {
+				continue
+			}
 			time.Sleep(time.Duration(rampSleep) * time.Millisecond)
 			tc := t.Copy()
 			runtime.GC()
-			duration, _, _ := tc.RunSingle(s.Global, false)
+			duration, _, _ := tc.runSingle(s.Global, false)
 
-			rt := int64(duration)
-			result.RT = append(result.RT, int(rt))
-			result.Detail[t.Title] = append(result.Detail[t.Title], int(rt))
+			rt := int64(duration / time.Millisecond)
+			us := int64(duration / time.Microsecond)
+			result.RT.Record(us)
+			if result.Detail[t.Title] == nil {
+				result.Detail[t.Title] = stat.NewHistogram()
+			}
+			result.Detail[t.Title].Record(us)
 			passed, failed, errored := tc.Stat()
 			total := passed + failed
+			LiveMetrics.Record("test", t.Title, duration, failed > 0, errored > 0)
 
 			result.N++
 			if rt < result.MinRT {
@@ -209,14 +306,7 @@ func (s *Suite) Stresstest(bg *Suite, load, reps int, rampSleep int64) (result S
 		result.AvgRT /= int64(result.N)
 	}
 	debugf("Load %d: Response Time %d / %d (avg/max). Status %d / %d / %d (err/pass/fail). %d / %d (tests/checks).",
-		load, result.AvgRT, result.MaxRT, result.Err, result.Pass, result.Fail, result.N, result.Total)
-
-	if load > 0 {
-		kill <- true
-	}
-
-	time.Sleep(time.Duration(rampSleep) * time.Millisecond)
-	return
+		result.Load, result.AvgRT, result.MaxRT, result.Err, result.Pass, result.Fail, result.N, result.Total)
 }
 
 // Stepper is a load-increaser which yields the next number of background tasks.
@@ -15,6 +15,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/vdobler/webtest/stat"
 	"github.com/vdobler/webtest/tag"
 	"net/url"
 )
@@ -26,30 +27,45 @@ var (
 // Test collects all information about one test to perform, that is one URL fetched
 // and conditions tested.
 type Test struct {
-	Title      string              // The title of the test
-	Method     string              // Method: GET or POST (in future also POST:mp for multipart posts)
-	Url        string              // full URL
-	Header     map[string]string   // key/value pairs for request header
-	Jar        *CookieJar          // cookies to send
-	RespCond   []Condition         // list of conditions the response header must fullfill
-	CookieCond []Condition         // conditions for recieved cookies
-	BodyCond   []Condition         // conditions for the body (text or binary)
-	Tag        []TagCondition      // list of tags to look for in the body
-	Log        []LogCondition      // list of conditions to test on "log" files
-	Validation []string            // list of validations to perform
-	Pre        []string            // currently unused: list of test which are prerequisites to this test
-	Param      map[string][]string // request parameter
-	Setting    map[string]int      // setting like repetition, sleep time, etc. for this test
-	Const      map[string]string   // const variables
-	Rand       map[string][]string // random varibales
-	Seq        map[string][]string // sequence variables
-	SeqCnt     map[string]int      // internal stuff for sequnece variables
-	Vars       map[string]string   // internal stuff for variables
-	Result     []Result            // list of pass/fails reports
-	Body       []byte              // body of last non-failing response
-	Dump       io.Writer           // a writer to dump requests and responses to
-	Before     [][]string          // list of commands to execute before test
-	After      [][]string          // list of commands to execute afterwards
+	Title       string              // The title of the test
+	Method      string              // Method: GET or POST (in future also POST:mp for multipart posts)
+	Url         string              // full URL
+	Header      map[string]string   // key/value pairs for request header
+	Auth        map[string]string   // authentication of requests (see AUTH)
+	Jar         *CookieJar          // cookies to send
+	RespCond    []Condition         // list of conditions the response header must fullfill
+	CookieCond  []Condition         // conditions for recieved cookies
+	BodyCond    []Condition         // conditions for the body (text or binary)
+	ImageCond   []Condition         // conditions for image bodies
+	ArchiveCond []Condition         // conditions for zip, tar and gzip bodies
+	PdfCond     []Condition         // conditions for pdf bodies
+	Tag         []TagCondition      // list of tags to look for in the body
+	Log         []LogCondition      // list of conditions to test on "log" files
+	Snapshot    *Snapshot           // golden file to compare the body with
+	Schema      *Schema             // JSON schema the body must be valid against (see SCHEMA)
+	Validation  []string            // list of validations to perform
+	Pre         []string            // currently unused: list of test which are prerequisites to this test
+	Extends     string              // title of the test this test is based on (cleared once resolved)
+	If          string              // run test only if this condition holds (see IF)
+	Form        string              // selector of the form on the previous page to submit (see FORM)
+	Steps       []Test              // steps of a flow, run instead of the request of the test (see STEP)
+	Extract     []Extraction        // variables to extract from the response (see EXTRACT)
+	Param       map[string][]string // request parameter
+	SendBody    string              // request body sent as is (see SEND-BODY)
+	Setting     map[string]int      // setting like repetition, sleep time, etc. for this test
+	Const       map[string]string   // const variables
+	Rand        map[string][]string // random varibales
+	Seq         map[string][]string // sequence variables
+	SeqCnt      map[string]int      // internal stuff for sequnece variables
+	Vars        map[string]string   // internal stuff for variables
+	Result      []Result            // list of pass/fails reports
+	Body        []byte              // body of last non-failing response
+	Dump        io.Writer           // a writer to dump requests and responses to
+	Before      [][]string          // list of commands to execute before test
+	After       [][]string          // list of commands to execute afterwards
+
+	extendsPos string // position of EXTENDS in the suite for error messages
+	lastPage   *page  // last response received (kept in the global test for FORM)
 }
 
 type TestStatus int
@@ -102,9 +118,21 @@ func (result Result) AsText() string {
 func (src *Test) Copy() (dest *Test) {
 	dest = new(Test)
 	dest.Title = src.Title
+	dest.Extends, dest.extendsPos = src.Extends, src.extendsPos
+	dest.If = src.If
+	dest.Form = src.Form
+	if len(src.Steps) > 0 {
+		dest.Steps = make([]Test, len(src.Steps))
+		for i := range src.Steps {
+			dest.Steps[i] = *src.Steps[i].Copy()
+		}
+	}
+	dest.Extract = make([]Extraction, len(src.Extract))
+	copy(dest.Extract, src.Extract)
 	dest.Method = src.Method
 	dest.Url = src.Url
 	dest.Header = copyMap(src.Header)
+	dest.Auth = copyMap(src.Auth)
 	dest.Jar = src.Jar.Copy()
 	dest.RespCond = make([]Condition, len(src.RespCond))
 	copy(dest.RespCond, src.RespCond)
@@ -112,6 +140,12 @@ func (src *Test) Copy() (dest *Test) {
 	copy(dest.CookieCond, src.CookieCond)
 	dest.BodyCond = make([]Condition, len(src.BodyCond))
 	copy(dest.BodyCond, src.BodyCond)
+	dest.ImageCond = make([]Condition, len(src.ImageCond))
+	copy(dest.ImageCond, src.ImageCond)
+	dest.ArchiveCond = make([]Condition, len(src.ArchiveCond))
+	copy(dest.ArchiveCond, src.ArchiveCond)
+	dest.PdfCond = make([]Condition, len(src.PdfCond))
+	copy(dest.PdfCond, src.PdfCond)
 	dest.Validation = make([]string, len(src.Validation))
 	copy(dest.Validation, src.Validation)
 	dest.Tag = make([]TagCondition, len(src.Tag))
@@ -122,6 +156,7 @@ func (src *Test) Copy() (dest *Test) {
 	dest.Pre = make([]string, len(src.Pre))
 	copy(dest.Pre, src.Pre)
 	dest.Param = copyMultiMap(src.Param)
+	dest.SendBody = src.SendBody
 	dest.Setting = make(map[string]int, len(src.Setting))
 	for k, v := range src.Setting {
 		dest.Setting[k] = v
@@ -141,6 +176,8 @@ func (src *Test) Copy() (dest *Test) {
 	dest.Before = src.Before
 	dest.After = src.After
 	dest.Log = src.Log
+	dest.Snapshot = src.Snapshot.Copy()
+	dest.Schema = src.Schema
 
 	return
 }
@@ -219,6 +256,7 @@ func NewTest(title string) *Test {
 	t := Test{Title: title}
 
 	t.Header = make(map[string]string)
+	t.Auth = make(map[string]string)
 	t.Jar = NewCookieJar()
 	t.Param = make(map[string][]string)
 	t.Setting = make(map[string]int, len(DefaultSettings))
@@ -253,6 +291,9 @@ func (t *Test) KeepCookies() int { return t.getSetting("Keep-Cookies") }
 func (t *Test) Abort() int       { return t.getSetting("Abort") }
 func (t *Test) DoDump() int      { return t.getSetting("Dump") }
 func (t *Test) MaxTime() int     { return t.getSetting("Max-Time") }
+func (t *Test) Weight() int      { return t.getSetting("Weight") }
+func (t *Test) Think() int       { return t.getSetting("Think") }
+func (t *Test) Journey() int     { return t.getSetting("Journey") }
 
 // Look for name in cookies. Return index if found and -1 otherwise.
 // Looup happens from behind as last setting wins in browser.
@@ -396,14 +437,16 @@ func testBody(body []byte, t, orig *Test) {
 			tracef("Text Matching '%s'", c.String())
 			if ok, was := c.Fullfilled(string(body)); !ok {
 				orig.Failed(c.Id, "Txt Failed",
-					fmt.Sprintf("%s\nTesting for %s\nBut got: %s", c.Id, c.String(), was))
+					fmt.Sprintf("%s\nTesting for %s\nBut got: %s%s", c.Id, c.String(), was,
+						c.Diff(string(body))))
 			} else {
 				orig.Passed(cs)
 			}
 		case "Bin":
 			if ok, was := c.BinFullfilled(body); !ok {
 				orig.Failed(c.Id, "Bin Failed",
-					fmt.Sprintf("%s\nTesting for %s\nBut got: %s", c.Id, c.String(), was))
+					fmt.Sprintf("%s\nTesting for %s\nBut got: %s%s", c.Id, c.String(), was,
+						c.BinDiff(body)))
 			} else {
 				orig.Passed(cs)
 			}
@@ -437,14 +480,16 @@ func testTags(t, orig *Test, doc *tag.Node) {
 					orig.Passed(cs)
 				} else {
 					orig.Failed(tc.Id, "Missing tag",
-						fmt.Sprintf("%s\nMissing\n%s", tc.Id, tc.String()))
+						fmt.Sprintf("%s\nMissing\n%s%s", tc.Id, tc.String(),
+							closestCandidates(&tc.Spec, doc)))
 				}
 			} else {
 				if n == nil {
 					orig.Passed(cs)
 				} else {
 					orig.Failed(tc.Id, "Forbidden Tag",
-						fmt.Sprintf("%s\nForbidden\n%s", tc.Id, tc.String()))
+						fmt.Sprintf("%s\nForbidden\n%s\nFound in line %d: %s",
+							tc.Id, tc.String(), n.Line, tagSnippet(n)))
 				}
 			}
 		case CountEqual, CountNotEqual, CountLess, CountLessEqual, CountGreater, CountGreaterEqual:
@@ -453,38 +498,43 @@ func testTags(t, orig *Test, doc *tag.Node) {
 			case CountEqual:
 				if got != exp {
 					orig.Failed(tc.Id, "Wrong tag count",
-						fmt.Sprintf("%s\nFound %d expected %d\n%s",
-							tc.Id, got, exp, tc.String()))
+						fmt.Sprintf("%s\nFound %d expected %d\n%s%s",
+							tc.Id, got, exp, tc.String(), countDetails(&tc.Spec, doc, got < exp)))
 					continue
 				}
 			case CountNotEqual:
 				if got == exp {
 					orig.Failed(tc.Id, "Wrong tag count",
-						fmt.Sprintf("%s: Found %d expected != %d", cs, got, exp))
+						fmt.Sprintf("%s: Found %d expected != %d%s", cs, got, exp,
+							countDetails(&tc.Spec, doc, false)))
 					continue
 				}
 			case CountLess:
 				if got >= exp {
 					orig.Failed(tc.Id, "Wrong tag count",
-						fmt.Sprintf("%s: Found %d expected < %d", cs, got, exp))
+						fmt.Sprintf("%s: Found %d expected < %d%s", cs, got, exp,
+							countDetails(&tc.Spec, doc, false)))
 					continue
 				}
 			case CountLessEqual:
 				if got > exp {
 					orig.Failed(tc.Id, "Wrong tag count",
-						fmt.Sprintf("%s: Found %d expected <= %d", cs, got, exp))
+						fmt.Sprintf("%s: Found %d expected <= %d%s", cs, got, exp,
+							countDetails(&tc.Spec, doc, false)))
 					continue
 				}
 			case CountGreater:
 				if got <= exp {
 					orig.Failed(tc.Id, "Wrong tag count",
-						fmt.Sprintf("%s: Found %d expected > %d", cs, got, exp))
+						fmt.Sprintf("%s: Found %d expected > %d%s", cs, got, exp,
+							countDetails(&tc.Spec, doc, true)))
 					continue
 				}
 			case CountGreaterEqual:
 				if got < exp {
 					orig.Failed(tc.Id, "Wrong tag count",
-						fmt.Sprintf("%s: Found %d expected >= %d", cs, got, exp))
+						fmt.Sprintf("%s: Found %d expected >= %d%s", cs, got, exp,
+							countDetails(&tc.Spec, doc, true)))
 					continue
 				}
 			}
@@ -495,6 +545,57 @@ func testTags(t, orig *Test, doc *tag.Node) {
 	}
 }
 
+// Number of closest candidate nodes reported for a failed tag condition.
+var TagCandidates = 3
+
+// Maximal length of the html snippet of a node in failure messages.
+var TagSnippetLen = 120
+
+// Short one-line html of node n for failure messages.
+func tagSnippet(n *tag.Node) string {
+	h := strings.Join(strings.Fields(n.Html()), " ")
+	if len(h) > TagSnippetLen {
+		h = h[:TagSnippetLen-3] + "..."
+	}
+	return h
+}
+
+// Describe the nodes in doc which resemble ts most closely together with
+// the list of criteria they fail. Returns the empty string if there are
+// no candidates at all.
+func closestCandidates(ts *tag.TagSpec, doc *tag.Node) (s string) {
+	cand := tag.ClosestNodes(ts, doc, TagCandidates)
+	if len(cand) == 0 {
+		return
+	}
+	s = "\nClosest candidates:"
+	for i, mf := range cand {
+		s += fmt.Sprintf("\n %d. line %d (%d mismatches): %s",
+			i+1, mf.Node.Line, mf.Total(), tagSnippet(mf.Node))
+		for _, f := range mf.Fail {
+			s += "\n      - " + f
+		}
+	}
+	return
+}
+
+// Details for a wrong tag count: the lines of the found tags and, if
+// there are too few, the closest candidates.
+func countDetails(ts *tag.TagSpec, doc *tag.Node, tooFew bool) (s string) {
+	found := tag.FindAllTags(ts, doc)
+	if len(found) > 0 {
+		lines := make([]string, len(found))
+		for i, n := range found {
+			lines[i] = fmt.Sprintf("%d", n.Line)
+		}
+		s = "\nFound in lines " + strings.Join(lines, ", ")
+	}
+	if tooFew {
+		s += closestCandidates(ts, doc)
+	}
+	return
+}
+
 // List of allready checked URLs in this run
 var ValidUrls = map[string]bool{}
 
@@ -752,6 +853,14 @@ func prepareTest(t, global *Test) *Test {
 	// deep copy
 	test := t.Copy()
 
+	if test.Form != "" {
+		if err := fillForm(test, global); err != nil {
+			t.Error("Form", "Cannot submit form", err.Error())
+			test.Url = ""
+			return test
+		}
+	}
+
 	// prepare url and fail if unparsable
 	test.Url = substitute(test.Url, test, global, t)
 	u, ue := url.Parse(test.Url)
@@ -762,9 +871,16 @@ func prepareTest(t, global *Test) *Test {
 
 	if global != nil {
 		addMissingHeader(&test.Header, &global.Header)
+		if len(test.Auth) == 0 {
+			test.Auth = copyMap(global.Auth)
+		}
 		addMissingCookies(test.Jar, global.Jar, u)
 		test.RespCond = addMissingCond(test.RespCond, global.RespCond)
 		test.BodyCond = addAllCond(test.BodyCond, global.BodyCond)
+		if test.Snapshot != nil && global.Snapshot != nil {
+			test.Snapshot.Mask = append(test.Snapshot.Mask, global.Snapshot.Mask...)
+			test.Snapshot.Ignore = append(test.Snapshot.Ignore, global.Snapshot.Ignore...)
+		}
 	}
 
 	substituteVariables(test, global, t)
@@ -824,6 +940,52 @@ func (test *Test) init() {
 	}
 }
 
+// Value of s in an IF condition: Variables are replaced by their CONST
+// values, unset variables by the empty string.
+func ifValue(s string, test, global *Test) string {
+	v, err := expandExprs(s, func(name string) (string, bool) {
+		if val, ok := Const[name]; ok {
+			return val, true
+		} else if val, ok := test.Const[name]; ok {
+			return val, true
+		} else if global != nil {
+			return global.Const[name], true
+		}
+		return "", true
+	})
+	if err != nil {
+		errorf("Cannot evaluate '%s': %s", s, err.Error())
+	}
+	return v
+}
+
+// Check the IF condition of test. Returns true if test should be skipped.
+// A condition without operator holds if it is non-empty.
+func (test *Test) skip(global *Test) bool {
+	if test.If == "" {
+		return false
+	}
+	lhs, op, rhs, err := parseIf(test.If)
+	if err != nil {
+		errorf("Bad IF condition of test '%s': %s", test.Title, err.Error())
+		return true
+	}
+	l, r := ifValue(lhs, test, global), ifValue(rhs, test, global)
+	var holds bool
+	switch op {
+	case "==":
+		holds = l == r
+	case "!=":
+		holds = l != r
+	default:
+		holds = l != ""
+	}
+	if !holds {
+		infof("Test '%s' skipped: IF %s does not hold.", test.Title, test.If)
+	}
+	return !holds
+}
+
 // Run a test. Number of repetitions (or no run at all) is taken from "Repeat"
 // field in Param. If global is non nil it will be used as "template" for the
 // test. The test.Result field is updated.
@@ -833,6 +995,9 @@ func (test *Test) Run(global *Test) {
 		infof("Test '%s' is disabled.", test.Title)
 		return
 	}
+	if test.skip(global) {
+		return
+	}
 
 	test.init()
 
@@ -868,6 +1033,9 @@ func (test *Test) RunWithoutTest(global *Test) {
 		infof("Test no '%s' is disabled.", test.Title)
 		return
 	}
+	if test.skip(global) {
+		return
+	}
 
 	test.init()
 	test.Setting["Tries"] = 0 // no test -> no need to try to succeed
@@ -877,8 +1045,9 @@ func (test *Test) RunWithoutTest(global *Test) {
 	return
 }
 
-// Benchmark test.
-func (test *Test) Bench(global *Test, count int) (durations []int, failures int, err error) {
+// Benchmark test. The response times are recorded in microseconds, in the
+// histogram durations and unbinned in samples.
+func (test *Test) Bench(global *Test, count int) (durations *stat.Histogram, samples []int64, failures int, err error) {
 	test.init()
 	test.Dump = nil // prevent dumping during benchmarking
 	test.Validation = nil
@@ -888,7 +1057,8 @@ func (test *Test) Bench(global *Test, count int) (durations []int, failures int,
 		count = 5
 	}
 
-	durations = make([]int, count)
+	durations = stat.NewHistogram()
+	samples = make([]int64, 0, count)
 	total, okay := 0, 0
 
 	for okay < count {
@@ -898,12 +1068,14 @@ func (test *Test) Bench(global *Test, count int) (durations []int, failures int,
 			return
 		}
 		infof("Bench '%s':", test.Title)
-		dur, _, e := test.RunSingle(global, false)
+		dur, _, e := test.runSingle(global, false)
 		total++
+		LiveMetrics.Record("bench", test.Title, dur, false, e != nil)
 		if e != nil {
 			warnf("Failure during bench")
 		} else {
-			durations[okay] = dur
+			durations.Record(int64(dur / time.Microsecond))
+			samples = append(samples, int64(dur/time.Microsecond))
 			okay++
 		}
 	}
@@ -1074,7 +1246,20 @@ func checkLogContent(test *Test, buf []byte, log LogCondition) {
 // recieved body or error.  If request itself failed, then err is non nil and contains the reason.
 // Logs the results of the tests in Result field.
 func (test *Test) RunSingle(global *Test, skipTests bool) (duration int, body []byte, err error) {
+	d, body, err := test.runSingle(global, skipTests)
+	return int(d / time.Millisecond), body, err
+}
+
+// Like RunSingle but returns the exact duration.
+func (test *Test) runSingle(global *Test, skipTests bool) (duration time.Duration, body []byte, err error) {
+	if len(test.Steps) > 0 {
+		return test.runFlow(global, skipTests)
+	}
 	ti := prepareTest(test, global)
+	if ti.Form != "" && ti.Url == "" {
+		err = errors.New("Cannot submit form")
+		return
+	}
 
 	// Before Commands and log file initialisation
 	var logfilesize map[string]int64 // sizes of log files in byte; same order as test.Log
@@ -1104,23 +1289,25 @@ func (test *Test) RunSingle(global *Test, skipTests bool) (duration int, body []
 			reqerr   error
 		)
 
-		if ti.Method == "GET" {
-			response, url_, cookies, reqerr = Get(ti)
-		} else if ti.Method == "POST" || ti.Method == "POST:mp" {
-			response, url_, cookies, reqerr = Post(ti)
+		if ti.Method != "" {
+			response, url_, cookies, reqerr = Do(ti)
 		}
-		duration = int(time.Since(starttime) / time.Millisecond)
+		duration = time.Since(starttime)
 
 		if reqerr != nil {
 			test.Error("Request", "Failed Request", reqerr.Error())
 			err = fmt.Errorf("Error: %s", reqerr.Error())
 		} else {
-			body = performChecks(test, ti, global, response, cookies, url_, duration, skipTests)
+			body = performChecks(test, ti, global, response, cookies, url_,
+				int(duration/time.Millisecond), skipTests)
+			if global != nil {
+				global.lastPage = &page{body: body, url: url_}
+			}
 		}
 
 		if test.Sleep() > 0 {
-			tracef("Sleeping for %d seconds.", test.Sleep())
-			time.Sleep(time.Duration(test.Sleep()) + time.Millisecond)
+			tracef("Sleeping for %d ms.", test.Sleep())
+			time.Sleep(time.Duration(test.Sleep()) * time.Millisecond)
 		}
 
 		tryCnt++
@@ -1179,6 +1366,7 @@ func performChecks(test, ti, global *Test, response *http.Response, cookies []*h
 	url_ string, duration int, skipTests bool) (body []byte) {
 
 	body = readBody(response.Body)
+	body = decodeContent(body, response.Header.Get("Content-Encoding"))
 
 	tracef("Recieved cookies: %v", cookies)
 	if len(cookies) > 0 && test.KeepCookies() == 1 && global != nil {
@@ -1193,6 +1381,8 @@ func performChecks(test, ti, global *Test, response *http.Response, cookies []*h
 		}
 	}
 
+	extractVars(test, ti, global, response, cookies, body, skipTests)
+
 	if skipTests {
 		return
 	}
@@ -1207,11 +1397,15 @@ func performChecks(test, ti, global *Test, response *http.Response, cookies []*h
 		dumpBody(body, ti.Title, url_, response.Header.Get("Content-Type"))
 	}
 	testBody(body, ti, test)
+	testImage(body, ti, test)
+	testArchive(body, ti, test)
+	testPdf(body, ti, test)
 
 	// Parse html to doc
 	var doc *tag.Node
+	isHtml := parsableBody(response)
 	if len(ti.Tag) > 0 || hasLinkValidation(ti.Validation) {
-		if parsableBody(response) {
+		if isHtml {
 			var e error
 			doc, e = tag.ParseHtml(string(body))
 			if e != nil {
@@ -1227,6 +1421,12 @@ func performChecks(test, ti, global *Test, response *http.Response, cookies []*h
 	// Tag:
 	testTags(ti, test, doc)
 
+	// Snapshot:
+	testSnapshot(body, isHtml, ti, test)
+
+	// Schema:
+	testSchema(body, ti, test)
+
 	// Validations:
 	testValidation(ti, test, global, doc, response, url_, string(body))
 
@@ -50,7 +50,11 @@ func titleToFilename(t string) (f string) {
 	if !strings.HasSuffix(f, "/") {
 		f += "/"
 	}
+	return f + sanitizeFilename(t)
+}
 
+// Sanitize t (by replacing anything uncomfortable in a filename) by _.
+func sanitizeFilename(t string) (f string) {
 	for _, cp := range t {
 		switch true {
 		case cp >= 'a' && cp <= 'z', cp >= 'A' && cp <= 'Z', cp >= '0' && cp <= '9',
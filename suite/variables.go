@@ -2,10 +2,10 @@ package suite
 
 import (
 	"math/rand"
-	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/vdobler/webtest/tag"
@@ -14,6 +14,16 @@ import (
 // Random for RAND sections
 var Random *rand.Rand = rand.New(rand.NewSource(time.Now().Unix()))
 
+// Random is not safe for concurrent use (e.g. by background requests).
+var randomLock sync.Mutex
+
+// A new seed drawn from Random.
+func randomSeed() int64 {
+	randomLock.Lock()
+	defer randomLock.Unlock()
+	return Random.Int63()
+}
+
 // Global CONST variables
 var Const map[string]string = map[string]string{}
 
@@ -24,7 +34,9 @@ func isDigit(x uint8) bool {
 	return (x >= '0' && x <= '9')
 }
 
-// Split str into "pre${vn}rest" parts
+// Split str into "pre${vn}rest" parts. vn may be an expression containing
+// nested ${...} (see isExpr); text which is not a valid expression is left
+// untouched.
 func nextPart(str string) (pre, vn, rest string) {
 	i := strings.Index(str, "${")
 	if i == -1 || i >= len(str)-3 {
@@ -32,18 +44,25 @@ func nextPart(str string) (pre, vn, rest string) {
 		return
 	}
 	pre, str = str[:i], str[i+2:]
-	var j int
-	if strings.HasPrefix(str, "NOW") && len(str) > 3 && !isLetter(str[3]) {
-		j = strings.Index(str, "}")
-	} else {
-		for j = 0; j < len(str) && isLetter(str[j]); j++ {
-		}
-		if j == len(str) || str[j] != '}' {
-			j = -1
+	j, depth, quoted := -1, 1, false
+	for k := 0; k < len(str) && j == -1; k++ {
+		switch c := str[k]; {
+		case quoted && c == '\\':
+			k++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth--; depth == 0 {
+				j = k
+			}
 		}
 	}
-	if j == -1 {
-		pre += "${" + str
+	if j == -1 || !isExpr(str[:j]) {
+		p, v, r := nextPart(str)
+		pre, vn, rest = pre+"${"+p, v, r
 		return
 	}
 	vn, rest = str[:j], str[j+1:]
@@ -53,7 +72,9 @@ func nextPart(str string) (pre, vn, rest string) {
 // Choose a random one of list.
 func randomVar(list []string) string {
 	n := len(list)
+	randomLock.Lock()
 	r := Random.Intn(n)
+	randomLock.Unlock()
 	tracef("Will use %d from list of %d.", r, n)
 	return list[r]
 }
@@ -152,6 +173,41 @@ func nowValue(rel, tf string, utc bool) string {
 	return t.Format(tf)
 }
 
+// Check if variable v is defined in Const, test or global.
+func hasVar(v string, test, global *Test) bool {
+	defined := func(t *Test) bool {
+		if t == nil {
+			return false
+		}
+		_, c := t.Const[v]
+		_, r := t.Rand[v]
+		_, s := t.Seq[v]
+		return c || r || s
+	}
+	_, ok := Const[v]
+	return ok || defined(test) || defined(global)
+}
+
+// Lookup of variables in expressions: Values are reused like in substitute.
+func varLookup(test, global, orig *Test) exprLookup {
+	return func(v string) (string, bool) {
+		if val, ok := orig.Vars[v]; ok {
+			return val, true
+		}
+		if !hasVar(v, test, global) {
+			return "", false
+		}
+		var val string
+		if global != nil {
+			val = varValueFallback(v, test, global, orig)
+		} else {
+			val = varValue(v, test, orig)
+		}
+		orig.Vars[v] = val
+		return val, true
+	}
+}
+
 // Substitute variables in str with their right values.
 func substitute(str string, test, global, orig *Test) string {
 	pre, vn, post := nextPart(str)
@@ -164,20 +220,19 @@ func substitute(str string, test, global, orig *Test) string {
 		val = v
 		tracef("Reusing '%s' for var '%s'.", val, vn)
 	} else {
-		if strings.HasPrefix(vn, "NOW") && (len(vn) == 3 || !isLetter(vn[3])) {
-			tf := http.TimeFormat
-			s := strings.Trim(vn[3:], " \t")
-			if i := strings.Index(s, "|"); i != -1 {
-				tf = strings.Trim(s[i+1:], " ")
-				s = strings.Trim(s[:i], " ")
-			}
-			val = nowValue(s, tf, true)
-		} else {
+		if isNowExpr(vn) {
+			val = nowExpr(vn)
+		} else if isName(vn) {
 			if global != nil {
 				val = varValueFallback(vn, test, global, orig)
 			} else {
 				val = varValue(vn, test, orig)
 			}
+		} else {
+			var err error
+			if val, err = evalExpr(vn, varLookup(test, global, orig)); err != nil {
+				errorf("Cannot evaluate '${%s}': %s", vn, err.Error())
+			}
 		}
 		orig.Vars[vn] = val // Save value for further use in this test
 	}
@@ -210,6 +265,9 @@ func substituteVariables(test, global, orig *Test) {
 	for k, v := range test.Header {
 		test.Header[k] = substitute(v, test, global, orig)
 	}
+	for k, v := range test.Auth {
+		test.Auth[k] = substitute(v, test, global, orig)
+	}
 	for i, c := range test.RespCond {
 		test.RespCond[i].Val = substitute(c.Val, test, global, orig)
 	}
@@ -228,6 +286,7 @@ func substituteVariables(test, global, orig *Test) {
 		}
 		test.Param[k] = sl
 	}
+	test.SendBody = substitute(test.SendBody, test, global, orig)
 
 	tracef("Replacing tag content")
 	for i, tc := range test.Tag {
@@ -2,7 +2,7 @@ package suite
 
 import (
 	"fmt"
-	"http"
+	"net/http"
 	"testing"
 )
 
@@ -16,6 +16,12 @@ func TestNextPart(t *testing.T) {
 		[4]string{"${xyz}", "", "xyz", ""},
 		[4]string{"${xyz} 123", "", "xyz", " 123"},
 		[4]string{"Time ${NOW +3minutes-1hour+12days} UTC", "Time ", "NOW +3minutes-1hour+12days", " UTC"},
+		[4]string{"Hallo ${abc.} ${x_1}", "Hallo ${abc.} ", "x_1", ""},
+		[4]string{"${HOST:-localhost}:80", "", "HOST:-localhost", ":80"},
+		[4]string{"${env.HOME}/x", "", "env.HOME", "/x"},
+		[4]string{"a=${urlencode(${b})}&c", "a=", "urlencode(${b})", "&c"},
+		[4]string{"${hmac(\"k}\", x)}", "", "hmac(\"k}\", x)", ""},
+		[4]string{"${nosuchfunc(x)}", "${nosuchfunc(x)}", "", ""},
 	}
 	for _, exp := range nextPartER {
 		pre, vn, post := nextPart(exp[0])
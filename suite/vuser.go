@@ -0,0 +1,42 @@
+package suite
+
+// UserData provides the variables of virtual users in stresstests
+// (e.g. credentials). The variables are added as CONST variables to the
+// global test of the virtual user. See DataTable.
+type UserData interface {
+	// Vars returns the variables of virtual user number n (n = 0, 1, ...).
+	Vars(n int) map[string]string
+}
+
+// A virtualUser performs background load with its own copy of the state of
+// the background suite: The global cookie jar, sequence counters and
+// variables are not shared with other virtual users. A virtual user must
+// not be used by more than one goroutine at a time.
+type virtualUser struct {
+	id     int
+	global *Test   // private copy of the global test of the background suite
+	tests  []*Test // private copies of the tests of the background suite
+}
+
+// Set up virtual user number id for the background suite bg.
+func newVirtualUser(id int, bg *Suite) *virtualUser {
+	vu := &virtualUser{id: id}
+	if bg.Global != nil {
+		vu.global = bg.Global.Copy()
+	} else {
+		vu.global = NewTest("Global")
+	}
+	vu.global.init()
+	if bg.UserData != nil {
+		for k, v := range bg.UserData.Vars(id) {
+			vu.global.Const[k] = v
+		}
+	}
+	for i := range bg.Test {
+		t := bg.Test[i].Copy()
+		t.init()
+		vu.tests = append(vu.tests, t)
+	}
+	tracef("Set up virtual user %d", id)
+	return vu
+}
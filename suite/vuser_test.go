@@ -0,0 +1,89 @@
+package suite
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDataTableUserData(t *testing.T) {
+	data, err := ReadCSVData(strings.NewReader("user, pass\nalice,secret1\nbob,secret2\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	for n, want := range []string{"alice", "bob", "alice"} {
+		if v := data.Vars(n); v["user"] != want || v["pass"] == "" {
+			t.Errorf("User %d got %v, want %s", n, v, want)
+		}
+	}
+	if _, err = ReadCSVData(strings.NewReader("user,pass\n")); err == nil {
+		t.Errorf("Missing error for CSV without data rows")
+	}
+}
+
+var vuSuite = `
+----------------
+Global
+----------------
+GET x
+SEQ
+	page  :=  1 2 3
+
+----------------
+Login
+----------------
+GET ${URL}/login?user=${user}&page=${page}
+SETTING
+	Keep-Cookies  :=  1
+`
+
+func TestVirtualUserIsolation(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := r.URL.Query().Get("user")
+		session := ""
+		if c, err := r.Cookie("session"); err == nil {
+			session = c.Value
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: user, Path: "/"})
+		mu.Lock()
+		seen = append(seen, user+":"+r.URL.Query().Get("page")+":"+session)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	p := NewParser(strings.NewReader(strings.Replace(vuSuite, "${URL}", ts.URL, -1)), "vu.wt")
+	s, err := p.ReadSuite()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	s.UserData, _ = ReadCSVData(strings.NewReader("user\nalice\nbob\n"))
+	picker := newScenarioPicker(s, 1)
+	alice, bob := newVirtualUser(0, s), newVirtualUser(1, s)
+
+	var wg sync.WaitGroup
+	for _, vu := range []*virtualUser{alice, bob} {
+		wg.Add(1)
+		go func(vu *virtualUser) {
+			defer wg.Done()
+			for i := 0; i < 2; i++ {
+				picker.next().run(vu, picker, false)
+			}
+		}(vu)
+	}
+	wg.Wait()
+
+	// Each user has its own sequence and sees its own session cookie only.
+	got := strings.Join(seen, " ")
+	for _, want := range []string{"alice:1:", "alice:2:alice", "bob:1:", "bob:2:bob"} {
+		if !strings.Contains(got+" ", want+" ") {
+			t.Errorf("Missing request %q in %q", want, got)
+		}
+	}
+	if s.Global.Jar.Contains(".127.0.0.1", "/", "session") != nil {
+		t.Errorf("Cookie leaked into shared global jar")
+	}
+}
@@ -66,13 +66,13 @@ func Missmatch(ts *TagSpec, node *Node) (mq MatchFailures) {
 		if ts.Deep {
 			if !ts.Content.Matches(node.Full) {
 				mq.Content = 1
+				mq.Fail = append(mq.Fail, "Deep Content: "+ts.Content.String())
 			}
-			mq.Fail = append(mq.Fail, "Deep Content")
 		} else {
 			if !ts.Content.Matches(node.Text) {
 				mq.Content = 2
+				mq.Fail = append(mq.Fail, "Direct Content: "+ts.Content.String())
 			}
-			mq.Fail = append(mq.Fail, "Direct Content")
 		}
 	}
 
@@ -98,6 +98,8 @@ func Missmatch(ts *TagSpec, node *Node) (mq MatchFailures) {
 					mq.Sub++
 				}
 			}
+			mq.Fail = append(mq.Fail, "Sub Tag: "+ts.Sub[si].Name)
+			ci = last
 		}
 	}
 	return
@@ -124,3 +126,21 @@ func rankNodes(ts *TagSpec, node *Node, best []MatchFailures) []MatchFailures {
 	}
 	return best
 }
+
+// Return up to n nodes which resemble ts most closely but do not match it.
+// Nodes are sorted by amount of mismatch; ties keep document order.
+func ClosestNodes(ts *TagSpec, root *Node, n int) []MatchFailures {
+	all := rankNodes(ts, root, nil)
+	sort.Stable(QualityArray(all))
+	list := make([]MatchFailures, 0, n)
+	for _, mf := range all {
+		if len(list) >= n {
+			break
+		}
+		if Matches(ts, mf.Node) {
+			continue
+		}
+		list = append(list, mf)
+	}
+	return list
+}
@@ -0,0 +1,55 @@
+package tag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMissmatch(t *testing.T) {
+	doc, err := ParseHtml(testSimpleHtml)
+	if err != nil {
+		t.Fatalf("Unparsabel html: %s", err.Error())
+	}
+
+	n := FindTag(MustParse("p id=first", t), doc)
+	mf := Missmatch(MustParse("p id=first == Hello World!", t), n)
+	if mf.Total() != 0 || len(mf.Fail) != 0 {
+		t.Errorf("Expected perfect match, got %d mismatches: %v", mf.Total(), mf.Fail)
+	}
+
+	mf = Missmatch(MustParse("p id=second == Hello Moon!", t), n)
+	if mf.ReqAttr != 1 || mf.Content == 0 || len(mf.Fail) != 2 {
+		t.Errorf("Expected attribute and content mismatch, got %+v", mf)
+	}
+	if !strings.HasPrefix(mf.Fail[0], "Required Attribute: id") {
+		t.Errorf("Bad failure description %q", mf.Fail[0])
+	}
+}
+
+func TestClosestNodes(t *testing.T) {
+	doc, err := ParseHtml(testSimpleHtml)
+	if err != nil {
+		t.Fatalf("Unparsabel html: %s", err.Error())
+	}
+
+	ts := MustParse("p id=first == Hello Moon!", t)
+	cand := ClosestNodes(ts, doc, 2)
+	if len(cand) != 2 {
+		t.Fatalf("Expected 2 candidates, got %d", len(cand))
+	}
+	if cand[0].Node.Line != 5 || cand[0].ReqAttr != 0 || cand[0].Content == 0 {
+		t.Errorf("Expected <p id=first> in line 5 with content mismatch, got line %d: %+v",
+			cand[0].Node.Line, cand[0])
+	}
+	if cand[1].Total() < cand[0].Total() {
+		t.Errorf("Candidates not sorted: %d < %d", cand[1].Total(), cand[0].Total())
+	}
+
+	// Matching nodes are no candidates.
+	ts = MustParse("p id=first", t)
+	for _, c := range ClosestNodes(ts, doc, 10) {
+		if c.Node.Line == 5 {
+			t.Errorf("Matching node reported as candidate")
+		}
+	}
+}
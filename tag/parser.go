@@ -23,6 +23,7 @@ type Node struct {
 	Text   string
 	Full   string
 	Child  []*Node
+	Line   int     // line of the start tag in the parsed html (starting at 1)
 	subs   []*Node // subs contains real child tags _and_ text childs (where Name=="-TXT-")
 	class  []string
 }
@@ -109,6 +110,45 @@ func (n *Node) Html() (s string) {
 	return
 }
 
+// Remove n (and all its children) from its parent. The Text and Full
+// content of the ancestors is not updated.
+func (n *Node) Remove() {
+	p := n.Parent
+	if p == nil {
+		return
+	}
+	for i, c := range p.Child {
+		if c == n {
+			p.Child = append(p.Child[:i], p.Child[i+1:]...)
+			break
+		}
+	}
+	for i, c := range p.subs {
+		if c == n {
+			p.subs = append(p.subs[:i], p.subs[i+1:]...)
+			break
+		}
+	}
+	n.Parent = nil
+}
+
+// Replace the whole content of n by the text mask. The values of all
+// attributes not listed in keep are set to mask too.
+func (n *Node) Mask(mask string, keep []string) {
+	n.Child = nil
+	n.subs = []*Node{&Node{Parent: n, Name: TEXT_NODE, Text: mask}}
+	n.Text, n.Full = mask, mask
+outer:
+	for i, a := range n.Attr {
+		for _, k := range keep {
+			if a.Key == k {
+				continue outer
+			}
+		}
+		n.Attr[i].Val = mask
+	}
+}
+
 // Extract classes to own Class field in node and remove from Attr.
 func prepareClasses(node *Node) {
 	for i, a := range node.Attr {
@@ -150,12 +190,13 @@ func cleanText(s string) string {
 
 // Try to remove javascript tags from the html.
 // This is basically buggy as it will not try to understand the javascript.
+// A removed script is replaced by its newlines to keep the line numbers.
 func removeJavascript(h string) string {
 	for _, st := range [][2]string{{"<script", "</script>"}, {"<SCRIPT", "</SCRIPT>"}} {
 		for i := strings.Index(h, st[0]); i != -1; {
 			a, b := h[:i], h[i+7:]
 			if j := strings.Index(b, st[1]); j != -1 {
-				h = a + b[j+9:]
+				h = a + strings.Repeat("\n", strings.Count(b[:j], "\n")) + b[j+9:]
 			} else {
 				// this should not happen iff html/javascript is halfway decent...
 				warnf("Html is completely broken...")
@@ -168,12 +209,35 @@ func removeJavascript(h string) string {
 	return h
 }
 
+// lineCounter translates (increasing) input offsets of the xml decoder
+// into line numbers of src.
+type lineCounter struct {
+	src  string
+	pos  int // position up to which lines have been counted
+	line int // line number at pos
+}
+
+// Line of the start tag which ends just before offset off.
+func (lc *lineCounter) lineAt(off int64) int {
+	end := int(off)
+	if end > len(lc.src) {
+		end = len(lc.src)
+	}
+	if i := strings.LastIndex(lc.src[lc.pos:end], "<"); i != -1 {
+		end = lc.pos + i
+	}
+	lc.line += strings.Count(lc.src[lc.pos:end], "\n")
+	lc.pos = end
+	return lc.line
+}
+
 // Parse the given html and return the root node of the document.
 // Parsing starts at the first StartToken and will ignore other stuff.
 func ParseHtml(h string) (root *Node, err error) {
 	tracef("%s", h)
 	r := strings.NewReader(h)
 	parser := xml.NewDecoder(r)
+	lines := &lineCounter{src: h, line: 1}
 	parser.Strict = false
 	parser.AutoClose = xml.HTMLAutoClose
 	parser.Entity = xml.HTMLEntity
@@ -187,7 +251,7 @@ func ParseHtml(h string) (root *Node, err error) {
 		switch tok.(type) {
 		case xml.StartElement:
 			debugf("Starting parsing from %v", tok)
-			root, err = parse(tok, parser, nil)
+			root, err = parse(tok, parser, nil, lines)
 			if err != nil && strings.HasPrefix(err.Error(), "Javascript: ") {
 				h = removeJavascript(h)
 				debugf("Retrying parsing html without javascript.")
@@ -201,11 +265,12 @@ func ParseHtml(h string) (root *Node, err error) {
 	return
 }
 
-func parse(tok xml.Token, parser *xml.Decoder, parent *Node) (node *Node, err error) {
+func parse(tok xml.Token, parser *xml.Decoder, parent *Node, lines *lineCounter) (node *Node, err error) {
 	node = new(Node)
 	node.Parent = parent
 	st, _ := tok.(xml.StartElement)
 	node.Name = st.Name.Local
+	node.Line = lines.lineAt(parser.InputOffset())
 	tracef("parsing tag %s", node.Name)
 	node.Attr = []html.Attribute{}
 	for _, attr := range st.Attr {
@@ -232,7 +297,7 @@ func parse(tok xml.Token, parser *xml.Decoder, parent *Node) (node *Node, err er
 		switch t := tok.(type) {
 		case xml.StartElement:
 			var ch *Node
-			ch, err = parse(t, parser, node)
+			ch, err = parse(t, parser, node, lines)
 			if err != nil {
 				return
 			}
@@ -73,7 +73,7 @@ func testStructure(doc *Node, expected []string, t *testing.T) {
 func testHtmlParsing(html string, expected []string, t *testing.T) {
 	doc, err := ParseHtml(html)
 	if err != nil {
-		t.Error("Unparsabel html: " + err.String())
+		t.Error("Unparsabel html: " + err.Error())
 		t.FailNow()
 	}
 	testStructure(doc, expected, t)
@@ -96,7 +96,7 @@ func TestXHtmlParsing(t *testing.T) {
 func TestHtmlEntitiesParsing(t *testing.T) {
 	doc, err := ParseHtml(testEntitiesHtml)
 	if err != nil {
-		t.Error("Unparsabel html: " + err.String())
+		t.Error("Unparsabel html: " + err.Error())
 		t.FailNow()
 	}
 	lines := strings.Split(doc.HtmlRep(0), "\n")
@@ -146,7 +146,7 @@ func TestAlmostOkay(t *testing.T) {
 
 	_, err := ParseHtml(almostOkay)
 	if err != nil {
-		t.Error("Unparsabel html: " + err.String())
+		t.Error("Unparsabel html: " + err.Error())
 		t.Error("Please patch the xml-parser. See http://codereview.appspot.com/4557048/")
 		t.FailNow()
 	}
@@ -164,8 +164,59 @@ func TestScript(t *testing.T) {
 	`
 	doc, err := ParseHtml(html)
 	if err != nil {
-		t.Error("Unparsabel html: " + err.String())
+		t.Error("Unparsabel html: " + err.Error())
 		fmt.Printf("dom:\n%s\n", doc.String())
 		t.FailNow()
 	}
 }
+
+func TestLineNumbers(t *testing.T) {
+	doc, err := ParseHtml(testStructureHtml)
+	if err != nil {
+		t.Fatalf("Unparsabel html: %s", err.Error())
+	}
+	for _, exp := range []struct {
+		spec string
+		line int
+	}{
+		{"html", 1},
+		{"body", 2},
+		{"h1", 3},
+		{"span", 5},
+		{"h2", 8},
+		{"div", 9},
+		{"p == G", 11},
+	} {
+		n := FindTag(MustParse(exp.spec, t), doc)
+		if n == nil {
+			t.Errorf("Missing tag %s", exp.spec)
+			continue
+		}
+		if n.Line != exp.line {
+			t.Errorf("Tag %s: Expected line %d, got %d", exp.spec, exp.line, n.Line)
+		}
+	}
+}
+
+func TestLineNumbersWithoutJavascript(t *testing.T) {
+	doc, err := ParseHtml(`<html>
+<body>
+<script>
+  if (x < y) {
+    x = y;
+  }
+</script>
+<h1>Title</h1>
+</body>
+</html>`)
+	if err != nil {
+		t.Fatalf("Unparsabel html: %s", err.Error())
+	}
+	n := FindTag(MustParse("h1", t), doc)
+	if n == nil {
+		t.Fatalf("Missing tag h1")
+	}
+	if n.Line != 8 {
+		t.Errorf("Expected line 8, got %d", n.Line)
+	}
+}
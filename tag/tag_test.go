@@ -9,7 +9,7 @@ import (
 func MustParse(spec string, t *testing.T) *TagSpec {
 	ts, err := ParseTagSpec(spec)
 	if ts == nil || err != nil {
-		t.Errorf("Unexpected unparsable tagspec '%s': %s", spec, err.String())
+		t.Errorf("Unexpected unparsable tagspec '%s': %s", spec, err.Error())
 		t.FailNow()
 		return nil
 	}
@@ -93,7 +93,7 @@ var testSimpleHtml = `<!DOCTYPE html>
 func TestBasics(t *testing.T) {
 	doc, err := ParseHtml(testSimpleHtml)
 	if err != nil {
-		t.Error("Unparsabel html: " + err.String())
+		t.Error("Unparsabel html: " + err.Error())
 		t.FailNow()
 	}
 
@@ -145,7 +145,7 @@ func TestBasics(t *testing.T) {
 func TestTextcontent(t *testing.T) {
 	doc, err := ParseHtml(testSimpleHtml)
 	if err != nil {
-		t.Error("Unparsabel html: " + err.String())
+		t.Error("Unparsabel html: " + err.Error())
 		t.FailNow()
 	}
 
@@ -186,7 +186,7 @@ func TestTextcontent(t *testing.T) {
 func TestNestedTags(t *testing.T) {
 	doc, err := ParseHtml(testSimpleHtml)
 	if err != nil {
-		t.Error("Unparsabel html: " + err.String())
+		t.Error("Unparsabel html: " + err.Error())
 		t.FailNow()
 	}
 	check(doc, "div\n  p id=A", "div1", t)
@@ -198,7 +198,7 @@ func TestNestedTags(t *testing.T) {
 func TestCounting(t *testing.T) {
 	doc, err := ParseHtml(testSimpleHtml)
 	if err != nil {
-		t.Error("Unparsabel html: " + err.String())
+		t.Error("Unparsabel html: " + err.Error())
 		t.FailNow()
 	}
 
@@ -43,6 +43,7 @@ import (
 	"io"
 	"log"
 	"math/rand"
+	"net/http"
 	"os"
 	"path"
 	"strings"
@@ -51,7 +52,6 @@ import (
 	"github.com/ajstarks/svgo"
 	"github.com/vdobler/chart"
 	"github.com/vdobler/chart/svgg"
-	"github.com/vdobler/webtest/stat"
 	"github.com/vdobler/webtest/suite"
 	"github.com/vdobler/webtest/tag"
 )
@@ -74,9 +74,24 @@ var testsToRun string = "*"
 var randomSeed int64 = -1
 var dumpTalk string = ""
 var junitFile = ""
+var dataFile = ""
+var metricsAddr = "" // serve live metrics on this address if non-empty
+var agentAddr = ""   // run as agent of a distributed stresstest on this address
+var agents = ""      // comma separated list of agents for distributed stresstest
+var agentSecret = "" // shared secret of agents and coordinator
+
+// Import and export
+var importHar = ""       // convert this HAR file to a suite
+var importStatic = false // keep images, stylesheets, scripts and fonts
+var harFile = ""         // record requests and responses to this HAR file
+var curlSuite = ""       // print curl command lines for the tests of this suite
+var importOpenAPI = ""   // convert this OpenAPI spec to a suite
 
 // Benchmark
 var numRuns int = 15
+var compareMode bool = false     // compare two benchmark results
+var compareThreshold float64 = 5 // median slower by that many percent is a regression
+var compareAlpha float64 = 0.05  // significance level of regressions
 
 // Parameters for stresstesting
 var rampStart int = 5      // Start with that many parallel background requests
@@ -84,6 +99,20 @@ var rampStep int = 5       // Increase number of parallel background requests
 var rampSleep int64 = 1000 // Time in ms to sleep before and after testing
 var rampRep int = 1        // Number of repetitions of tests in one ramp level.
 
+// Parameters for open-loop stresstesting (background load as request rate)
+var rateStart int = 0  // Start with that many background requests per second; 0: closed-loop
+var rateStep int = 0   // Increase rate by that many requests per second; 0: constant rate
+var rateRamp int64 = 0 // Time in ms to ramp up linearely from one rate to the next
+var rateConc int = 0   // Maximum number of parallel background requests; 0: unlimited
+var rateMax int = 1000 // Stop if rate exceeds this many requests per second
+var vuData string = "" // CSV or JSON file with variables for the virtual users
+
+// Parameters for soaktesting
+var soakDuration time.Duration               // Hold background load that long; 0: no soaktest
+var soakInterval time.Duration = time.Minute // Start test suite that often
+var soakRTIncrease float64 = 20              // Max. increase of response time in percent
+var soakErrRise float64 = 1                  // Max. rise of error rate in percentage points
+
 // Parameters determing the end of a stresstest: If any condition is reached, the stresstests stops
 var stopFF float64 = 0.1       // 10% Failures --> stop
 var stopART int64 = 120 * 1000 // two minutes Average Response Time
@@ -159,21 +188,45 @@ func help() {
 	fmt.Fprintf(os.Stderr, "\twebtest -check [common options] <suite>...\n")
 	fmt.Fprintf(os.Stderr, "\twebtest -bench [common options] [bench options] <suite>...\n")
 	fmt.Fprintf(os.Stderr, "\twebtest -stress [common options] [stress options] <bg-suite> <suite>\n")
+	fmt.Fprintf(os.Stderr, "\twebtest -compare [compare options] <old.json> <new.json>\n")
+	fmt.Fprintf(os.Stderr, "\twebtest -agent <addr> [-agent.secret <s>] [common options]\n")
+	fmt.Fprintf(os.Stderr, "\twebtest -soak <duration> [common options] [soak options] <bg-suite> <suite>\n")
 	fmt.Fprintf(os.Stderr, "\twebtest -tag <tagSpec> <htmlFile>\n")
+	fmt.Fprintf(os.Stderr, "\twebtest [-import.static] -import-har <file.har>\n")
+	fmt.Fprintf(os.Stderr, "\twebtest -import-openapi <spec.yaml>\n")
+	fmt.Fprintf(os.Stderr, "\twebtest -curl <suite> [common options]\n")
 	fmt.Fprintf(os.Stderr, "\n")
 	fmt.Fprintf(os.Stderr, "Test is the default mode and will run alls test in the given suites.\n")
 	fmt.Fprintf(os.Stderr, "Check will just read the testsuite(s), parse them and output the \n")
 	fmt.Fprintf(os.Stderr, "warning/erros found and the suite(s) as read.\n")
 	fmt.Fprintf(os.Stderr, "Benchmarking and Stress-Test are selected by -bench or -stres.\n")
 	fmt.Fprintf(os.Stderr, "Debuging tag-specs matching against a html file is done by -tag.\n")
+	fmt.Fprintf(os.Stderr, "Import-har converts a HAR file recorded by the developer tools of a\n")
+	fmt.Fprintf(os.Stderr, "browser or a proxy to a suite printed to stdout.  Static resources\n")
+	fmt.Fprintf(os.Stderr, "like images, stylesheets and scripts are skipped unless -import.static.\n")
+	fmt.Fprintf(os.Stderr, "Import-openapi generates a suite with one test per operation of an\n")
+	fmt.Fprintf(os.Stderr, "OpenAPI 3 or Swagger 2 spec (JSON or YAML) which sends example values\n")
+	fmt.Fprintf(os.Stderr, "and checks the status code and the response against its JSON schema.\n")
+	fmt.Fprintf(os.Stderr, "Curl prints a curl command line for the request of each selected test\n")
+	fmt.Fprintf(os.Stderr, "(see -tests) to reproduce it without webtest.\n")
 	fmt.Fprintf(os.Stderr, "\n")
 	fmt.Fprintf(os.Stderr, "During benchmarking the selected tests are run repeatedly and\n")
 	fmt.Fprintf(os.Stderr, "some simple statistics about the response times is collected.\n")
+	fmt.Fprintf(os.Stderr, "The response times are saved to wtresults_<date>.json. Compare compares\n")
+	fmt.Fprintf(os.Stderr, "two such files and exits with status 1 if a test got significantly slower.\n")
 	fmt.Fprintf(os.Stderr, "\n")
 	fmt.Fprintf(os.Stderr, "During stresstesting the request in the <bg-suite> are used to\n")
 	fmt.Fprintf(os.Stderr, "generate appropriate background load (no tests are performed).\n")
 	fmt.Fprintf(os.Stderr, "The <suite> itself is executed and testes on top of this load.\n")
 	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(os.Stderr, "With -agents the load of a stresstest is distributed to agents\n")
+	fmt.Fprintf(os.Stderr, "started with -agent on other hosts. Agents listen on localhost unless\n")
+	fmt.Fprintf(os.Stderr, "<addr> contains a host and require the secret given by -agent.secret.\n")
+	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(os.Stderr, "During soaktesting a constant background load is held for <duration>\n")
+	fmt.Fprintf(os.Stderr, "(e.g. '4h') and the <suite> is run periodically to detect degradation\n")
+	fmt.Fprintf(os.Stderr, "over time. Exit status is 1 if degradation was detected.\n")
+	fmt.Fprintf(os.Stderr, "\n")
 	fmt.Fprintf(os.Stderr, "Common Options:\n")
 	fmt.Fprintf(os.Stderr, "\t-log <n>          General Log Level: 0=off, 1=err, 2=warn, 3=info\n")
 	fmt.Fprintf(os.Stderr, "\t                  4=debug, 5=trace. [%d]\n", LogLevel)
@@ -185,6 +238,8 @@ func help() {
 	fmt.Fprintf(os.Stderr, "\t-seed <n>         use n as random seed (instead of current time).\n")
 	fmt.Fprintf(os.Stderr, "\t-D <n>=<v>        Set/override const variable named <n> to value <v>.\n")
 	fmt.Fprintf(os.Stderr, "\t-od <path>        Set output path to <path>. [%s]\n", outputPath)
+	fmt.Fprintf(os.Stderr, "\t-metrics <addr>   Serve live metrics of benchmarks and stresstests\n")
+	fmt.Fprintf(os.Stderr, "\t                  on <addr> (e.g. ':9100') under /metrics and /.\n")
 	fmt.Fprintf(os.Stderr, "\n")
 	fmt.Fprintf(os.Stderr, "Test Options:\n")
 	fmt.Fprintf(os.Stderr, "\t-dump <mode>      Dump for debuggin purpose according to <mode>:\n")
@@ -194,11 +249,25 @@ func help() {
 	fmt.Fprintf(os.Stderr, "\t-validate <n>     Allow checking links (1), validating html (2),\n")
 	fmt.Fprintf(os.Stderr, "\t                  both (3).\n")
 	fmt.Fprintf(os.Stderr, "\t-junit <file>     Write results as junit xml to <file>.\n")
+	fmt.Fprintf(os.Stderr, "\t-har <file>       Record all requests and responses to the HAR <file>.\n")
+	fmt.Fprintf(os.Stderr, "\t                  Not available in the other modes.\n")
+	fmt.Fprintf(os.Stderr, "\t-data <file>      Run each test once per row of the CSV or JSON\n")
+	fmt.Fprintf(os.Stderr, "\t                  <file> with the columns as variables.\n")
+	fmt.Fprintf(os.Stderr, "\t-diff.max <n>     Maximum size in bytes of the diff reported for\n")
+	fmt.Fprintf(os.Stderr, "\t                  failed body conditions, 0 disables diffs. [%d]\n", suite.MaxDiffSize)
+	fmt.Fprintf(os.Stderr, "\t-update-snapshots Write the (normalised) bodies to the golden files of\n")
+	fmt.Fprintf(os.Stderr, "\t                  SNAPSHOT conditions instead of comparing them.\n")
 	fmt.Fprintf(os.Stderr, "\n")
 	fmt.Fprintf(os.Stderr, "Benchmark Options:\n")
 	fmt.Fprintf(os.Stderr, "\t-runs <n>         Number of repetitions of each test.\n")
 	fmt.Fprintf(os.Stderr, "\t                  Must be >= 5. [%d]\n", numRuns)
 	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(os.Stderr, "Compare Options:\n")
+	fmt.Fprintf(os.Stderr, "\t-compare.threshold <p>\n")
+	fmt.Fprintf(os.Stderr, "\t                  Regression if median got <p> percent slower. [%g]\n", compareThreshold)
+	fmt.Fprintf(os.Stderr, "\t-compare.alpha <a>\n")
+	fmt.Fprintf(os.Stderr, "\t                  Significance level of Mann-Whitney U test. [%g]\n", compareAlpha)
+	fmt.Fprintf(os.Stderr, "\n")
 	fmt.Fprintf(os.Stderr, "Stress Test Options:\n")
 	fmt.Fprintf(os.Stderr, "\t-ramp.start <n>   Start with background load of <n> parallel\n")
 	fmt.Fprintf(os.Stderr, "\t                  backgrounf requests. [%d]\n", rampStart)
@@ -207,6 +276,20 @@ func help() {
 	fmt.Fprintf(os.Stderr, "\t-ramp.sleep <ms>  Sleep time in ms around iterations. [%d]\n", rampSleep)
 	fmt.Fprintf(os.Stderr, "\t-ramp.rep <n>     Number of repetitions of whole testsuite during one\n")
 	fmt.Fprintf(os.Stderr, "\t                  ramp step. [%d]\n", rampRep)
+	fmt.Fprintf(os.Stderr, "\t-rate <rps>       Open-loop mode: Start background requests at a rate\n")
+	fmt.Fprintf(os.Stderr, "\t                  of <rps> requests per second. [%d]\n", rateStart)
+	fmt.Fprintf(os.Stderr, "\t-rate.step <rps>  Increase rate by <rps> on each iteration, 0 for a\n")
+	fmt.Fprintf(os.Stderr, "\t                  single iteration at constant rate. [%d]\n", rateStep)
+	fmt.Fprintf(os.Stderr, "\t-rate.ramp <ms>   Increase rate linearely over <ms>. [%d]\n", rateRamp)
+	fmt.Fprintf(os.Stderr, "\t-rate.conc <n>    Maximum number of background requests in flight,\n")
+	fmt.Fprintf(os.Stderr, "\t                  0 for unlimited. [%d]\n", rateConc)
+	fmt.Fprintf(os.Stderr, "\t-rate.max <rps>   Stop if rate exceeds <rps>. [%d]\n", rateMax)
+	fmt.Fprintf(os.Stderr, "\t-vu.data <file>   Read variables of virtual users from CSV or JSON\n")
+	fmt.Fprintf(os.Stderr, "\t                  <file>. Rows are assigned round robin to users.\n")
+	fmt.Fprintf(os.Stderr, "\t-agents <list>    Distribute load to the comma separated <list> of\n")
+	fmt.Fprintf(os.Stderr, "\t                  agents (host:port) started with -agent.\n")
+	fmt.Fprintf(os.Stderr, "\t-agent.secret <s> Shared secret of agents and coordinator.\n")
+	fmt.Fprintf(os.Stderr, "\t                  [$WEBTEST_AGENT_SECRET]\n")
 	fmt.Fprintf(os.Stderr, "\t-stop.ff <frac>   Stop stresstest if fraction (e.g. 0.2) of conditions\n")
 	fmt.Fprintf(os.Stderr, "\t                  fail. [%.3f]\n", stopFF)
 	fmt.Fprintf(os.Stderr, "\t-stop.art <ms>    Stop if Average Response Time exeeds <ms>. [%d]\n", stopART)
@@ -216,6 +299,15 @@ func help() {
 	fmt.Fprintf(os.Stderr, "\t-stop.rti <n>     Stop if response time exeeds <n> * plain/initial\n")
 	fmt.Fprintf(os.Stderr, "\t                  response time. [%d]\n", stopRTI)
 	fmt.Fprintf(os.Stderr, "\t-stop.mpr <n>     Stop if n maximum parallel requests reached. [%d]\n", stopMPR)
+	fmt.Fprintf(os.Stderr, "\n")
+	fmt.Fprintf(os.Stderr, "Soak Test Options:\n")
+	fmt.Fprintf(os.Stderr, "\t                  Background load is -ramp.start parallel requests\n")
+	fmt.Fprintf(os.Stderr, "\t                  or -rate requests per second (see above).\n")
+	fmt.Fprintf(os.Stderr, "\t-soak.interval <d> Run <suite> every <d>. [%s]\n", soakInterval)
+	fmt.Fprintf(os.Stderr, "\t-soak.rt <p>      Degraded if response time trend increases by more\n")
+	fmt.Fprintf(os.Stderr, "\t                  than <p> percent. [%g]\n", soakRTIncrease)
+	fmt.Fprintf(os.Stderr, "\t-soak.err <p>     Degraded if error rate trend rises by more than <p>\n")
+	fmt.Fprintf(os.Stderr, "\t                  percentage points. [%g]\n", soakErrRise)
 	fmt.Fprintf(os.Stderr, "\t\n")
 	os.Exit(1)
 }
@@ -244,9 +336,15 @@ func globalInitialization() {
 	flag.BoolVar(&checkOnly, "check", false, "Read test suite and output without testing.")
 	flag.BoolVar(&benchmarkMode, "bench", false, "Benchmark suit: Run each test <runs> often.")
 	flag.BoolVar(&testmode, "test", true, "Perform normal testing")
+	flag.BoolVar(&compareMode, "compare", false, "Compare two benchmark results.")
+	flag.Float64Var(&compareThreshold, "compare.threshold", 5, "Regression threshold in percent.")
+	flag.Float64Var(&compareAlpha, "compare.alpha", 0.05, "Significance level for regressions.")
 	flag.BoolVar(&stresstestMode, "stress", false, "Use background-suite as stress suite for tests.")
 	flag.IntVar(&validateMask, "validate", 0, "Bit mask which is ANDed to individual test setting.")
 	flag.StringVar(&junitFile, "junit", "", "Write results as junit xml to file.")
+	flag.StringVar(&dataFile, "data", "", "Run each test once per row of this CSV or JSON file.")
+	flag.IntVar(&suite.MaxDiffSize, "diff.max", suite.MaxDiffSize, "Maximum size of diff for failed body conditions.")
+	flag.BoolVar(&suite.UpdateSnapshots, "update-snapshots", false, "Rewrite golden files of SNAPSHOT conditions.")
 	flag.IntVar(&LogLevel, "log", 3, "General log level: 0: none, 1:err, 2:warn, 3:info, 4:debug, 5:trace")
 	flag.IntVar(&tagLogLevel, "log.tag", -1,
 		"Log level for tag: -1: std level, 0: none, 1:err, 2:warn, 3:info, 4:debug, 5:trace")
@@ -259,11 +357,30 @@ func globalInitialization() {
 	flag.Var(variables, "D", "Set/Overwrite a const variable in the suite e.g. '-D HOST=localhost'")
 	flag.StringVar(&outputPath, "od", outputPath, "Output into given directory.")
 	flag.StringVar(&tagspec, "tag", "", "Check tag against html file.")
+	flag.StringVar(&metricsAddr, "metrics", "", "Serve live metrics on this address.")
+	flag.StringVar(&agentAddr, "agent", "", "Run as agent for distributed stresstests on this address.")
+	flag.StringVar(&agents, "agents", "", "Comma separated list of agents to distribute stresstest to.")
+	flag.StringVar(&agentSecret, "agent.secret", os.Getenv("WEBTEST_AGENT_SECRET"), "Shared secret of agents and coordinator.")
+	flag.StringVar(&importHar, "import-har", "", "Convert HAR file to a suite.")
+	flag.BoolVar(&importStatic, "import.static", false, "Import static resources from HAR file too.")
+	flag.StringVar(&importOpenAPI, "import-openapi", "", "Convert OpenAPI spec to a suite.")
+	flag.StringVar(&harFile, "har", "", "Record requests and responses to HAR file.")
+	flag.StringVar(&curlSuite, "curl", "", "Print curl command lines for the tests of a suite.")
 
 	flag.IntVar(&rampStart, "ramp.start", 5, "Ramp start")
 	flag.IntVar(&rampStep, "ramp.step", 5, "Ramp step")
 	flag.Int64Var(&rampSleep, "ramp.sleep", 1000, "Ramp sleep in ms")
 	flag.IntVar(&rampRep, "ramp.rep", 1, "Ramp repetition")
+	flag.IntVar(&rateStart, "rate", 0, "Open-loop background rate in requests per second")
+	flag.IntVar(&rateStep, "rate.step", 0, "Rate step in requests per second")
+	flag.Int64Var(&rateRamp, "rate.ramp", 0, "Rate ramp duration in ms")
+	flag.IntVar(&rateConc, "rate.conc", 0, "Maximum number of parallel open-loop background requests")
+	flag.IntVar(&rateMax, "rate.max", 1000, "Stop if rate exceeds this limit.")
+	flag.StringVar(&vuData, "vu.data", "", "CSV or JSON file with variables for virtual users")
+	flag.DurationVar(&soakDuration, "soak", 0, "Soaktest duration")
+	flag.DurationVar(&soakInterval, "soak.interval", time.Minute, "Soaktest interval between test suite runs")
+	flag.Float64Var(&soakRTIncrease, "soak.rt", 20, "Soaktest maximum response time increase in percent")
+	flag.Float64Var(&soakErrRise, "soak.err", 1, "Soaktest maximum error rate rise in percentage points")
 	flag.Float64Var(&stopFF, "stop.FF", 0.2, "Stop failed fraction limit")
 	flag.Int64Var(&stopART, "stop.art", 120*1000, "Stop average repsonse time limit")
 	flag.Int64Var(&stopMRT, "stop.mrt", 240*1000, "Stop maximum response time limit ")
@@ -302,6 +419,13 @@ func globalInitialization() {
 		fmt.Fprintf(os.Stderr, "Illegal combination of -stress, and -bench")
 		os.Exit(2)
 	}
+	if soakDuration > 0 && (benchmarkMode || stresstestMode) {
+		fmt.Fprintf(os.Stderr, "Illegal combination of -soak and -stress or -bench")
+		os.Exit(2)
+	}
+	if soakDuration > 0 {
+		testmode = false
+	}
 	if benchmarkMode {
 		testmode = false
 	}
@@ -309,6 +433,15 @@ func globalInitialization() {
 		testmode = false
 	}
 
+	if harFile != "" {
+		if !testmode || agentAddr != "" {
+			// the HAR is written at the end of the test run only
+			fmt.Fprintf(os.Stderr, "Illegal combination of -har and -bench, -stress, -soak or -agent")
+			os.Exit(2)
+		}
+		suite.Recorder = suite.NewHARRecorder()
+	}
+
 	if randomSeed != -1 {
 		suite.Random = rand.New(rand.NewSource(int64(randomSeed)))
 	}
@@ -323,6 +456,49 @@ func globalInitialization() {
 func main() {
 
 	globalInitialization()
+	if metricsAddr != "" {
+		if err := startMetricsServer(metricsAddr); err != nil {
+			errorf("Cannot serve metrics: %s", err.Error())
+			os.Exit(2)
+		}
+	}
+
+	if compareMode {
+		if flag.NArg() != 2 {
+			errorf("Compare requires excatly two benchmark results.")
+			os.Exit(2)
+		}
+		if compare(flag.Args()[0], flag.Args()[1]) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if importHar != "" {
+		importHAR(importHar)
+		os.Exit(0)
+	}
+	if importOpenAPI != "" {
+		importOpenAPISpec(importOpenAPI)
+		os.Exit(0)
+	}
+	if curlSuite != "" {
+		curl(curlSuite)
+		os.Exit(0)
+	}
+
+	if agentAddr != "" {
+		if agentSecret == "" {
+			errorf("Agent requires a secret (-agent.secret).")
+			os.Exit(2)
+		}
+		addr := agentListenAddr(agentAddr)
+		warnf("Waiting for coordinator on %s", addr)
+		if err := http.ListenAndServe(addr, suite.NewAgent(agentSecret)); err != nil {
+			errorf("Cannot run agent: %s", err.Error())
+		}
+		os.Exit(2)
+	}
 
 	if tagspec != "" {
 		if flag.NArg() != 1 {
@@ -339,6 +515,15 @@ func main() {
 		}
 		stresstest(flag.Args()[0], flag.Args()[1])
 		os.Exit(0)
+	} else if soakDuration > 0 {
+		if flag.NArg() != 2 {
+			errorf("Soaktest requires excatly two suites.")
+			os.Exit(2)
+		}
+		if soaktest(flag.Args()[0], flag.Args()[1]) {
+			os.Exit(1)
+		}
+		os.Exit(0)
 	} else {
 		if flag.NArg() == 0 {
 			errorf("No webtest file given. (Run 'webtest -help' for usage.)\n")
@@ -387,9 +572,9 @@ func tagDebug(tagspec, filename string) {
 
 	fmt.Printf("TagSpec:\n%s\n", strings.Replace(ts.String(), "\n", "\n    ", -1))
 	all := tag.RankNodes(ts, doc)
-	fmt.Printf("Rank CO RA XA RC XC SN DN   Tag\n--------------------------------------------\n")
+	fmt.Printf("Rank CO RA XA RC XC SN DN  Line  Tag\n--------------------------------------------------\n")
 	for n, q := range all {
-		fmt.Printf("%2d:  %2d %2d %2d %2d %2d %2d %2d  %s\n", n, q.Content, q.ReqAttr, q.ForbAttr, q.ReqClass, q.ForbClass, q.Sub, q.Deep, q.Node.String())
+		fmt.Printf("%2d:  %2d %2d %2d %2d %2d %2d %2d %5d  %s\n", n, q.Content, q.ReqAttr, q.ForbAttr, q.ReqClass, q.ForbClass, q.Sub, q.Deep, q.Node.Line, q.Node.String())
 	}
 
 	os.Exit(0)
@@ -401,11 +586,23 @@ func testOrBenchmark(filenames []string) {
 	var suites []*suite.Suite = make([]*suite.Suite, 0, 20)
 	var allReadable bool = true
 
+	var data *suite.DataTable
+	if dataFile != "" {
+		var err error
+		if data, err = suite.ReadDataFile(dataFile); err != nil {
+			errorf("Cannot read data from %s: %s", dataFile, err.Error())
+			os.Exit(2)
+		}
+	}
+
 	for _, filename := range filenames {
 		s, _, err := readSuite(filename)
 		if err != nil {
 			allReadable = false
 		} else {
+			if data != nil {
+				s.ExpandData(data)
+			}
 			suites = append(suites, s)
 		}
 	}
@@ -476,6 +673,7 @@ func benchmark(suites []*suite.Suite) {
 	histogram.BinWidth = 100
 
 	cnt := 0
+	results := benchResults{Date: time.Now(), Runs: numRuns}
 
 	for sn, s := range suites {
 		var headline string
@@ -494,26 +692,26 @@ func benchmark(suites []*suite.Suite) {
 			abbrTitle := abbrevTitle(i+1, t.Title)
 
 			// Benchmarking
-			dur, f, err := s.BenchTest(i, numRuns)
+			dur, samples, f, err := s.BenchTest(i, numRuns)
 			if err != nil {
 				result += fmt.Sprintf("%s: Unable to bench: %s\n", abbrTitle, err.Error())
 			} else {
-				fdur := make([]float64, len(dur))
-				for k, d := range dur {
-					fdur[k] = float64(d)
-				}
+				fdur := histSamples(dur, numRuns)
 				boxChart.AddSet(float64(cnt), fdur, true)
 				boxChart.XRange.Category = append(boxChart.XRange.Category, t.Title)
 				cnt++
 				histogram.AddData(t.Title, fdur, chart.Style{})
 
 				result += fmt.Sprintf("%s:  ", abbrTitle)
-				p := stat.DistributionInt(dur, statLevels)
+				p := msDistribution(dur, statLevels)
 				for i, lev := range statLevels {
-					result += fmt.Sprintf("%d%% < %-4d ", lev, p[i])
+					result += fmt.Sprintf("%g%% < %-4d ", lev, p[i])
 				}
-				result += fmt.Sprintf("(#%d F%d)\n", len(dur), f)
-				charts += stat.HistogramChartUrlInt(dur, t.Title, "Response Time [ms]") + "\n"
+				result += fmt.Sprintf("(#%d F%d)\n", dur.Count(), f)
+				results.Results = append(results.Results,
+					benchResult{Suite: s.Name, Test: t.Title, Failures: f, RT: dur, Samples: samples})
+				charts += fmt.Sprintf("%s:  %s\n", abbrTitle,
+					strings.Join(writeBenchHistogram(fdur, t.Title, fmt.Sprintf("bench-%d-%d", sn+1, i+1)), "  "))
 			}
 		}
 		result += "\n"
@@ -521,6 +719,9 @@ func benchmark(suites []*suite.Suite) {
 
 	}
 
+	boxChart.XRange.Fixed(-1, float64(cnt), 1)
+	charts += "Response Times: " + strings.Join(writeChart(&boxChart, 800, 400, "bench"), "  ") + "\n"
+
 	fmt.Print(result)
 	fmt.Print(charts)
 
@@ -534,18 +735,20 @@ func benchmark(suites []*suite.Suite) {
 		file.Write([]byte(charts))
 		file.Close()
 	}
+	if err = writeBenchResults(results, filename+".json"); err != nil {
+		errorf("Cannot write to %s.json: %s", filename, err.Error())
+	}
 
 	file, err = os.Create(filename + ".svg")
 	if err != nil {
 		errorf("Cannot write to " + filename + ".svg")
 		return
 	} else {
-		boxChart.XRange.Fixed(-1, float64(cnt), 1)
 		thesvg := svg.New(file)
 		thesvg.Start(800, 800)
 		thesvg.Title("Response Times")
 		thesvg.Rect(0, 0, 800, 800, "fill: #ffffff")
-		svggraphics := svgg.New(thesvg, 800, 400, "Arial", 12, color.RGBA{255, 255, 255, 255})
+		svggraphics := svgg.New(thesvg, 800, 400, "Arial", 12, white)
 		boxChart.Plot(svggraphics)
 
 		thesvg.Gtransform("translate(0 400)")
@@ -558,6 +761,21 @@ func benchmark(suites []*suite.Suite) {
 
 }
 
+// Write histogram of the response times dur (in ms) of the benchmarked
+// test title to files name.{svg,png}. Returns the names of the written files.
+func writeBenchHistogram(dur []float64, title, name string) []string {
+	var histogram chart.HistChart
+	histogram.Title = title
+	histogram.XRange.Label = "Response Time [ms]"
+	histogram.XRange.MinMode.Fixed = true
+	histogram.XRange.MinMode.Value = 0
+	histogram.Key.Hide = true
+	histogram.Counts = true
+	histogram.AddData("Response Times", dur, chart.Style{LineColor: color.RGBA{0x40, 0x40, 0x40, 0xff},
+		FillColor: color.RGBA{0x40, 0x40, 0x40, 0xff}})
+	return writeChart(&histogram, 600, 300, name)
+}
+
 // Junit output uses the following mapping
 //   file my-suite.wt   <-->  testsuite
 //   test ----Name----  <-->  testcase
@@ -699,6 +917,10 @@ func test(suites []*suite.Suite) {
 
 	junit += "<testsuites>\n"
 
+	if harFile != "" {
+		writeHAR(harFile)
+	}
+
 	filename := outputPath + "wtresults_" + time.Now().Format("2006-01-02_15-04-05") + ".txt"
 	file, err := os.Create(filename)
 	defer file.Close()
@@ -752,6 +974,7 @@ func readSuite(filename string) (s *suite.Suite, basename string, err error) {
 	}
 	basename = path.Base(filename)
 	parser := suite.NewParser(file, basename)
+	parser.Dir = path.Dir(filename)
 	s, err = parser.ReadSuite()
 	if err != nil {
 		errorf("Problems parsing '%s': %s\n", filename, err.Error())